@@ -1,35 +1,149 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/brendanburkhart/raytracer/internal/camera"
 	"github.com/brendanburkhart/raytracer/internal/scene"
+	"github.com/brendanburkhart/raytracer/internal/yaml"
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
 )
 
+// options holds the command-line configuration shared by all scenes
+type options struct {
+	outputDir      string
+	jobs           int
+	threads        int
+	maxReflections int
+	overwrite      bool
+	validate       bool
+	strict         bool
+	savePartial    bool
+	benchmark      int
+	warmup         int
+	verifyThreads  bool
+}
+
+// verifyThreadCounts are the thread counts scenes are rendered with to verify that renders are deterministic
+var verifyThreadCounts = []int{1, 4, 64}
+
 func main() {
-	sceneData := os.Args[1:]
+	var opts options
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	flags.StringVar(&opts.outputDir, "out", "", "directory to write rendered images to, instead of alongside each scene file, preserving subdirectories of scene folders")
+	flags.IntVar(&opts.jobs, "jobs", 1, "number of scene files to render concurrently")
+	flags.IntVar(&opts.threads, "threads", 2<<10, "total number of concurrent ray tracing goroutines, shared between scenes")
+	flags.IntVar(&opts.maxReflections, "max-reflections", 15, "maximum number of times a ray is reflected")
+	flags.BoolVar(&opts.overwrite, "overwrite", false, "replace existing output files")
+	flags.BoolVar(&opts.validate, "validate", false, "load and initialize scenes to report errors, without rendering")
+	flags.BoolVar(&opts.strict, "strict", false, "treat warnings about objects which are probably mistakes as errors")
+	flags.BoolVar(&opts.savePartial, "save-partial", false, "save the partially rendered image of scenes interrupted by Ctrl-C")
+	flags.IntVar(&opts.benchmark, "benchmark", 0, "render each scene this many times, one scene at a time, and report timing without writing files")
+	flags.IntVar(&opts.warmup, "warmup", 1, "number of untimed renders of each scene before benchmarking it")
+	flags.BoolVar(&opts.verifyThreads, "verify-threads", false, "render each scene in memory with 1, 4 and 64 threads and report whether the outputs are identical, without writing files")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [flags] <folder or JSON file>...\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	if opts.jobs < 1 || opts.threads < 1 || opts.maxReflections < 0 || opts.benchmark < 0 || opts.warmup < 0 {
+		fmt.Printf("\nError: jobs and threads must be at least 1, and max-reflections, benchmark and warmup cannot be negative\n\n")
+		flags.Usage()
+		os.Exit(2)
+	}
+	if (opts.validate && opts.benchmark > 0) || (opts.verifyThreads && (opts.validate || opts.benchmark > 0)) {
+		fmt.Printf("\nError: only one of validate, benchmark and verify-threads can be used\n\n")
+		flags.Usage()
+		os.Exit(2)
+	}
+	if opts.benchmark > 0 {
+		// Concurrent scenes would compete for the processor and skew each other's timing
+		opts.jobs = 1
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
 
-	sceneCount := 0
+	var scenePaths []scenePath
 
-	for _, path := range sceneData {
+	for _, path := range flags.Args() {
 		ext := filepath.Ext(path)
-		if ext != "" && ext != ".json" {
-			fmt.Printf("\nError: path '%s' is not a valid scene file - missing '.json' extension\n\n", path)
+		if ext != "" && !isSceneFile(path) {
+			fmt.Printf("\nError: path '%s' is not a valid scene file - missing '.json', '.yaml' or '.yml' extension\n\n", path)
 		} else {
-			sceneCount += walkPath(path)
+			scenePaths = append(scenePaths, walkPath(path, filepath.Dir(path))...)
+		}
+	}
+
+	// The first interrupt stops rendering gracefully, later interrupts exit immediately
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		<-interrupts
+		signal.Stop(interrupts)
+		fmt.Printf("\nInterrupted, stopping renders (interrupt again to exit immediately)\n")
+		cancel()
+	}()
+
+	sceneCount := renderScenes(ctx, scenePaths, opts)
+
+	if ctx.Err() != nil {
+		fmt.Printf("Interrupted after completing %d of %d scene(s)\n", sceneCount, len(scenePaths))
+		os.Exit(130)
+	}
+
+	if opts.validate {
+		fmt.Printf("Successfully validated %d of %d scene(s)\n", sceneCount, len(scenePaths))
+		if sceneCount != len(scenePaths) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if opts.benchmark > 0 {
+		fmt.Printf("Successfully benchmarked %d of %d scene(s)\n", sceneCount, len(scenePaths))
+		if sceneCount != len(scenePaths) {
+			os.Exit(1)
 		}
+		return
+	}
+
+	if opts.verifyThreads {
+		fmt.Printf("Successfully verified %d of %d scene(s)\n", sceneCount, len(scenePaths))
+		if sceneCount != len(scenePaths) {
+			os.Exit(1)
+		}
+		return
 	}
 
 	fmt.Printf("Sucessfully rendered %d scene(s)\n", sceneCount)
 }
 
-func walkPath(path string) (sceneCount int) {
+// scenePath locates a scene file, both on disk and relative to the folder it was found in
+type scenePath struct {
+	path     string
+	relative string
+}
+
+// walkPath returns the paths of all scene files at or within path, relative to root
+func walkPath(path string, root string) (scenePaths []scenePath) {
 	fi, err := os.Stat(path)
 	if err != nil {
 		fmt.Printf("Error while walking %s: %v\n", path, err)
@@ -47,19 +161,102 @@ func walkPath(path string) (sceneCount int) {
 
 		for _, subpath := range subpaths {
 			fullpath := filepath.Join(path, subpath.Name())
-			sceneCount += walkPath(fullpath)
+			// Files included by other scenes are found alongside them, but can't be rendered on their own
+			if subpath.Mode().IsRegular() && isSceneFile(fullpath) && isSceneInclude(fullpath) {
+				continue
+			}
+			scenePaths = append(scenePaths, walkPath(fullpath, root)...)
 		}
 	case mode.IsRegular():
-		ext := filepath.Ext(path)
-		if ext != ".json" {
+		if !isSceneFile(path) {
 			return
 		}
-		outputPath := fmt.Sprintf("%s.png", strings.TrimSuffix(path, ext))
 
-		err = renderScene(path, outputPath)
+		relative, err := filepath.Rel(root, path)
 		if err != nil {
-			fmt.Printf("Error from %s: %v\n", path, err)
-		} else {
+			relative = filepath.Base(path)
+		}
+		scenePaths = append(scenePaths, scenePath{path: path, relative: relative})
+	}
+
+	return
+}
+
+// isSceneFile returns whether a path has the extension of a JSON or YAML scene file
+func isSceneFile(path string) bool {
+	return filepath.Ext(path) == ".json" || yaml.IsYAML(path)
+}
+
+// isSceneInclude returns whether a scene file holds only scene contents for inclusion by other scene
+// files, rather than a complete scene with a camera. Files which can't be read are treated as scenes,
+// so the error is reported when they are loaded
+func isSceneInclude(path string) bool {
+	data, err := yaml.ReadJSON(path)
+	if err != nil {
+		return false
+	}
+
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return false
+	}
+	_, hasScene := fields["scene"]
+	return !hasScene
+}
+
+// renderScenes renders each scene file using a pool of workers, and returns the number of
+// scenes successfully rendered. The ray tracing threads are divided evenly between workers.
+// Once ctx is cancelled, in-progress renders are stopped and no more scenes are started
+func renderScenes(ctx context.Context, scenePaths []scenePath, opts options) (sceneCount int) {
+	jobs := opts.jobs
+	opts.threads /= jobs
+	if opts.threads < 1 {
+		opts.threads = 1
+	}
+
+	paths := make(chan scenePath)
+	results := make(chan bool)
+
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				var err error
+				if opts.validate {
+					_, err = loadScene(path.path, opts.strict)
+				} else if opts.benchmark > 0 {
+					err = benchmarkScene(ctx, path.path, opts)
+				} else if opts.verifyThreads {
+					err = verifyScene(ctx, path.path, opts)
+				} else {
+					err = renderScene(ctx, path.path, outputPath(path, opts), opts)
+				}
+				if err != nil {
+					fmt.Printf("Error from %s: %v\n", path.path, err)
+				}
+				results <- err == nil
+			}
+		}()
+	}
+
+	go func() {
+	dispatch:
+		for _, path := range scenePaths {
+			select {
+			case paths <- path:
+			case <-ctx.Done():
+				break dispatch
+			}
+		}
+		close(paths)
+		wg.Wait()
+		close(results)
+	}()
+
+	for success := range results {
+		if success {
 			sceneCount++
 		}
 	}
@@ -67,50 +264,341 @@ func walkPath(path string) (sceneCount int) {
 	return
 }
 
-func renderScene(inputPath string, outputPath string) error {
-	input, err := os.Open(inputPath)
+// outputPath returns the path of the PNG image rendered from a scene file. Within the output
+// directory, the scene's path relative to the folder it was found in is preserved
+func outputPath(scene scenePath, opts options) string {
+	if opts.outputDir == "" {
+		return fmt.Sprintf("%s.png", strings.TrimSuffix(scene.path, filepath.Ext(scene.path)))
+	}
+
+	relative := fmt.Sprintf("%s.png", strings.TrimSuffix(scene.relative, filepath.Ext(scene.relative)))
+	return filepath.Join(opts.outputDir, relative)
+}
+
+// createOutput opens a new output file for writing, creating any missing directories.
+// This fails if the file already exists unless overwrite is set
+func createOutput(path string, overwrite bool) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overwrite {
+		flags |= os.O_EXCL
+	}
+
+	output, err := os.OpenFile(path, flags, 0600)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("output file %s already exists, use -overwrite to replace it", path)
+	}
+	return output, err
+}
+
+// sceneData is the contents of a scene file
+type sceneData struct {
+	Width            int               `json:"width"`
+	Height           int               `json:"height"`
+	HDROutput        bool              `json:"hdrOutput"`
+	DepthOutput      bool              `json:"depthOutput"`
+	ObjectMaskOutput bool              `json:"objectMaskOutput"`
+	Camera           camera.Camera     `json:"camera"`
+	Scene            scene.Scene       `json:"scene"`
+	Animation        *camera.Animation `json:"animation"`
+}
+
+// loadScene reads and initializes a scene file so it is ready to render, printing any warnings about
+// the scene. With strict set, warnings are errors instead
+func loadScene(inputPath string, strict bool) (*sceneData, error) {
+	input, err := yaml.ReadJSON(inputPath)
 	if err != nil {
-		return fmt.Errorf("unable to open data file: %v", err)
+		return nil, fmt.Errorf("unable to open data file: %v", err)
 	}
-	defer input.Close()
 
-	data := &struct {
-		Width  int           `json:"width"`
-		Height int           `json:"height"`
-		Camera camera.Camera `json:"camera"`
-		Scene  scene.Scene   `json:"scene"`
-	}{}
+	data := &sceneData{}
+
+	if err = json.Unmarshal(input, data); err != nil {
+		// Locations within JSON converted from YAML wouldn't correspond to the scene file
+		if !yaml.IsYAML(inputPath) {
+			err = locateJSONError(input, err)
+		}
+		return nil, fmt.Errorf("couldn't unmarshal scene data: %v", err)
+	}
+
+	if data.Camera.TileHeight != nil && (data.HDROutput || data.DepthOutput || data.ObjectMaskOutput) {
+		return nil, fmt.Errorf("tiled rendering only produces a PNG, it cannot be used with HDR, depth or object mask output")
+	}
 
-	if err = json.NewDecoder(input).Decode(data); err != nil {
-		return fmt.Errorf("couldn't unmarshal scene data: %v", err)
+	if data.Animation != nil {
+		// Progressive passes would blend each frame into the frames before it
+		if data.Camera.Progressive {
+			return nil, fmt.Errorf("animations cannot use progressive rendering")
+		}
+		if err = data.Animation.Initialize(); err != nil {
+			return nil, fmt.Errorf("couldn't initialize animation: %v", err)
+		}
 	}
 
+	data.Scene.Directory = filepath.Dir(inputPath)
+	data.Scene.Strict = data.Scene.Strict || strict
 	if err = data.Scene.Initialize(); err != nil {
-		return fmt.Errorf("couldn't initialize scene: %v", err)
+		return nil, fmt.Errorf("couldn't initialize scene: %v", err)
+	}
+	for _, warning := range data.Scene.Warnings {
+		fmt.Printf("Warning from %s: %s\n", inputPath, warning)
 	}
 
-	if err != nil {
-		return fmt.Errorf("unable to create scene: %v", err)
+	for _, warning := range data.Camera.Warnings {
+		fmt.Printf("Warning from %s: %s\n", inputPath, warning)
+	}
+	if data.Scene.Strict && len(data.Camera.Warnings) > 0 {
+		return nil, fmt.Errorf("strict mode: %s", strings.Join(data.Camera.Warnings, "; "))
 	}
 
 	err = data.Camera.SetImageSize(data.Width, data.Height)
 	if err != nil {
-		return fmt.Errorf("error setting camera image size: %v", err)
+		return nil, fmt.Errorf("error setting camera image size: %v", err)
 	}
 
-	fmt.Printf("Rendering scene (using %s lens) from: %s\n", data.Camera.GetLensName(), inputPath)
+	return data, nil
+}
 
-	if err = data.Camera.Render(&data.Scene, 15, 2<<10); err != nil {
-		return fmt.Errorf("error while raytracing scene: %v", err)
+// locateJSONError adds the line and column within data at which a JSON syntax or type error occurred,
+// including errors within the camera, scene and objects, which are unmarshalled separately
+func locateJSONError(data []byte, err error) error {
+	offset, ok := raytracing.JSONErrorOffset(data, err)
+	if !ok {
+		return err
+	}
+
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	line, column := 1, 1
+	for _, b := range data[:offset] {
+		if b == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+
+	return fmt.Errorf("line %d, column %d (byte offset %d): %v", line, column, offset, err)
+}
+
+func renderScene(ctx context.Context, inputPath string, outputPath string, opts options) error {
+	if _, err := os.Stat(outputPath); err == nil && !opts.overwrite {
+		return fmt.Errorf("output file %s already exists, use -overwrite to replace it", outputPath)
+	}
+
+	data, err := loadScene(inputPath, opts.strict)
+	if err != nil {
+		return err
+	}
+
+	data.Camera.RecordDepth = data.DepthOutput
+	data.Camera.RecordObjects = data.ObjectMaskOutput
+
+	if data.Animation == nil {
+		fmt.Printf("Rendering scene (using %s lens) from: %s\n", data.Camera.GetLensName(), inputPath)
+		return renderFrame(ctx, data, inputPath, outputPath, opts)
+	}
+
+	fmt.Printf("Rendering %d frame(s) of scene (using %s lens) from: %s\n", data.Animation.Frames, data.Camera.GetLensName(), inputPath)
+	for frame := 0; frame < data.Animation.Frames; frame++ {
+		if err = data.Animation.SetFrame(&data.Camera.Scope, frame); err != nil {
+			return fmt.Errorf("couldn't move camera: %v", err)
+		}
+		if err = renderFrame(ctx, data, inputPath, framePath(outputPath, frame), opts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// framePath returns the path of the PNG image of an animation frame, numbered from one
+func framePath(outputPath string, frame int) string {
+	return fmt.Sprintf("%s_%04d.png", strings.TrimSuffix(outputPath, filepath.Ext(outputPath)), frame+1)
+}
+
+// renderFrame renders a loaded scene from the current view of its camera, and saves the
+// image and any other outputs alongside outputPath
+func renderFrame(ctx context.Context, data *sceneData, inputPath string, outputPath string, opts options) error {
+	if data.Camera.TileHeight != nil {
+		return renderTiled(ctx, data, inputPath, outputPath, opts)
+	}
+
+	err := data.Camera.RenderContext(ctx, &data.Scene, opts.maxReflections, opts.threads)
+	if err != nil {
+		if ctx.Err() == nil || !opts.savePartial {
+			return fmt.Errorf("error while raytracing scene: %v", err)
+		}
+
+		if err = savePNG(&data.Camera, outputPath, opts.overwrite); err != nil {
+			return err
+		}
+		return fmt.Errorf("render interrupted, saved partial image to %s", outputPath)
+	}
+
+	sceneStats, renderStats := data.Scene.Stats(), data.Camera.Stats()
+	fmt.Printf("Rendered %s: %d object(s) (%d triangle(s)), %d light(s), %d primary rays in %v\n",
+		inputPath, sceneStats.Objects, sceneStats.Triangles, sceneStats.Lights, renderStats.PrimaryRays, renderStats.Duration)
+	printRayCounts(renderStats)
+
+	if err = savePNG(&data.Camera, outputPath, opts.overwrite); err != nil {
+		return err
+	}
+
+	if data.HDROutput {
+		hdrPath := fmt.Sprintf("%s.pfm", strings.TrimSuffix(outputPath, filepath.Ext(outputPath)))
+		if err = saveHDR(&data.Camera, hdrPath, opts.overwrite); err != nil {
+			return err
+		}
+	}
+
+	if data.DepthOutput {
+		depthPath := fmt.Sprintf("%s.depth.pfm", strings.TrimSuffix(outputPath, filepath.Ext(outputPath)))
+		if err = saveDepth(&data.Camera, depthPath, opts.overwrite); err != nil {
+			return err
+		}
+	}
+
+	if data.ObjectMaskOutput {
+		maskPath := fmt.Sprintf("%s.objects.png", strings.TrimSuffix(outputPath, filepath.Ext(outputPath)))
+		if err = saveObjectMask(&data.Camera, maskPath, opts.overwrite); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verifyScene renders a scene in memory with each of the verify thread counts, and returns an error if
+// any of the outputs differ from those rendered with one thread, which would mean the result depends on
+// the order goroutines run in, such as from a data race
+func verifyScene(ctx context.Context, inputPath string, opts options) error {
+	var reference []byte
+	for _, threads := range verifyThreadCounts {
+		data, err := loadScene(inputPath, opts.strict)
+		if err != nil {
+			return err
+		}
+		output, err := renderOutputs(ctx, data, threads, opts)
+		if err != nil {
+			return fmt.Errorf("error while raytracing scene with %d thread(s): %v", threads, err)
+		}
+
+		if reference == nil {
+			reference = output
+		} else if !bytes.Equal(output, reference) {
+			return fmt.Errorf("rendering with %d thread(s) differs from rendering with %d thread(s)", threads, verifyThreadCounts[0])
+		}
 	}
 
-	output, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	fmt.Printf("Verified %s: identical outputs with %v threads\n", inputPath, verifyThreadCounts)
+	return nil
+}
+
+// renderOutputs renders a loaded scene with the given number of threads, and returns the encoded PNG
+// followed by the HDR image and whichever depth and object mask outputs the scene enables
+func renderOutputs(ctx context.Context, data *sceneData, threads int, opts options) ([]byte, error) {
+	var output bytes.Buffer
+	if data.Camera.TileHeight != nil {
+		err := data.Camera.RenderTiledContext(ctx, &data.Scene, opts.maxReflections, threads, &output)
+		return output.Bytes(), err
+	}
+
+	data.Camera.RecordDepth = data.DepthOutput
+	data.Camera.RecordObjects = data.ObjectMaskOutput
+	if err := data.Camera.RenderContext(ctx, &data.Scene, opts.maxReflections, threads); err != nil {
+		return nil, err
+	}
+
+	// The HDR image is compared too, since differences might round away in the PNG
+	if err := data.Camera.Save(&output); err != nil {
+		return nil, err
+	}
+	if err := data.Camera.SavePFM(&output); err != nil {
+		return nil, err
+	}
+	if data.DepthOutput {
+		if err := data.Camera.SaveDepth(&output); err != nil {
+			return nil, err
+		}
+	}
+	if data.ObjectMaskOutput {
+		if err := data.Camera.SaveObjectMask(&output); err != nil {
+			return nil, err
+		}
+	}
+	return output.Bytes(), nil
+}
+
+// benchmarkScene renders a scene the benchmark number of times in memory and reports the timing, without writing
+// any files. Warmup renders first bring the heap and caches to a steady state, so they don't skew the first run,
+// and the garbage collector runs before each timed render so garbage from the previous one isn't counted
+func benchmarkScene(ctx context.Context, inputPath string, opts options) error {
+	data, err := loadScene(inputPath, opts.strict)
+	if err != nil {
+		return err
+	}
+
+	render := func() (camera.RenderStats, error) {
+		var err error
+		if data.Camera.TileHeight != nil {
+			err = data.Camera.RenderTiledContext(ctx, &data.Scene, opts.maxReflections, opts.threads, ioutil.Discard)
+		} else {
+			err = data.Camera.RenderContext(ctx, &data.Scene, opts.maxReflections, opts.threads)
+		}
+		if err != nil {
+			return camera.RenderStats{}, fmt.Errorf("error while raytracing scene: %v", err)
+		}
+		return data.Camera.Stats(), nil
+	}
+
+	for i := 0; i < opts.warmup; i++ {
+		if _, err = render(); err != nil {
+			return err
+		}
+	}
+
+	var stats camera.RenderStats
+	var best, total time.Duration
+	for i := 0; i < opts.benchmark; i++ {
+		runtime.GC()
+		if stats, err = render(); err != nil {
+			return err
+		}
+		total += stats.Duration
+		if i == 0 || stats.Duration < best {
+			best = stats.Duration
+		}
+	}
+
+	mean := total / time.Duration(opts.benchmark)
+	fmt.Printf("Benchmarked %s: %d run(s) after %d warmup(s), best %v, mean %v\n", inputPath, opts.benchmark, opts.warmup, best, mean)
+	fmt.Printf("  %d primary rays, %d rays in total, %.0f rays/s at best (%.0f primary rays/s)\n",
+		stats.PrimaryRays, stats.TotalRays(), float64(stats.TotalRays())/best.Seconds(), float64(stats.PrimaryRays)/best.Seconds())
+	return nil
+}
+
+// printRayCounts prints the number of each kind of ray traced by a render and the average depth of their paths
+func printRayCounts(stats camera.RenderStats) {
+	secondary := stats.Secondary
+	fmt.Printf("  %d rays in total: %d shadow, %d reflected, %d refracted, %d diffuse, average depth %.2f\n",
+		stats.TotalRays(), secondary.Shadow, secondary.Reflected, secondary.Refracted, secondary.Diffuse, stats.AverageDepth())
+}
+
+func savePNG(c *camera.Camera, outputPath string, overwrite bool) error {
+	output, err := createOutput(outputPath, overwrite)
 	if err != nil {
 		return fmt.Errorf("unable to open output file: %v", err)
 	}
 	defer output.Close()
 
-	if err = data.Camera.Save(output); err != nil {
+	if err = c.Save(output); err != nil {
 		return fmt.Errorf("unable to encode rendering: %v", err)
 	}
 
@@ -120,3 +608,84 @@ func renderScene(inputPath string, outputPath string) error {
 
 	return nil
 }
+
+func saveHDR(c *camera.Camera, outputPath string, overwrite bool) error {
+	output, err := createOutput(outputPath, overwrite)
+	if err != nil {
+		return fmt.Errorf("unable to open HDR output file: %v", err)
+	}
+	defer output.Close()
+
+	if err = c.SavePFM(output); err != nil {
+		return fmt.Errorf("unable to encode HDR rendering: %v", err)
+	}
+
+	if err = output.Sync(); err != nil {
+		return fmt.Errorf("unable to save rendering as PFM: %v", err)
+	}
+
+	return nil
+}
+
+// renderTiled renders a scene tile by tile, writing the PNG as each tile completes. An interrupted
+// tiled render leaves an incomplete PNG, so the output is removed rather than saved as partial
+func renderTiled(ctx context.Context, data *sceneData, inputPath string, outputPath string, opts options) error {
+	output, err := createOutput(outputPath, opts.overwrite)
+	if err != nil {
+		return fmt.Errorf("unable to open output file: %v", err)
+	}
+	defer output.Close()
+
+	if err = data.Camera.RenderTiledContext(ctx, &data.Scene, opts.maxReflections, opts.threads, output); err != nil {
+		output.Close()
+		os.Remove(outputPath)
+		return fmt.Errorf("error while raytracing scene: %v", err)
+	}
+
+	sceneStats, renderStats := data.Scene.Stats(), data.Camera.Stats()
+	fmt.Printf("Rendered %s: %d object(s) (%d triangle(s)), %d light(s), %d primary rays in %v\n",
+		inputPath, sceneStats.Objects, sceneStats.Triangles, sceneStats.Lights, renderStats.PrimaryRays, renderStats.Duration)
+	printRayCounts(renderStats)
+
+	if err = output.Sync(); err != nil {
+		return fmt.Errorf("unable to save rendering as PNG: %v", err)
+	}
+
+	return nil
+}
+
+func saveDepth(c *camera.Camera, outputPath string, overwrite bool) error {
+	output, err := createOutput(outputPath, overwrite)
+	if err != nil {
+		return fmt.Errorf("unable to open depth output file: %v", err)
+	}
+	defer output.Close()
+
+	if err = c.SaveDepth(output); err != nil {
+		return fmt.Errorf("unable to encode depth map: %v", err)
+	}
+
+	if err = output.Sync(); err != nil {
+		return fmt.Errorf("unable to save depth map as PFM: %v", err)
+	}
+
+	return nil
+}
+
+func saveObjectMask(c *camera.Camera, outputPath string, overwrite bool) error {
+	output, err := createOutput(outputPath, overwrite)
+	if err != nil {
+		return fmt.Errorf("unable to open object mask output file: %v", err)
+	}
+	defer output.Close()
+
+	if err = c.SaveObjectMask(output); err != nil {
+		return fmt.Errorf("unable to encode object mask: %v", err)
+	}
+
+	if err = output.Sync(); err != nil {
+		return fmt.Errorf("unable to save object mask as PNG: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// sceneFile is a valid scene file, with a placeholder for the value of each field a test replaces
+const sceneFile = `{
+  "width": 4,
+  "height": 3,
+  "camera": {
+    "position": {"x": 0, "y": 1, "z": -5},
+    "target": {"x": 0, "y": 0, "z": 0},
+    "projection": "perspective",
+    "hfov": %s,
+    "focalLength": 1
+  },
+  "scene": {
+    "brightness": %s,
+    "materials": [
+      {"diffuse": {"red": 1, "green": 1, "blue": 1}, "alpha": %s}
+    ],
+    "lights": [{"position": {"x": 0, "y": 5, "z": 0}, "diffuse": {"red": 1, "green": 1, "blue": 1}}],
+    "objects": [
+      {"type": "plane", "point": {"x": 0, "y": 0, "z": 0}, "normal": {"x": 0, "y": 1, "z": 0}, "material": 0},
+      {"type": "sphere", "center": {"x": 0, "y": 1, "z": 0}, "radius": %s, "material": 0}
+    ]
+  }
+}`
+
+func TestLocateNestedJSONErrors(t *testing.T) {
+	tests := []struct {
+		name                            string
+		hfov, brightness, alpha, radius string
+		// value is the offending value, which must only appear once in the scene file
+		value string
+		field string
+	}{
+		{"camera", `"wide"`, `1`, `1`, `1`, `"wide"`, "hfov"},
+		{"scene", `60`, `"bright"`, `1`, `1`, `"bright"`, "brightness"},
+		{"material", `60`, `1`, `true`, `1`, `true`, "alpha"},
+		{"object", `60`, `1`, `1`, `"one"`, `"one"`, "radius"},
+	}
+	for _, test := range tests {
+		input := fmt.Sprintf(sceneFile, test.hfov, test.brightness, test.alpha, test.radius)
+		err := json.Unmarshal([]byte(input), &sceneData{})
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+
+		// Errors are reported just after the offending value
+		end := strings.Index(input, test.value) + len(test.value)
+		line := strings.Count(input[:end], "\n") + 1
+		column := end - strings.LastIndex(input[:end], "\n")
+
+		located := locateJSONError([]byte(input), err).Error()
+		want := fmt.Sprintf("line %d, column %d ", line, column)
+		if !strings.HasPrefix(located, want) || !strings.Contains(located, test.field) {
+			t.Errorf("%s: located error %q, want it at %q mentioning %s", test.name, located, want, test.field)
+		}
+	}
+
+	// The scene file is valid once every field has a value of the right type
+	input := []byte(fmt.Sprintf(sceneFile, `60`, `1`, `1`, `1`))
+	if err := json.Unmarshal(input, &sceneData{}); err != nil {
+		t.Fatalf("valid scene file returned %v", err)
+	}
+}
+
+func TestLocateJSONSyntaxError(t *testing.T) {
+	// The second comma is at column 15, and the error is reported just after it
+	input := []byte("{\n  \"width\": 4,\n  \"height\": 3,,\n}")
+	err := json.Unmarshal(input, &sceneData{})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if located := locateJSONError(input, err).Error(); !strings.HasPrefix(located, "line 3, column 16 ") {
+		t.Errorf("located error %q, want it at line 3, column 16", located)
+	}
+}
@@ -0,0 +1,74 @@
+package camera
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/brendanburkhart/raytracer/internal/scene"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+// renderAdaptive adaptively samples a pixel, only subdividing where sample colors differ by more than
+// the adaptive threshold, and records the result. If a non-nil WaitGroup is passed in, Done will be
+// called on it once the ray tracing is complete. Nothing is rendered once ctx is cancelled.
+// This is threadsafe and can be executed in a goroutine.
+func (c *Camera) renderAdaptive(ctx context.Context, s *scene.Scene, pixelX int, pixelY int, maxRayReflections int, wg *sync.WaitGroup, sema semaphore) {
+	if wg != nil {
+		defer wg.Done()
+	}
+
+	sema <- empty{}
+	defer func() { <-sema }()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	budget := *c.AdaptiveMaxSamples
+	var counts scene.RayCounts
+	c.recordPixel(pixelX, pixelY, c.sampleAdaptive(s, float64(pixelX), float64(pixelY), 1.0, maxRayReflections, &budget, &counts))
+	c.addCounts(counts)
+}
+
+// sampleAdaptive traces a ray through the center of each quadrant of the square region with top left
+// corner (x, y) in render pixel coordinates. While the sample budget allows, quadrants are recursively
+// subdivided if the colors of the four samples differ by more than the adaptive threshold.
+// Returns the combined sample for the region, counting secondary rays in counts
+func (c *Camera) sampleAdaptive(s *scene.Scene, x float64, y float64, size float64, maxRayReflections int, budget *int, counts *scene.RayCounts) sample {
+	half := size * 0.5
+
+	samples := make([]sample, 4)
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			ray := c.primaryRay(x+(float64(i)+0.5)*half, y+(float64(j)+0.5)*half)
+			samples[2*i+j] = c.traceSample(s, ray, maxRayReflections, counts)
+		}
+	}
+	*budget -= 4
+
+	if colorRange(samples) > *c.AdaptiveThreshold {
+		for i := 0; i < 2 && *budget >= 4; i++ {
+			for j := 0; j < 2 && *budget >= 4; j++ {
+				samples[2*i+j] = c.sampleAdaptive(s, x+float64(i)*half, y+float64(j)*half, half, maxRayReflections, budget, counts)
+			}
+		}
+	}
+
+	return combineSamples(samples, nil)
+}
+
+// colorRange returns the largest difference in any one channel between the colors of the samples
+func colorRange(samples []sample) float64 {
+	min := raytracing.Color{Red: math.Inf(1), Green: math.Inf(1), Blue: math.Inf(1)}
+	max := raytracing.Color{Red: math.Inf(-1), Green: math.Inf(-1), Blue: math.Inf(-1)}
+	for _, sample := range samples {
+		color := sample.color
+		min.Red, max.Red = math.Min(min.Red, color.Red), math.Max(max.Red, color.Red)
+		min.Green, max.Green = math.Min(min.Green, color.Green), math.Max(max.Green, color.Green)
+		min.Blue, max.Blue = math.Min(min.Blue, color.Blue), math.Max(max.Blue, color.Blue)
+	}
+
+	return math.Max(max.Red-min.Red, math.Max(max.Green-min.Green, max.Blue-min.Blue))
+}
@@ -0,0 +1,112 @@
+package camera
+
+import (
+	"math"
+	"testing"
+
+	"github.com/brendanburkhart/raytracer/internal/scene"
+)
+
+// benchmarkWidth and benchmarkHeight are the image size of the anti-aliasing benchmarks
+const benchmarkWidth, benchmarkHeight = 96, 72
+
+// loadBenchmarkScene loads the sphere on a plane at a small image size, with the given anti-aliasing factor
+func loadBenchmarkScene(b *testing.B, antiAliasingFactor int) (*Camera, *scene.Scene) {
+	b.Helper()
+	c, s := loadBundledScene(b, "sphere-on-plane.json")
+	c.AntiAliasingFactor = &antiAliasingFactor
+	if err := c.SetImageSize(benchmarkWidth, benchmarkHeight); err != nil {
+		b.Fatal(err)
+	}
+	return c, s
+}
+
+// renderError returns the root mean square difference between the channels of the image rendered by c and
+// the reference image
+func renderError(b *testing.B, c *Camera, reference []uint8) float64 {
+	b.Helper()
+	img, err := c.Image()
+	if err != nil {
+		b.Fatal(err)
+	}
+	total := 0.0
+	for i := range img.Pix {
+		difference := float64(img.Pix[i]) - float64(reference[i])
+		total += difference * difference
+	}
+	return math.Sqrt(total / float64(len(img.Pix)))
+}
+
+// benchmarkAntiAliasing renders the sphere on a plane with c, reporting the samples traced per pixel and the
+// error against a render with 256 samples per pixel
+func benchmarkAntiAliasing(b *testing.B, c *Camera, s *scene.Scene) {
+	reference, referenceScene := loadBenchmarkScene(b, 16)
+	if err := reference.Render(referenceScene, 15, 64); err != nil {
+		b.Fatal(err)
+	}
+	img, err := reference.Image()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.Render(s, 15, 64); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(c.Stats().PrimaryRays)/(benchmarkWidth*benchmarkHeight), "samples/pixel")
+	b.ReportMetric(renderError(b, c, img.Pix), "rms-error")
+}
+
+// BenchmarkSupersample renders with uniform anti-aliasing of 16 samples per pixel
+func BenchmarkSupersample(b *testing.B) {
+	c, s := loadBenchmarkScene(b, 4)
+	benchmarkAntiAliasing(b, c, s)
+}
+
+// BenchmarkAdaptive renders with adaptive anti-aliasing of up to 16 samples per pixel, which only
+// subdivides pixels along edges, so it traces fewer rays than BenchmarkSupersample for a similar error
+func BenchmarkAdaptive(b *testing.B) {
+	c, s := loadBenchmarkScene(b, 1)
+	threshold, maxSamples := 0.05, 16
+	c.AdaptiveThreshold = &threshold
+	c.AdaptiveMaxSamples = &maxSamples
+	benchmarkAntiAliasing(b, c, s)
+}
+
+func TestSampleCount(t *testing.T) {
+	c, s := loadBundledScene(t, "sphere-on-plane.json")
+	antiAliasingFactor, supersample := 2, 3
+	c.AntiAliasingFactor = &antiAliasingFactor
+	c.Supersample = &supersample
+	c.Progressive = true
+	if err := c.SetImageSize(16, 12); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := c.SampleCount(); got != 0 {
+		t.Errorf("before rendering, SampleCount() = %d, want 0", got)
+	}
+	for pass := 1; pass <= 2; pass++ {
+		render(t, c, s, 8)
+		if got, want := c.SampleCount(), pass*antiAliasingFactor*antiAliasingFactor*supersample*supersample; got != want {
+			t.Errorf("after %d passes, SampleCount() = %d, want %d", pass, got, want)
+		}
+	}
+
+	// Adaptive anti-aliasing takes at least four samples in every render pixel, and more along edges
+	c, s = loadBundledScene(t, "sphere-on-plane.json")
+	threshold, maxSamples := 0.05, 16
+	c.AdaptiveThreshold = &threshold
+	c.AdaptiveMaxSamples = &maxSamples
+	if err := c.SetImageSize(16, 12); err != nil {
+		t.Fatal(err)
+	}
+	render(t, c, s, 8)
+	if got := c.SampleCount(); got <= 4 || got >= maxSamples {
+		t.Errorf("adaptive SampleCount() = %d, want between 4 and %d", got, maxSamples)
+	}
+}
@@ -0,0 +1,42 @@
+package camera
+
+import (
+	"math"
+)
+
+// apertureSample returns a point on an aperture of unit radius for the lens ray through (screenX, screenY),
+// as offsets along the right and up vectors. The aperture is a disk if blades is zero, otherwise a
+// regular polygon with that many sides. Points are derived from the screen position rather than a
+// random source, so renders are repeatable and anti-aliasing samples each use a different point
+func apertureSample(screenX float64, screenY float64, blades int) (float64, float64) {
+	seed := mix(math.Float64bits(screenX) ^ mix(math.Float64bits(screenY)))
+	r1 := float64(seed>>11) / (1 << 53)
+	r2 := float64(mix(seed)>>11) / (1 << 53)
+
+	if blades == 0 {
+		radius := math.Sqrt(r1)
+		angle := 2.0 * math.Pi * r2
+		return radius * math.Cos(angle), radius * math.Sin(angle)
+	}
+
+	// Pick one of the triangles between the center and each edge of the polygon, then sample it uniformly
+	sector := math.Floor(r1 * float64(blades))
+	r1 = r1*float64(blades) - sector
+
+	step := 2.0 * math.Pi / float64(blades)
+	first := math.Pi/2.0 + sector*step
+	second := first + step
+
+	scale := math.Sqrt(r1)
+	x := scale * ((1.0-r2)*math.Cos(first) + r2*math.Cos(second))
+	y := scale * ((1.0-r2)*math.Sin(first) + r2*math.Sin(second))
+	return x, y
+}
+
+// mix scrambles the bits of x using the SplitMix64 finalizer
+func mix(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
@@ -0,0 +1,96 @@
+package camera
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+// Bloom makes bright areas of the image glow by blurring the light above a threshold into nearby pixels
+type Bloom struct {
+	Threshold *float64 `json:"threshold"`
+	Radius    float64  `json:"radius"`
+}
+
+// initialize validates the bloom parameters and sets defaults
+func (b *Bloom) initialize() error {
+	if b.Radius <= 0.0 {
+		return fmt.Errorf("bloom radius must be positive")
+	}
+	if b.Threshold == nil {
+		threshold := 1.0
+		b.Threshold = &threshold
+	}
+	return nil
+}
+
+// apply adds bloom to a high dynamic range image of the given size, returning the result
+func (b *Bloom) apply(hdr []raytracing.Color, width int, height int) []raytracing.Color {
+	bright := make([]raytracing.Color, len(hdr))
+	for i, pixel := range hdr {
+		bright[i] = raytracing.Color{
+			Red:   math.Max(0.0, pixel.Red-*b.Threshold),
+			Green: math.Max(0.0, pixel.Green-*b.Threshold),
+			Blue:  math.Max(0.0, pixel.Blue-*b.Threshold),
+		}
+	}
+
+	kernel := gaussianKernel(b.Radius)
+	blurred := blur(blur(bright, width, height, kernel, 1, 0), width, height, kernel, 0, 1)
+
+	result := make([]raytracing.Color, len(hdr))
+	for i := range hdr {
+		result[i] = hdr[i].Add(blurred[i])
+	}
+	return result
+}
+
+// gaussianKernel returns normalized weights for offsets from 0 out to three standard deviations,
+// where the radius is the standard deviation in pixels
+func gaussianKernel(radius float64) []float64 {
+	size := int(math.Ceil(3.0 * radius))
+	kernel := make([]float64, size+1)
+
+	total := 0.0
+	for i := range kernel {
+		kernel[i] = math.Exp(-float64(i*i) / (2.0 * radius * radius))
+		total += kernel[i]
+		if i > 0 {
+			total += kernel[i]
+		}
+	}
+
+	for i := range kernel {
+		kernel[i] /= total
+	}
+	return kernel
+}
+
+// blur convolves the image with a symmetric kernel along one axis given by (dx, dy), clamping at the edges
+func blur(img []raytracing.Color, width int, height int, kernel []float64, dx int, dy int) []raytracing.Color {
+	blurred := make([]raytracing.Color, len(img))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			sum := img[y*width+x].Scale(kernel[0])
+			for i := 1; i < len(kernel); i++ {
+				before := img[clamp(y-i*dy, height)*width+clamp(x-i*dx, width)]
+				after := img[clamp(y+i*dy, height)*width+clamp(x+i*dx, width)]
+				sum = sum.Add(before.Add(after).Scale(kernel[i]))
+			}
+			blurred[y*width+x] = sum
+		}
+	}
+	return blurred
+}
+
+// clamp limits a pixel coordinate to between 0 and size-1
+func clamp(i int, size int) int {
+	if i < 0 {
+		return 0
+	}
+	if i >= size {
+		return size - 1
+	}
+	return i
+}
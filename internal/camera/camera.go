@@ -1,6 +1,7 @@
 package camera
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"image"
@@ -8,11 +9,15 @@ import (
 	"image/png"
 	"io"
 	"math"
+	"math/rand"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/brendanburkhart/raytracer/internal/scene"
 
 	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+	"github.com/brendanburkhart/raytracer/pkg/raytracing/object"
 )
 
 type empty struct{}
@@ -22,12 +27,25 @@ type semaphore chan empty
 type Scope struct {
 	Position raytracing.Vector  `json:"position"`
 	Target   *raytracing.Vector `json:"target"`
-	Roll     float64            `json:"roll"`
-	Right    *raytracing.Vector `json:"right"`
-	Up       *raytracing.Vector `json:"up"`
-	Forward  *raytracing.Vector `json:"forward"`
+	// Yaw turns the camera to the right of the +z axis, and Pitch then tilts it upwards, both in degrees
+	Yaw     *float64           `json:"yaw"`
+	Pitch   *float64           `json:"pitch"`
+	Roll    float64            `json:"roll"`
+	Right   *raytracing.Vector `json:"right"`
+	Up      *raytracing.Vector `json:"up"`
+	Forward *raytracing.Vector `json:"forward"`
+
+	// Warnings describe explicit basis vectors which weren't orthogonal, and were corrected by Initialize
+	Warnings []string `json:"-"`
+
+	// bank is roll in degrees added to Roll, set by animations banking into turns
+	bank float64
 }
 
+// orthogonalityTolerance is the largest cosine of the angle between explicit basis vectors, about
+// 0.06 degrees from perpendicular, before Initialize warns that it corrected them
+const orthogonalityTolerance = 1e-3
+
 // GetUp returns the value of the normalized up vector for the scope
 func (s *Scope) GetUp() raytracing.Vector {
 	return *s.Up
@@ -43,28 +61,56 @@ func (s *Scope) GetForward() raytracing.Vector {
 	return *s.Forward
 }
 
-// Initialize must be called before the Scope is used
+// Initialize must be called before the Scope is used. Explicit basis vectors are made orthonormal,
+// with warnings if they weren't close to orthogonal
 func (s *Scope) Initialize() error {
 	var ok bool
 	var right, up, forward raytracing.Vector
+	vertical := raytracing.Vector{X: 0, Y: 1, Z: 0}
+
+	angles := s.Yaw != nil || s.Pitch != nil
+	if angles && s.Target != nil {
+		return fmt.Errorf("scope cannot have both a target and yaw or pitch angles")
+	}
 
 	if s.Target != nil {
 		forward, ok = s.Target.Subtract(s.Position).Normalize()
 		if !ok {
 			return fmt.Errorf("target and position are the same")
 		}
-		vertical := raytracing.Vector{X: 0, Y: 1, Z: 0}
 
 		if forward.IsVertical() {
 			right = raytracing.Vector{X: 1, Y: 0, Z: 0}
 		} else {
 			right = forward.Cross(vertical)
 		}
+	} else if angles {
+		var yaw, pitch float64
+		if s.Yaw != nil {
+			yaw = *s.Yaw
+		}
+		if s.Pitch != nil {
+			pitch = *s.Pitch
+		}
+
+		// Right is found from the yaw alone, so looking straight up or down keeps the heading
+		var err error
+		if right, err = (raytracing.Vector{X: -1, Y: 0, Z: 0}).Rotate(-yaw, vertical); err != nil {
+			return fmt.Errorf("scope rotation failed: %s", err)
+		}
+		if forward, err = (raytracing.Vector{X: 0, Y: 0, Z: 1}).Rotate(-yaw, vertical); err != nil {
+			return fmt.Errorf("scope rotation failed: %s", err)
+		}
+		if forward, err = forward.Rotate(pitch, right); err != nil {
+			return fmt.Errorf("scope rotation failed: %s", err)
+		}
+	}
 
+	if s.Target != nil || angles {
 		up = right.Cross(forward)
 
 		var err error
-		if up, err = up.Rotate(-s.Roll, forward); err != nil {
+		if up, err = up.Rotate(-(s.Roll + s.bank), forward); err != nil {
 			return fmt.Errorf("scope rotation failed: %s", err)
 		}
 		right = forward.Cross(up)
@@ -74,6 +120,10 @@ func (s *Scope) Initialize() error {
 		s.Forward = &forward
 	}
 
+	if s.Right == nil || s.Up == nil || s.Forward == nil {
+		return fmt.Errorf("camera orientation requires either a target, yaw or pitch angles, or a full basis of right, up and forward vectors")
+	}
+
 	right, ok = s.Right.Normalize()
 	if !ok {
 		return fmt.Errorf("vector 'right' is a zero vector")
@@ -87,6 +137,21 @@ func (s *Scope) Initialize() error {
 		return fmt.Errorf("vector 'forward' is a zero vector")
 	}
 
+	s.Warnings = nil
+	skew := math.Max(math.Abs(up.Dot(forward)), math.Max(math.Abs(right.Dot(forward)), math.Abs(right.Dot(up))))
+	if skew > orthogonalityTolerance {
+		s.Warnings = append(s.Warnings, fmt.Sprintf("camera basis vectors aren't orthogonal (largest cosine between them is %.3g), "+
+			"so up and right are corrected to be perpendicular, keeping forward and the plane of forward and up", skew))
+	}
+
+	// Gram-Schmidt orthogonalization keeps the direction of forward, and the sides up and right point to
+	if up, ok = up.Subtract(up.ProjectOnto(forward)).Normalize(); !ok {
+		return fmt.Errorf("vector 'up' is parallel to 'forward'")
+	}
+	if right, ok = right.Subtract(right.ProjectOnto(forward)).Subtract(right.ProjectOnto(up)).Normalize(); !ok {
+		return fmt.Errorf("vector 'right' is in the plane of 'up' and 'forward'")
+	}
+
 	s.Up = &up
 	s.Right = &right
 	s.Forward = &forward
@@ -94,16 +159,88 @@ func (s *Scope) Initialize() error {
 	return nil
 }
 
+// Region is a rectangular area of the output image, in pixels from the top left corner
+type Region struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// RenderStats describes the work done by the most recent render
+type RenderStats struct {
+	PrimaryRays int64
+	// Secondary counts the rays traced from the primary rays, and the depth of their paths
+	Secondary scene.RayCounts
+	Duration  time.Duration
+}
+
+// TotalRays returns the number of primary and secondary rays traced
+func (s RenderStats) TotalRays() int64 {
+	return s.PrimaryRays + s.Secondary.Total()
+}
+
+// AverageDepth returns the average number of bounces along the deepest path from each primary ray
+func (s RenderStats) AverageDepth() float64 {
+	if s.PrimaryRays == 0 {
+		return 0.0
+	}
+	return float64(s.Secondary.Depth) / float64(s.PrimaryRays)
+}
+
 // Camera renders a scene using a specific view and perspective
 type Camera struct {
 	imageWidth  int
 	imageHeight int
 
-	output *image.RGBA
-
-	AntiAliasingFactor *int   `json:"antiAliasingFactor"`
-	LightingModelName  string `json:"lightingModel"`
-	lightingModel      raytracing.LightingModel
+	renderWidth  int
+	renderHeight int
+
+	// Buffers hold the render rows from windowY to windowY+windowHeight, which is the whole image unless tiled
+	windowY      int
+	windowHeight int
+
+	accumulation []raytracing.Color
+	coverage     []float64
+	depth        []float64
+	objects      []int
+	// passes is the number of passes started, and recorded is the number of them which reached each pixel,
+	// which is fewer for pixels a cancelled pass didn't reach
+	passes   int
+	recorded []int
+	// sampledRays is the number of primary rays traced into the buffers over every pass
+	sampledRays int64
+
+	primaryRays int64
+	secondary   scene.RayCounts
+	stats       RenderStats
+
+	// maxRefractions is the scene's limit on refractions of each ray, for the render in progress
+	maxRefractions int
+
+	AntiAliasingFactor    *int     `json:"antiAliasingFactor"`
+	Supersample           *int     `json:"supersample"`
+	AdaptiveThreshold     *float64 `json:"adaptiveThreshold"`
+	AdaptiveMaxSamples    *int     `json:"adaptiveMaxSamples"`
+	Filter                *Filter  `json:"filter"`
+	LightingModelName     string   `json:"lightingModel"`
+	lightingModel         raytracing.LightingModel
+	Region                *Region   `json:"region"`
+	Progressive           bool      `json:"progressive"`
+	TransparentBackground bool      `json:"transparentBackground"`
+	Bloom                 *Bloom    `json:"bloom"`
+	Vignette              *Vignette `json:"vignette"`
+	Denoise               *Denoise  `json:"denoise"`
+	TileHeight            *int      `json:"tileHeight"`
+	BitDepth              *int      `json:"bitDepth"`
+
+	DebugMode     string   `json:"debug"`
+	DebugMaxDepth *float64 `json:"debugMaxDepth"`
+
+	// RecordDepth enables recording the distance to the closest hit of each pixel, see SaveDepth
+	RecordDepth bool `json:"-"`
+	// RecordObjects enables recording the index of the closest object hit in each pixel, see SaveObjectMask
+	RecordObjects bool `json:"-"`
 
 	Lens
 	Scope
@@ -118,8 +255,60 @@ func (c *Camera) UnmarshalJSON(b []byte) error {
 		Alias: (*Alias)(c),
 	}
 
+	// Offsets of errors are relative to the camera, so they are nested to be located within the scene file
 	if err := json.Unmarshal(b, &alias); err != nil {
-		return err
+		return raytracing.NestJSONError(b, fmt.Errorf("camera: %w", err))
+	}
+
+	var err error
+	if c.Lens, err = CreateLens(b); err != nil {
+		return raytracing.NestJSONError(b, fmt.Errorf("camera lens: %w", err))
+	}
+
+	return c.Initialize()
+}
+
+// MarshalJSON marshals a Camera, flattening the fields of its Lens into the camera as UnmarshalJSON expects
+func (c *Camera) MarshalJSON() ([]byte, error) {
+	type Alias Camera
+	b, err := json.Marshal((*Alias)(c))
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "Lens")
+
+	if c.Lens != nil {
+		lensFields, err := MarshalLens(c.Lens)
+		if err != nil {
+			return nil, fmt.Errorf("camera lens: %v", err)
+		}
+		for name, value := range lensFields {
+			fields[name] = value
+		}
+	}
+
+	return json.Marshal(fields)
+}
+
+// NewCamera creates a Camera with the given lens and scope, using default options
+func NewCamera(lens Lens, scope Scope) (*Camera, error) {
+	c := &Camera{Lens: lens, Scope: scope}
+	if err := c.Initialize(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Initialize validates the options of the Camera and fills in defaults. It must be called before
+// the Camera is used, and is called automatically when unmarshalling from JSON and by NewCamera
+func (c *Camera) Initialize() error {
+	if c.Lens == nil {
+		return fmt.Errorf("camera must have a lens")
 	}
 
 	if err := c.Scope.Initialize(); err != nil {
@@ -134,6 +323,81 @@ func (c *Camera) UnmarshalJSON(b []byte) error {
 		c.AntiAliasingFactor = &antiAliasingFactor
 	}
 
+	if c.Supersample != nil && *c.Supersample < 1 {
+		return fmt.Errorf("supersample factor must be at least one")
+	}
+	if c.Supersample == nil {
+		supersample := 1
+		c.Supersample = &supersample
+	}
+
+	if c.AdaptiveThreshold != nil && *c.AdaptiveThreshold < 0.0 {
+		return fmt.Errorf("adaptive anti-aliasing threshold cannot be negative")
+	}
+	if c.AdaptiveMaxSamples != nil && *c.AdaptiveMaxSamples < 4 {
+		return fmt.Errorf("adaptive anti-aliasing max samples must be at least four")
+	}
+	if c.AdaptiveMaxSamples == nil {
+		adaptiveMaxSamples := 64
+		c.AdaptiveMaxSamples = &adaptiveMaxSamples
+	}
+	if c.Progressive && c.AdaptiveThreshold != nil {
+		return fmt.Errorf("progressive rendering cannot be used with adaptive anti-aliasing")
+	}
+
+	if c.Filter != nil {
+		if err := c.Filter.initialize(); err != nil {
+			return err
+		}
+		if c.AdaptiveThreshold != nil {
+			return fmt.Errorf("reconstruction filters cannot be used with adaptive anti-aliasing")
+		}
+	}
+
+	if c.Bloom != nil {
+		if err := c.Bloom.initialize(); err != nil {
+			return err
+		}
+	}
+
+	if c.Vignette != nil {
+		if err := c.Vignette.initialize(); err != nil {
+			return err
+		}
+	}
+
+	if c.Denoise != nil {
+		if err := c.Denoise.initialize(); err != nil {
+			return err
+		}
+	}
+
+	if c.TileHeight != nil && *c.TileHeight < 1 {
+		return fmt.Errorf("tile height must be at least one")
+	}
+	if c.TileHeight != nil && (c.Progressive || c.Bloom != nil || c.Denoise != nil) {
+		return fmt.Errorf("tiled rendering cannot be used with progressive rendering, bloom or denoising")
+	}
+
+	if c.BitDepth != nil && *c.BitDepth != 8 && *c.BitDepth != 16 {
+		return fmt.Errorf("bit depth must be 8 or 16, got %d", *c.BitDepth)
+	}
+	if c.BitDepth == nil {
+		bitDepth := 8
+		c.BitDepth = &bitDepth
+	}
+
+	if !debugModes[c.DebugMode] {
+		return fmt.Errorf("unknown debug mode '%s'", c.DebugMode)
+	}
+	if c.DebugMaxDepth != nil && *c.DebugMaxDepth <= 0.0 {
+		return fmt.Errorf("debug max depth must be positive")
+	}
+	if c.DebugMaxDepth == nil {
+		debugMaxDepth := 20.0
+		c.DebugMaxDepth = &debugMaxDepth
+	}
+
 	// Logging would be useful to notify the user when defaults are used
 	if c.LightingModelName == "" {
 		c.lightingModel = raytracing.PhongLighting
@@ -143,96 +407,583 @@ func (c *Camera) UnmarshalJSON(b []byte) error {
 			c.lightingModel = raytracing.LambertianLighting
 		case "phong":
 			c.lightingModel = raytracing.PhongLighting
+		case "ward":
+			c.lightingModel = raytracing.WardLighting
+		case "oren-nayar":
+			c.lightingModel = raytracing.OrenNayarLighting
 		default:
 			c.lightingModel = raytracing.PhongLighting
 		}
 	}
 
-	var err error
-	c.Lens, err = CreateLens(b)
-	return err
+	return nil
 }
 
-// SetImageSize sets the width and height for rendered images
-func (c *Camera) SetImageSize(width int, height int) (err error) {
+// SetImageSize sets the width and height for rendered images. It may be called again to resize the
+// camera, which discards anything previously rendered and updates the lens to the new aspect ratio
+func (c *Camera) SetImageSize(width int, height int) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("image size must be positive, got %dx%d", width, height)
+	}
+
+	if c.Region != nil {
+		region := image.Rect(c.Region.X, c.Region.Y, c.Region.X+c.Region.Width, c.Region.Y+c.Region.Height)
+		if c.Region.Width <= 0 || c.Region.Height <= 0 || !region.In(image.Rect(0, 0, width, height)) {
+			return fmt.Errorf("render region must be non-empty and lie within the %dx%d image", width, height)
+		}
+	}
+
+	err := c.Lens.setAspectRatio(float64(width) / float64(height))
+	if err != nil {
+		return err
+	}
+
+	supersample := 1
+	if c.Supersample != nil {
+		supersample = *c.Supersample
+	}
+
 	c.imageWidth = width
 	c.imageHeight = height
+	c.renderWidth = width * supersample
+	c.renderHeight = height * supersample
+
+	if c.TileHeight != nil {
+		c.allocateWindow(0, supersample*minInt(*c.TileHeight, height))
+	} else {
+		c.allocateWindow(0, c.renderHeight)
+	}
+	return nil
+}
 
-	err = c.Lens.setAspectRatio(float64(width) / float64(height))
+// ImageSize returns the width and height of rendered images, which are zero until SetImageSize is called
+func (c *Camera) ImageSize() (int, int) {
+	return c.imageWidth, c.imageHeight
+}
+
+// allocateWindow allocates empty buffers holding height render rows starting from row y
+func (c *Camera) allocateWindow(y int, height int) {
+	c.windowY = y
+	c.windowHeight = height
+
+	c.accumulation = make([]raytracing.Color, c.renderWidth*height)
+	c.coverage = make([]float64, c.renderWidth*height)
+	c.depth = make([]float64, c.renderWidth*height)
+	c.objects = make([]int, c.renderWidth*height)
+	c.recorded = make([]int, c.renderWidth*height)
+	c.clearDepth()
+	c.passes = 0
+	c.sampledRays = 0
+}
+
+// clearDepth empties the depth and object buffers, which keep the nearest sample of every pass
+func (c *Camera) clearDepth() {
+	for i := range c.depth {
+		c.depth[i] = math.Inf(1)
+		c.objects[i] = noObject
+	}
+}
+
+// bufferIndex returns the index in the buffers of a render pixel, which must be within the window
+func (c *Camera) bufferIndex(pixelX int, pixelY int) int {
+	return (pixelY-c.windowY)*c.renderWidth + pixelX
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// SampleCount returns the average number of samples per image pixel accumulated so far, over every pass of
+// progressive rendering. Each of the render pixels of a supersampled image pixel is counted, and adaptive
+// anti-aliasing is counted by the rays it actually traced
+func (c *Camera) SampleCount() int {
+	if c.imageWidth == 0 {
+		return 0
+	}
+	bounds := c.renderBounds()
+	factor := c.renderWidth / c.imageWidth
+	pixels := bounds.Dx() * bounds.Dy() / (factor * factor)
+	if pixels == 0 {
+		return 0
+	}
+	return int(math.Round(float64(c.sampledRays) / float64(pixels)))
+}
+
+// Save encodes the internal image into a png file of the camera's bit depth and writes to w
+func (c *Camera) Save(w io.Writer) error {
+	var img image.Image
+	var err error
+	if *c.BitDepth == 16 {
+		img, err = c.Image16()
+	} else {
+		img, err = c.Image()
+	}
 	if err != nil {
 		return err
 	}
+	return png.Encode(w, img)
+}
 
-	c.output = image.NewRGBA(image.Rect(0, 0, c.imageWidth, c.imageHeight))
-	return
+// Image returns the rendered image as 8 bit color, with coverage as alpha
+func (c *Camera) Image() (*image.RGBA, error) {
+	hdr, alpha, err := c.finalImage()
+	if err != nil {
+		return nil, err
+	}
+	return c.quantize(hdr, alpha), nil
 }
 
-// Save encodes the internal image into a png file and writes to w
-func (c *Camera) Save(w io.Writer) error {
-	if c.output == nil {
-		return fmt.Errorf("image must be rendered before saving it")
+// Image16 returns the rendered image as 16 bit color, with coverage as alpha, which shows less
+// banding in smooth gradients than Image
+func (c *Camera) Image16() (*image.NRGBA64, error) {
+	hdr, alpha, err := c.finalImage()
+	if err != nil {
+		return nil, err
+	}
+	return c.quantize16(hdr, alpha), nil
+}
+
+// finalImage returns the high dynamic range image and coverage of the image size, once rendered
+func (c *Camera) finalImage() ([]raytracing.Color, []float64, error) {
+	if c.passes == 0 {
+		return nil, nil, fmt.Errorf("image must be rendered before saving it")
+	}
+	if c.tiled() {
+		return nil, nil, fmt.Errorf("tiled images are saved while rendering, using RenderTiled")
+	}
+	hdr, alpha := c.downsample()
+	return hdr, alpha, nil
+}
+
+// MissedObject is the value stored in the object mask for pixels where every ray missed
+const MissedObject = math.MaxUint16
+
+// SaveObjectMask encodes the index of the closest object hit in each pixel into a 16 bit grayscale PNG
+// and writes to w. Pixels where every ray missed are stored as MissedObject. RecordObjects must be set before rendering
+func (c *Camera) SaveObjectMask(w io.Writer) error {
+	if c.passes == 0 || !c.RecordObjects {
+		return fmt.Errorf("objects must be recorded while rendering before saving the mask")
+	}
+	if c.tiled() {
+		return fmt.Errorf("object masks cannot be saved from tiled renders")
+	}
+
+	factor := c.renderWidth / c.imageWidth
+
+	img := image.NewGray16(image.Rect(0, 0, c.imageWidth, c.imageHeight))
+	for pixelY := 0; pixelY < c.imageHeight; pixelY++ {
+		for pixelX := 0; pixelX < c.imageWidth; pixelX++ {
+			depth := math.Inf(1)
+			object := noObject
+			for i := 0; i < factor; i++ {
+				for j := 0; j < factor; j++ {
+					index := c.bufferIndex(pixelX*factor+i, pixelY*factor+j)
+					if c.depth[index] < depth {
+						depth = c.depth[index]
+						object = c.objects[index]
+					}
+				}
+			}
+
+			value := uint16(MissedObject)
+			if object != noObject && object < MissedObject {
+				value = uint16(object)
+			}
+			img.SetGray16(pixelX, pixelY, color.Gray16{Y: value})
+		}
 	}
-	return png.Encode(w, c.output)
+
+	return png.Encode(w, img)
 }
 
-// Render creates a rendering of the Scene from the view of the Camera, use Save to save that image
+// downsample box filters the high dynamic range image and coverage from the render size down to the image size,
+// then applies denoising, bloom and vignetting if enabled. When tiled, only the image rows of the current window are returned
+func (c *Camera) downsample() ([]raytracing.Color, []float64) {
+	factor := c.renderWidth / c.imageWidth
+
+	firstRow := c.windowY / factor
+	rows := c.windowHeight / factor
+
+	downsampled := make([]raytracing.Color, c.imageWidth*rows)
+	alpha := make([]float64, c.imageWidth*rows)
+	depth := make([]float64, c.imageWidth*rows)
+	for pixelY := firstRow; pixelY < firstRow+rows; pixelY++ {
+		for pixelX := 0; pixelX < c.imageWidth; pixelX++ {
+			var samples []raytracing.Color
+			coverage := 0.0
+			closest := math.Inf(1)
+			for i := 0; i < factor; i++ {
+				for j := 0; j < factor; j++ {
+					index := c.bufferIndex(pixelX*factor+i, pixelY*factor+j)
+					// Each pixel is averaged over the passes which reached it, so pixels a cancelled pass
+					// didn't reach aren't darkened, and pixels no pass reached stay black and transparent
+					passes := float64(c.recorded[index])
+					if passes == 0 {
+						samples = append(samples, raytracing.Color{})
+					} else {
+						samples = append(samples, c.accumulation[index].Scale(1.0/passes))
+						coverage += c.coverage[index] / passes
+					}
+					closest = math.Min(closest, c.depth[index])
+				}
+			}
+
+			index := (pixelY-firstRow)*c.imageWidth + pixelX
+			downsampled[index] = raytracing.AverageColors(samples)
+			alpha[index] = coverage / float64(len(samples))
+			depth[index] = closest
+		}
+	}
+
+	if c.Denoise != nil {
+		downsampled = c.Denoise.apply(downsampled, depth, c.imageWidth, rows)
+	}
+
+	if c.Bloom != nil {
+		downsampled = c.Bloom.apply(downsampled, c.imageWidth, rows)
+	}
+	if c.Vignette != nil {
+		downsampled = c.Vignette.apply(downsampled, c.imageWidth, c.imageHeight, firstRow)
+	}
+
+	return downsampled, alpha
+}
+
+// quantize converts a high dynamic range image of the image size to 8 bit color, using coverage as alpha.
+// Pixels outside of the render region are left transparent
+func (c *Camera) quantize(hdr []raytracing.Color, alpha []float64) *image.RGBA {
+	bounds := image.Rect(0, 0, c.imageWidth, c.imageHeight)
+	if c.Region != nil {
+		bounds = image.Rect(c.Region.X, c.Region.Y, c.Region.X+c.Region.Width, c.Region.Y+c.Region.Height)
+	}
+
+	output := image.NewRGBA(image.Rect(0, 0, c.imageWidth, c.imageHeight))
+	for pixelY := bounds.Min.Y; pixelY < bounds.Max.Y; pixelY++ {
+		for pixelX := bounds.Min.X; pixelX < bounds.Max.X; pixelX++ {
+			index := pixelY*c.imageWidth + pixelX
+			output.SetRGBA(pixelX, pixelY, quantizePixel(hdr[index], alpha[index]))
+		}
+	}
+
+	return output
+}
+
+// quantize16 converts a high dynamic range image of the image size to 16 bit color, using coverage as alpha.
+// Pixels outside of the render region are left transparent
+func (c *Camera) quantize16(hdr []raytracing.Color, alpha []float64) *image.NRGBA64 {
+	bounds := image.Rect(0, 0, c.imageWidth, c.imageHeight)
+	if c.Region != nil {
+		bounds = image.Rect(c.Region.X, c.Region.Y, c.Region.X+c.Region.Width, c.Region.Y+c.Region.Height)
+	}
+
+	output := image.NewNRGBA64(image.Rect(0, 0, c.imageWidth, c.imageHeight))
+	for pixelY := bounds.Min.Y; pixelY < bounds.Max.Y; pixelY++ {
+		for pixelX := bounds.Min.X; pixelX < bounds.Max.X; pixelX++ {
+			index := pixelY*c.imageWidth + pixelX
+			output.SetNRGBA64(pixelX, pixelY, quantizePixel16(hdr[index], alpha[index]))
+		}
+	}
+
+	return output
+}
+
+// quantizePixel converts a high dynamic range color to 8 bit color, using coverage as alpha
+func quantizePixel(pixelColor raytracing.Color, coverage float64) color.RGBA {
+	// Degenerate geometry can produce NaN or negative channels, which can't be converted to bytes
+	pixelColor = pixelColor.SanitizeNaN().Clamp(0.0, 1.0)
+	if math.IsNaN(coverage) {
+		coverage = 0.0
+	}
+
+	// Colors of missed rays are black, so colors are already premultiplied by coverage,
+	// but shouldn't be brighter than the alpha
+	opacity := math.Max(0.0, math.Min(coverage, 1.0)) * 255.0
+	red := math.Min(pixelColor.Red*255.0, opacity)
+	green := math.Min(pixelColor.Green*255.0, opacity)
+	blue := math.Min(pixelColor.Blue*255.0, opacity)
+
+	return color.RGBA{uint8(red), uint8(green), uint8(blue), uint8(opacity)}
+}
+
+// quantizePixel16 converts a high dynamic range color to 16 bit color, using coverage as alpha. NRGBA64
+// colors aren't premultiplied, so colors are divided by the coverage
+func quantizePixel16(pixelColor raytracing.Color, coverage float64) color.NRGBA64 {
+	pixelColor = pixelColor.SanitizeNaN()
+	if math.IsNaN(coverage) {
+		coverage = 0.0
+	}
+
+	opacity := math.Max(0.0, math.Min(coverage, 1.0))
+	if opacity <= 0.0 {
+		return color.NRGBA64{}
+	}
+	pixelColor = pixelColor.Scale(1.0/opacity).Clamp(0.0, 1.0)
+
+	return color.NRGBA64{
+		R: uint16(pixelColor.Red * 65535.0),
+		G: uint16(pixelColor.Green * 65535.0),
+		B: uint16(pixelColor.Blue * 65535.0),
+		A: uint16(opacity * 65535.0),
+	}
+}
+
+// Render creates a rendering of the Scene from the view of the Camera, use Save to save that image.
+// With progressive rendering, each call adds another jittered pass of samples to the image. Pixels are
+// traced concurrently, each goroutine counting its rays separately before adding them to the totals
+// atomically. The scene is only read, so several cameras may render it at once, but each Camera must
+// only render one image at a time
 func (c *Camera) Render(s *scene.Scene, maxRayReflections int, threads int) error {
-	if c.output == nil {
+	return c.RenderContext(context.Background(), s, maxRayReflections, threads)
+}
+
+// RenderContext is Render, but stops early and returns ctx.Err() if ctx is cancelled. Cancellation is
+// checked between rows and before each pixel, and all workers have stopped by the time it returns.
+// Pixels which weren't rendered are left black
+func (c *Camera) RenderContext(ctx context.Context, s *scene.Scene, maxRayReflections int, threads int) error {
+	if c.imageWidth == 0 {
 		return fmt.Errorf("camera cannot perform render until image size is set (using SetImageSize)")
 	}
 
+	start := time.Now()
+	maxRayReflections, c.maxRefractions = s.DepthLimits(maxRayReflections)
+	c.primaryRays = 0
+	c.secondary = scene.RayCounts{}
+
 	var wg sync.WaitGroup
 
 	sema := make(semaphore, threads)
 
 	antiAliasingIncrement := 1.0 / float64(*c.AntiAliasingFactor)
 
-	for pixelY := 0; pixelY < c.imageHeight; pixelY++ {
-		for pixelX := 0; pixelX < c.imageWidth; pixelX++ {
+	var jitterX, jitterY float64
+	if c.Progressive {
+		if c.passes > 0 {
+			rng := rand.New(rand.NewSource(int64(c.passes)))
+			jitterX = rng.Float64() * antiAliasingIncrement
+			jitterY = rng.Float64() * antiAliasingIncrement
+		}
+		c.passes++
+	} else {
+		// Each render replaces the previous image, such as the last frame of an animation
+		c.clearDepth()
+		for i := range c.recorded {
+			c.recorded[i] = 0
+		}
+		c.passes = 1
+		c.sampledRays = 0
+	}
+
+	var weights []float64
+	if c.Filter != nil {
+		weights = c.Filter.weights(*c.AntiAliasingFactor)
+	}
+
+	bounds := c.renderBounds()
+
+	for pixelY := bounds.Min.Y; pixelY < bounds.Max.Y && ctx.Err() == nil; pixelY++ {
+		for pixelX := bounds.Min.X; pixelX < bounds.Max.X; pixelX++ {
+			wg.Add(1)
+			if c.AdaptiveThreshold != nil {
+				go c.renderAdaptive(ctx, s, pixelX, pixelY, maxRayReflections, &wg, sema)
+				continue
+			}
+
 			var rays []raytracing.Ray
 			for i := 0; i < *c.AntiAliasingFactor; i++ {
 				for j := 0; j < *c.AntiAliasingFactor; j++ {
-					pixelX := (float64(pixelX) + float64(i)*antiAliasingIncrement) / float64(c.imageWidth)
-					pixelY := (float64(pixelY) + float64(j)*antiAliasingIncrement) / float64(c.imageHeight)
-					screenX := 2.0*(pixelX) - 1.0
-					screenY := -2.0*(pixelY) + 1.0
-					ray := c.generateLightRay(screenX, screenY, c.Scope)
-					rays = append(rays, ray)
+					x := float64(pixelX) + float64(i)*antiAliasingIncrement + jitterX
+					y := float64(pixelY) + float64(j)*antiAliasingIncrement + jitterY
+					rays = append(rays, c.primaryRay(x, y))
 				}
 			}
-			wg.Add(1)
-			go c.renderRays(s, rays, pixelX, pixelY, maxRayReflections, &wg, sema)
+			go c.renderRays(ctx, s, rays, weights, pixelX, pixelY, maxRayReflections, &wg, sema)
 		}
 	}
 
 	wg.Wait()
+	c.sampledRays += c.primaryRays
 
-	return nil
+	c.stats = RenderStats{
+		PrimaryRays: c.primaryRays,
+		Secondary:   c.secondary,
+		Duration:    time.Since(start),
+	}
+
+	return ctx.Err()
+}
+
+// Stats returns statistics about the most recent render
+func (c *Camera) Stats() RenderStats {
+	return c.stats
 }
 
-// renderRay traces given starting rays through the scene and records the result. If a non-nil
-// WaitGroup is passed in, Done will be called on it once the ray tracing is complete.
-// This is threadsafe and can be executed in a goroutine.
-func (c *Camera) renderRays(s *scene.Scene, rays []raytracing.Ray, pixelX int, pixelY int, maxRayReflections int, wg *sync.WaitGroup, sema semaphore) {
+// renderBounds returns the area of the internal image to render, in render pixel coordinates, limited
+// to the rows held in the buffers. Pixels outside of the render region are left transparent
+func (c *Camera) renderBounds() image.Rectangle {
+	window := image.Rect(0, c.windowY, c.renderWidth, c.windowY+c.windowHeight)
+	if c.Region == nil {
+		return window
+	}
+
+	factor := c.renderWidth / c.imageWidth
+	min := image.Pt(c.Region.X, c.Region.Y).Mul(factor)
+	max := image.Pt(c.Region.X+c.Region.Width, c.Region.Y+c.Region.Height).Mul(factor)
+	return image.Rectangle{Min: min, Max: max}.Intersect(window)
+}
+
+// renderRay traces given starting rays through the scene and records the result, combining their samples
+// with the given weights, or equally if nil. If a non-nil WaitGroup is passed in, Done will be called on it
+// once the ray tracing is complete.
+// Nothing is rendered once ctx is cancelled. This is threadsafe and can be executed in a goroutine.
+func (c *Camera) renderRays(ctx context.Context, s *scene.Scene, rays []raytracing.Ray, weights []float64, pixelX int, pixelY int, maxRayReflections int, wg *sync.WaitGroup, sema semaphore) {
 	if wg != nil {
 		defer wg.Done()
 	}
 
 	sema <- empty{}
+	defer func() { <-sema }()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	var samples []sample
+	var counts scene.RayCounts
+
+	if c.DebugMode == "" && len(rays) > 1 {
+		samples = c.tracePacket(s, rays, maxRayReflections, &counts)
+	} else {
+		for _, ray := range rays {
+			samples = append(samples, c.traceSample(s, ray, maxRayReflections, &counts))
+		}
+	}
+
+	c.recordPixel(pixelX, pixelY, combineSamples(samples, weights))
+	c.addCounts(counts)
+}
+
+// addCounts adds the secondary rays counted by a worker to the totals of the render. Workers count into their
+// own RayCounts and only add them once finished, so they don't contend over the totals for every ray
+func (c *Camera) addCounts(counts scene.RayCounts) {
+	atomic.AddInt64(&c.secondary.Shadow, counts.Shadow)
+	atomic.AddInt64(&c.secondary.Reflected, counts.Reflected)
+	atomic.AddInt64(&c.secondary.Refracted, counts.Refracted)
+	atomic.AddInt64(&c.secondary.Diffuse, counts.Diffuse)
+	atomic.AddInt64(&c.secondary.Depth, counts.Depth)
+}
+
+// sample is the result of tracing one or more primary rays
+type sample struct {
+	color raytracing.Color
+	// coverage is the fraction of the rays which hit geometry, or 1.0 unless the background is transparent
+	coverage float64
+	// depth is the distance to the closest hit, which is infinite if neither depth nor objects are recorded
+	depth float64
+	// object is the index of the closest object hit, or noObject
+	object int
+}
 
-	var colors []raytracing.Color
+// noObject is the object index of samples which didn't hit any object
+const noObject = -1
+
+// combineSamples averages the color and coverage of samples with the given weights, or equally if nil,
+// and finds their closest depth
+func combineSamples(samples []sample, weights []float64) sample {
+	combined := sample{depth: math.Inf(1), object: noObject}
+	total := 0.0
+	for i, sample := range samples {
+		weight := 1.0
+		if weights != nil {
+			weight = weights[i]
+		}
+		combined.color = combined.color.Add(sample.color.Scale(weight))
+		combined.coverage += sample.coverage * weight
+		total += weight
 
-	for _, ray := range rays {
-		colors = append(colors, s.TraceRay(ray, 1.0, maxRayReflections, c.lightingModel))
+		if sample.depth < combined.depth {
+			combined.depth = sample.depth
+			combined.object = sample.object
+		}
 	}
 
-	pixelColor := raytracing.AverageColors(colors)
+	combined.color = combined.color.Scale(1.0 / total)
+	combined.coverage /= total
+	return combined
+}
+
+// traceSample traces a primary ray through the scene and returns the sample it produces, counting secondary rays in counts
+func (c *Camera) traceSample(s *scene.Scene, ray raytracing.Ray, maxRayReflections int, counts *scene.RayCounts) sample {
+	atomic.AddInt64(&c.primaryRays, 1)
 
-	red := math.Min(pixelColor.Red*255.0, 255.0)
-	green := math.Min(pixelColor.Green*255.0, 255.0)
-	blue := math.Min(pixelColor.Blue*255.0, 255.0)
+	result := sample{coverage: 1.0, depth: math.Inf(1), object: noObject}
+	if c.TransparentBackground || c.RecordDepth || c.RecordObjects || c.Denoise != nil {
+		result = c.hitSample(s.FindIntersection(ray))
+	}
 
-	c.output.Set(pixelX, pixelY, color.RGBA{uint8(red), uint8(green), uint8(blue), 255.0})
+	if c.DebugMode != "" {
+		result.color = c.debugColor(s, ray)
+	} else {
+		result.color = s.TraceRay(ray, 1.0, maxRayReflections, c.maxRefractions, c.lightingModel, counts)
+	}
+	return result
+}
+
+// tracePacket traces a packet of primary rays through the scene, finding their first intersections together.
+// Secondary rays are counted in counts
+func (c *Camera) tracePacket(s *scene.Scene, rays []raytracing.Ray, maxRayReflections int, counts *scene.RayCounts) []sample {
+	atomic.AddInt64(&c.primaryRays, int64(len(rays)))
+
+	intersected, hits, objects := s.FindIntersections(rays)
+
+	samples := make([]sample, len(rays))
+	for i, ray := range rays {
+		samples[i] = c.hitSample(intersected[i], hits[i], objects[i])
+		samples[i].color = s.TraceHit(ray, intersected[i], hits[i], objects[i], 1.0, maxRayReflections, c.maxRefractions, c.lightingModel, counts)
+	}
+	return samples
+}
+
+// hitSample returns the coverage, depth and object of a sample from the first intersection of its ray
+func (c *Camera) hitSample(intersected bool, hit object.HitInfo, obj int) sample {
+	result := sample{coverage: 1.0, depth: math.Inf(1), object: noObject}
+	if !intersected && c.TransparentBackground {
+		result.coverage = 0.0
+	}
+	if intersected {
+		result.depth = hit.Distance
+		result.object = obj
+	}
+	return result
+}
+
+// primaryRay creates a light ray from the lens through the point (pixelX, pixelY) in render pixel coordinates
+func (c *Camera) primaryRay(pixelX float64, pixelY float64) raytracing.Ray {
+	screenX := 2.0*(pixelX/float64(c.renderWidth)) - 1.0
+	screenY := -2.0*(pixelY/float64(c.renderHeight)) + 1.0
+	ray := c.generateLightRay(screenX, screenY, c.Scope)
+	ray.Kind = raytracing.CameraRay
+	return ray
+}
+
+// recordPixel records the sample for a pixel from the current pass in the high dynamic range image,
+// adding it to previous passes when rendering progressively
+func (c *Camera) recordPixel(pixelX int, pixelY int, pixel sample) {
+	index := c.bufferIndex(pixelX, pixelY)
+	if pixel.depth < c.depth[index] {
+		c.depth[index] = pixel.depth
+		c.objects[index] = pixel.object
+	}
+	if !c.Progressive {
+		c.accumulation[index] = pixel.color
+		c.coverage[index] = pixel.coverage
+		c.recorded[index] = 1
+		return
+	}
 
-	<-sema
+	c.recorded[index]++
+	c.coverage[index] += pixel.coverage
+	c.accumulation[index] = c.accumulation[index].Add(pixel.color)
 }
@@ -0,0 +1,405 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/brendanburkhart/raytracer/internal/scene"
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+// scenesDirectory holds the example scenes bundled with the repository
+const scenesDirectory = "../../scenes"
+
+// update rewrites the golden images from the current renders instead of comparing against them
+var update = flag.Bool("update", false, "rewrite golden images")
+
+// loadBundledScene reads and initializes one of the bundled example scenes, and sets the camera's image size
+func loadBundledScene(t testing.TB, name string) (*Camera, *scene.Scene) {
+	t.Helper()
+	return loadSceneFile(t, filepath.Join(scenesDirectory, name))
+}
+
+// loadSceneFile reads and initializes a scene file, and sets the camera's image size
+func loadSceneFile(t testing.TB, path string) (*Camera, *scene.Scene) {
+	t.Helper()
+	input, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Base(path)
+
+	data := struct {
+		Width  int         `json:"width"`
+		Height int         `json:"height"`
+		Camera Camera      `json:"camera"`
+		Scene  scene.Scene `json:"scene"`
+	}{}
+	if err = json.Unmarshal(input, &data); err != nil {
+		t.Fatalf("couldn't unmarshal %s: %v", name, err)
+	}
+
+	data.Scene.Directory = filepath.Dir(path)
+	if err = data.Scene.Initialize(); err != nil {
+		t.Fatalf("couldn't initialize %s: %v", name, err)
+	}
+	if err = data.Camera.SetImageSize(data.Width, data.Height); err != nil {
+		t.Fatal(err)
+	}
+	return &data.Camera, &data.Scene
+}
+
+// render renders the scene with the camera into an image
+func render(t *testing.T, c *Camera, s *scene.Scene, threads int) *image.RGBA {
+	t.Helper()
+	if err := c.Render(s, 15, threads); err != nil {
+		t.Fatal(err)
+	}
+	img, err := c.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+// TestConcurrentRender renders bundled scenes with far more goroutines than pixels per row, and should be
+// run with go test -race to detect data races on the scene and camera shared between them
+func TestConcurrentRender(t *testing.T) {
+	for _, name := range []string{"sphere-on-plane.json", "facing-mirrors.json", "terrain.json"} {
+		t.Run(name, func(t *testing.T) {
+			c, s := loadBundledScene(t, name)
+			concurrent := render(t, c, s, 2048)
+			serial := render(t, c, s, 1)
+			if !bytes.Equal(concurrent.Pix, serial.Pix) {
+				t.Errorf("image rendered with 2048 threads differs from the image rendered with 1 thread")
+			}
+		})
+	}
+}
+
+// TestGoldenImages renders scenes and compares them against golden images in testdata, so changes to how
+// lighting is computed which should leave the output unchanged can be checked. Run with -update to rewrite
+// the golden images after an intended change to the output
+func TestGoldenImages(t *testing.T) {
+	scenes := []string{
+		filepath.Join(scenesDirectory, "sphere-on-plane.json"),
+		filepath.Join("testdata", "two-lights.json"),
+	}
+	for _, path := range scenes {
+		name := filepath.Base(path)
+		t.Run(name, func(t *testing.T) {
+			c, s := loadSceneFile(t, path)
+			img := render(t, c, s, 64)
+
+			golden := filepath.Join("testdata", name[:len(name)-len(filepath.Ext(name))]+".golden.png")
+			if *update {
+				var buffer bytes.Buffer
+				if err := png.Encode(&buffer, img); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(golden, buffer.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			file, err := os.Open(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			decoded, err := png.Decode(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := image.NewRGBA(decoded.Bounds())
+			draw.Draw(want, want.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+
+			if want.Bounds() != img.Bounds() {
+				t.Fatalf("image is %v, golden image is %v", img.Bounds(), want.Bounds())
+			}
+			// Platforms which fuse multiplies and adds round slightly differently, so channels may differ by one
+			differing := 0
+			for i := range img.Pix {
+				if difference := int(img.Pix[i]) - int(want.Pix[i]); difference > 1 || difference < -1 {
+					differing++
+				}
+			}
+			if differing > 0 {
+				t.Errorf("%d channels differ from %s, run with -update if the change is intended", differing, golden)
+			}
+		})
+	}
+}
+
+func TestScopeWithoutOrientation(t *testing.T) {
+	right := raytracing.Vector{X: 1, Y: 0, Z: 0}
+	up := raytracing.Vector{X: 0, Y: 1, Z: 0}
+
+	scopes := map[string]Scope{
+		"no orientation":   {Position: raytracing.Vector{X: 0, Y: 1, Z: -5}},
+		"partial basis":    {Right: &right, Up: &up},
+		"only roll is set": {Roll: 30},
+	}
+	for name, scope := range scopes {
+		err := scope.Initialize()
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+			continue
+		}
+		if !strings.Contains(err.Error(), "camera orientation requires") {
+			t.Errorf("%s: unexpected error %q", name, err)
+		}
+	}
+}
+
+func TestCameraWithoutOrientation(t *testing.T) {
+	var c Camera
+	err := json.Unmarshal([]byte(`{"position": {"x": 0, "y": 1, "z": -5}, "projection": "perspective", "hfov": 60, "focalLength": 1}`), &c)
+	if err == nil || !strings.Contains(err.Error(), "camera orientation requires") {
+		t.Errorf("unmarshalling a camera without an orientation returned %v", err)
+	}
+}
+
+// checkOrthonormal reports an error if the basis of an initialized scope isn't orthonormal
+func checkOrthonormal(t *testing.T, name string, s Scope) {
+	t.Helper()
+	right, up, forward := s.GetRight(), s.GetUp(), s.GetForward()
+	for _, v := range []raytracing.Vector{right, up, forward} {
+		if math.Abs(v.Magnitude()-1.0) > 1e-9 {
+			t.Errorf("%s: basis vector %v isn't normalized", name, v)
+		}
+	}
+	if math.Abs(right.Dot(up)) > 1e-9 || math.Abs(right.Dot(forward)) > 1e-9 || math.Abs(up.Dot(forward)) > 1e-9 {
+		t.Errorf("%s: basis right %v, up %v, forward %v isn't orthogonal", name, right, up, forward)
+	}
+}
+
+func TestScopeSkewedBasis(t *testing.T) {
+	// Up leans 30 degrees towards forward, and right leans towards up
+	right := raytracing.Vector{X: 2, Y: 0.5, Z: 0}
+	up := raytracing.Vector{X: 0, Y: math.Cos(math.Pi / 6.0), Z: math.Sin(math.Pi / 6.0)}
+	forward := raytracing.Vector{X: 0, Y: 0, Z: 3}
+	s := Scope{Right: &right, Up: &up, Forward: &forward}
+	if err := s.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkOrthonormal(t, "skewed basis", s)
+	if len(s.Warnings) != 1 {
+		t.Errorf("expected one warning about the skewed basis, got %v", s.Warnings)
+	}
+
+	// Forward keeps its direction, and up and right stay on the sides they pointed to
+	if got := s.GetForward(); !vectorsClose(got, raytracing.Vector{X: 0, Y: 0, Z: 1}) {
+		t.Errorf("forward is %v, want the +z axis", got)
+	}
+	if got := s.GetUp(); !vectorsClose(got, raytracing.Vector{X: 0, Y: 1, Z: 0}) {
+		t.Errorf("up is %v, want the +y axis", got)
+	}
+	if got := s.GetRight(); !vectorsClose(got, raytracing.Vector{X: 1, Y: 0, Z: 0}) {
+		t.Errorf("right is %v, want the +x axis", got)
+	}
+
+	// A basis which is already orthogonal is only normalized, without warnings
+	right, up, forward = raytracing.Vector{X: 2, Y: 0, Z: 0}, raytracing.Vector{X: 0, Y: 3, Z: 0}, raytracing.Vector{X: 0, Y: 0, Z: 4}
+	s = Scope{Right: &right, Up: &up, Forward: &forward}
+	if err := s.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	checkOrthonormal(t, "orthogonal basis", s)
+	if len(s.Warnings) != 0 {
+		t.Errorf("expected no warnings for an orthogonal basis, got %v", s.Warnings)
+	}
+
+	// Vectors which can't be made into a basis are errors
+	parallel := raytracing.Vector{X: 0, Y: 0, Z: -1}
+	s = Scope{Right: &right, Up: &parallel, Forward: &forward}
+	if err := s.Initialize(); err == nil {
+		t.Errorf("expected an error for up parallel to forward")
+	}
+}
+
+func TestScopeAnglesMatchTarget(t *testing.T) {
+	position := raytracing.Vector{X: 1, Y: 2, Z: -3}
+	tests := []struct {
+		yaw, pitch, roll float64
+	}{
+		{0, 0, 0},
+		{90, 0, 0},
+		{-45, 0, 0},
+		{180, 0, 0},
+		{30, 20, 0},
+		{-120, -60, 0},
+		{60, 10, 25},
+	}
+
+	for _, test := range tests {
+		yaw, pitch := test.yaw*math.Pi/180.0, test.pitch*math.Pi/180.0
+		// Yaw turns the camera from the +z axis towards its right, which is -x, and pitch tilts it up
+		direction := raytracing.Vector{X: -math.Sin(yaw) * math.Cos(pitch), Y: math.Sin(pitch), Z: math.Cos(yaw) * math.Cos(pitch)}
+		target := position.Add(direction.Scale(4.0))
+
+		targeted := Scope{Position: position, Target: &target, Roll: test.roll}
+		angled := Scope{Position: position, Yaw: &test.yaw, Pitch: &test.pitch, Roll: test.roll}
+		if err := targeted.Initialize(); err != nil {
+			t.Fatal(err)
+		}
+		if err := angled.Initialize(); err != nil {
+			t.Fatal(err)
+		}
+
+		checkOrthonormal(t, "angles", angled)
+		if !vectorsClose(angled.GetForward(), targeted.GetForward()) ||
+			!vectorsClose(angled.GetUp(), targeted.GetUp()) ||
+			!vectorsClose(angled.GetRight(), targeted.GetRight()) {
+			t.Errorf("yaw %v, pitch %v, roll %v: basis right %v, up %v, forward %v, want right %v, up %v, forward %v",
+				test.yaw, test.pitch, test.roll,
+				angled.GetRight(), angled.GetUp(), angled.GetForward(),
+				targeted.GetRight(), targeted.GetUp(), targeted.GetForward())
+		}
+	}
+
+	yaw := 10.0
+	target := raytracing.Vector{X: 0, Y: 0, Z: 0}
+	s := Scope{Position: position, Target: &target, Yaw: &yaw}
+	if err := s.Initialize(); err == nil {
+		t.Errorf("expected an error for a scope with both a target and angles")
+	}
+}
+
+// Converting NaN or negative floats to integers is implementation-defined, so on some platforms they may
+// come out as zero anyway, but they must come out as zero on all of them
+func TestQuantizeDegenerateColors(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name     string
+		color    raytracing.Color
+		coverage float64
+		want     color.RGBA
+		want16   color.NRGBA64
+	}{
+		{"NaN channels", raytracing.Color{Red: nan, Green: 0.5, Blue: nan}, 1, color.RGBA{0, 127, 0, 255}, color.NRGBA64{0, 32767, 0, 65535}},
+		{"negative channels", raytracing.Color{Red: -1, Green: -0.5, Blue: 1}, 1, color.RGBA{0, 0, 255, 255}, color.NRGBA64{0, 0, 65535, 65535}},
+		{"bright channels", raytracing.Color{Red: 2, Green: math.Inf(1), Blue: 0.5}, 1, color.RGBA{255, 255, 127, 255}, color.NRGBA64{65535, 65535, 32767, 65535}},
+		{"NaN coverage", raytracing.Color{Red: 0.5, Green: 0.5, Blue: 0.5}, nan, color.RGBA{}, color.NRGBA64{}},
+		{"negative coverage", raytracing.Color{Red: 0.5, Green: 0.5, Blue: 0.5}, -1, color.RGBA{}, color.NRGBA64{}},
+		{"partial coverage", raytracing.Color{Red: 1, Green: 0.25, Blue: nan}, 0.5, color.RGBA{127, 63, 0, 127}, color.NRGBA64{65535, 32767, 0, 32767}},
+	}
+	for _, test := range tests {
+		if got := quantizePixel(test.color, test.coverage); got != test.want {
+			t.Errorf("%s: quantizePixel = %v, want %v", test.name, got, test.want)
+		}
+		if got := quantizePixel16(test.color, test.coverage); got != test.want16 {
+			t.Errorf("%s: quantizePixel16 = %v, want %v", test.name, got, test.want16)
+		}
+	}
+}
+
+func TestImageWithDegenerateColors(t *testing.T) {
+	var c Camera
+	err := json.Unmarshal([]byte(`{
+		"position": {"x": 0, "y": 0, "z": 0},
+		"target": {"x": 0, "y": 0, "z": 1},
+		"projection": "perspective", "hfov": 60, "focalLength": 1
+	}`), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.SetImageSize(2, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pretend a pass was rendered whose pixels came out NaN and negative
+	nan := math.NaN()
+	c.accumulation[0] = raytracing.Color{Red: nan, Green: nan, Blue: nan}
+	c.accumulation[1] = raytracing.Color{Red: -1, Green: 0.5, Blue: nan}
+	c.coverage[0], c.coverage[1] = 1, 1
+	c.recorded[0], c.recorded[1] = 1, 1
+	c.passes = 1
+
+	img, err := c.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := img.RGBAAt(0, 0), (color.RGBA{0, 0, 0, 255}); got != want {
+		t.Errorf("NaN pixel is %v, want %v", got, want)
+	}
+	if got, want := img.RGBAAt(1, 0), (color.RGBA{0, 127, 0, 255}); got != want {
+		t.Errorf("negative pixel is %v, want %v", got, want)
+	}
+
+	img16, err := c.Image16()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := img16.NRGBA64At(0, 0), (color.NRGBA64{0, 0, 0, 65535}); got != want {
+		t.Errorf("NaN pixel is %v, want %v", got, want)
+	}
+	if got, want := img16.NRGBA64At(1, 0), (color.NRGBA64{0, 32767, 0, 65535}); got != want {
+		t.Errorf("negative pixel is %v, want %v", got, want)
+	}
+}
+
+// cancelAfter is a context which is cancelled once Err has been called a number of times, so a render can
+// be cancelled partway through a pass
+type cancelAfter struct {
+	context.Context
+	calls int64
+}
+
+func (ctx *cancelAfter) Err() error {
+	if atomic.AddInt64(&ctx.calls, -1) < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestCancelledPassIsNotDarkened(t *testing.T) {
+	c, s := loadBundledScene(t, "sphere-on-plane.json")
+	c.Progressive = true
+	if err := c.SetImageSize(32, 24); err != nil {
+		t.Fatal(err)
+	}
+	first := render(t, c, s, 1)
+
+	// The second pass is cancelled about halfway through the image
+	ctx := &cancelAfter{Context: context.Background(), calls: 32 * 24 / 2}
+	if err := c.RenderContext(ctx, s, 15, 1); err != context.Canceled {
+		t.Fatalf("cancelled render returned %v", err)
+	}
+	partial, err := c.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reached, unreached := 0, 0
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 32; x++ {
+			if c.recorded[c.bufferIndex(x, y)] == 2 {
+				reached++
+				continue
+			}
+			unreached++
+			// Pixels the cancelled pass didn't reach still hold only the first pass, at full brightness
+			if got, want := partial.RGBAAt(x, y), first.RGBAAt(x, y); got != want {
+				t.Errorf("pixel (%d, %d) not reached by the cancelled pass is %v, want %v", x, y, got, want)
+			}
+		}
+	}
+	if reached == 0 || unreached == 0 {
+		t.Errorf("cancelled pass reached %d pixels and missed %d, want it cancelled partway", reached, unreached)
+	}
+}
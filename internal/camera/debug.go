@@ -0,0 +1,51 @@
+package camera
+
+import (
+	"math"
+
+	"github.com/brendanburkhart/raytracer/internal/scene"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+// debugModes are the valid values of Camera.DebugMode
+var debugModes = map[string]bool{
+	"":        true,
+	"direct":  true,
+	"normals": true,
+	"depth":   true,
+	"uv":      true,
+}
+
+// debugColor returns the color of a primary ray for the camera's debug mode:
+//   - "direct" shades surfaces with direct lighting only, without reflections
+//   - "normals" maps each component of the surface normal from -1.0..1.0 to red, green and blue
+//   - "depth" is white at the camera, fading to black at DebugMaxDepth
+//   - "uv" shows the surface coordinates of the hit as red and green, barycentric for triangles
+//
+// Rays which miss all geometry are black
+func (c *Camera) debugColor(s *scene.Scene, ray raytracing.Ray) raytracing.Color {
+	if c.DebugMode == "direct" {
+		return s.TraceRay(ray, 1.0, 0, 0, c.lightingModel, nil)
+	}
+
+	intersected, hit, _ := s.FindIntersection(ray)
+	if !intersected {
+		return raytracing.Color{}
+	}
+
+	switch c.DebugMode {
+	case "normals":
+		return raytracing.Color{
+			Red:   0.5 * (hit.Normal.X + 1.0),
+			Green: 0.5 * (hit.Normal.Y + 1.0),
+			Blue:  0.5 * (hit.Normal.Z + 1.0),
+		}
+	case "depth":
+		depth := hit.Distance / *c.DebugMaxDepth
+		gray := math.Max(0.0, 1.0-depth)
+		return raytracing.Color{Red: gray, Green: gray, Blue: gray}
+	default:
+		return raytracing.Color{Red: hit.U, Green: hit.V}
+	}
+}
@@ -0,0 +1,101 @@
+package camera
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+// Denoise smooths noise from stochastic sampling with an edge-preserving bilateral filter, which averages
+// nearby pixels weighted by how close they are in position, color and depth
+type Denoise struct {
+	Radius         float64  `json:"radius"`
+	Strength       *float64 `json:"strength"`
+	DepthTolerance *float64 `json:"depthTolerance"`
+}
+
+// initialize validates the denoising parameters and sets defaults
+func (d *Denoise) initialize() error {
+	if d.Radius <= 0.0 {
+		return fmt.Errorf("denoise radius must be positive")
+	}
+	if d.Strength != nil && *d.Strength <= 0.0 {
+		return fmt.Errorf("denoise strength must be positive")
+	}
+	if d.Strength == nil {
+		strength := 0.2
+		d.Strength = &strength
+	}
+	if d.DepthTolerance != nil && *d.DepthTolerance <= 0.0 {
+		return fmt.Errorf("denoise depth tolerance must be positive")
+	}
+	if d.DepthTolerance == nil {
+		depthTolerance := 0.05
+		d.DepthTolerance = &depthTolerance
+	}
+	return nil
+}
+
+// apply filters a high dynamic range image of the given size, using the depth of each pixel to
+// preserve edges between objects, returning the result
+func (d *Denoise) apply(hdr []raytracing.Color, depth []float64, width int, height int) []raytracing.Color {
+	kernel := gaussianKernel(d.Radius)
+	size := len(kernel) - 1
+	colorScale := -1.0 / (2.0 * *d.Strength * *d.Strength)
+	depthScale := -1.0 / (2.0 * *d.DepthTolerance * *d.DepthTolerance)
+
+	result := make([]raytracing.Color, len(hdr))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			center := hdr[y*width+x]
+			centerDepth := depth[y*width+x]
+
+			var sum raytracing.Color
+			total := 0.0
+			for j := maxInt(y-size, 0); j <= minInt(y+size, height-1); j++ {
+				for i := maxInt(x-size, 0); i <= minInt(x+size, width-1); i++ {
+					other := hdr[j*width+i]
+					red, green, blue := other.Red-center.Red, other.Green-center.Green, other.Blue-center.Blue
+					weight := kernel[absInt(i-x)] * kernel[absInt(j-y)]
+					weight *= math.Exp(colorScale * (red*red + green*green + blue*blue))
+					weight *= math.Exp(depthScale * relativeDepthSquared(centerDepth, depth[j*width+i]))
+
+					sum = sum.Add(other.Scale(weight))
+					total += weight
+				}
+			}
+
+			result[y*width+x] = sum.Scale(1.0 / total)
+		}
+	}
+	return result
+}
+
+// relativeDepthSquared returns the square of the difference between two depths relative to the first.
+// Pixels which both missed are the same depth, and misses are infinitely far from hits
+func relativeDepthSquared(a float64, b float64) float64 {
+	if math.IsInf(a, 1) || math.IsInf(b, 1) {
+		if a == b {
+			return 0.0
+		}
+		return math.Inf(1)
+	}
+
+	relative := (b - a) / a
+	return relative * relative
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
@@ -0,0 +1,82 @@
+package camera
+
+import (
+	"fmt"
+	"math"
+)
+
+// Reconstruction filters combining the anti-aliasing samples of a pixel
+const (
+	FilterBox      = "box"
+	FilterTent     = "tent"
+	FilterGaussian = "gaussian"
+)
+
+// Filter weights the anti-aliasing samples of each pixel by their distance from its center before they
+// are combined, which gives a sharper image than averaging them equally with the same number of samples
+type Filter struct {
+	Type string `json:"type"`
+	// Width is the width in pixels over which the filter is nonzero, centered on the pixel
+	Width *float64 `json:"width"`
+}
+
+// initialize validates the filter parameters and sets defaults
+func (f *Filter) initialize() error {
+	switch f.Type {
+	case "":
+		f.Type = FilterBox
+	case FilterBox, FilterTent, FilterGaussian:
+	default:
+		return fmt.Errorf("unknown filter type '%s'", f.Type)
+	}
+
+	if f.Width != nil && *f.Width <= 0.0 {
+		return fmt.Errorf("filter width must be positive, got %v", *f.Width)
+	}
+	if f.Width == nil {
+		width := 1.0
+		f.Width = &width
+	}
+	return nil
+}
+
+// weight returns the weight of a sample offset by (dx, dy) pixels from the center of its pixel
+func (f *Filter) weight(dx float64, dy float64) float64 {
+	radius := 0.5 * *f.Width
+	if math.Abs(dx) > radius || math.Abs(dy) > radius {
+		return 0.0
+	}
+
+	switch f.Type {
+	case FilterTent:
+		return (1.0 - math.Abs(dx)/radius) * (1.0 - math.Abs(dy)/radius)
+	case FilterGaussian:
+		// The width spans three standard deviations either side of the center
+		sigma := radius / 3.0
+		return math.Exp(-(dx*dx + dy*dy) / (2.0 * sigma * sigma))
+	}
+	return 1.0
+}
+
+// weights returns the weight of each sample of the grid of factor by factor anti-aliasing samples, in the order
+// they are traced. Offsets are measured from the center of the grid, which jittering moves along with the samples.
+// Returns nil, weighting samples equally, if every sample would have zero weight
+func (f *Filter) weights(factor int) []float64 {
+	increment := 1.0 / float64(factor)
+	center := 0.5 * float64(factor-1) * increment
+
+	weights := make([]float64, 0, factor*factor)
+	total := 0.0
+	for i := 0; i < factor; i++ {
+		for j := 0; j < factor; j++ {
+			weight := f.weight(float64(i)*increment-center, float64(j)*increment-center)
+			weights = append(weights, weight)
+			total += weight
+		}
+	}
+
+	if total <= 0.0 {
+		return nil
+	}
+	return weights
+}
@@ -61,12 +61,26 @@ func (l *OrthographicLens) generateLightRay(screenX float64, screenY float64, sc
 type FisheyeLens struct {
 	HFOV float64 `json:"hfov"`
 	VFOV float64 `json:"vfov"`
+	vfov float64
 	*namedLens
 }
 
-// setAspectRatio sets the view port height to the specified aspect ratio
+// setAspectRatio sets the vertical field of view to match the specified aspect ratio.
+// An explicitly provided VFOV takes precedence, otherwise it is derived from HFOV
 func (l *FisheyeLens) setAspectRatio(ratio float64) error {
-	l.VFOV = l.HFOV / ratio
+	if l.HFOV <= 0.0 || l.HFOV > 360.0 {
+		return fmt.Errorf("fisheye hfov must be greater than 0 and at most 360 degrees, got %v", l.HFOV)
+	}
+
+	if l.VFOV != 0.0 {
+		l.vfov = l.VFOV
+	} else {
+		l.vfov = l.HFOV / ratio
+	}
+
+	if l.vfov <= 0.0 || l.vfov > 360.0 {
+		return fmt.Errorf("fisheye vfov must be greater than 0 and at most 360 degrees, got %v", l.vfov)
+	}
 	return nil
 }
 
@@ -76,7 +90,7 @@ func (l *FisheyeLens) generateLightRay(screenX float64, screenY float64, scope S
 	lightRay := raytracing.Ray{}
 
 	horizontalAngle := -screenX * l.HFOV / 2.0
-	verticalAngle := screenY * l.VFOV / 2.0
+	verticalAngle := screenY * l.vfov / 2.0
 
 	direction := scope.GetForward()
 	direction, _ = direction.Rotate(verticalAngle, scope.GetRight())
@@ -95,12 +109,28 @@ type PerspectiveLens struct {
 	HFOV          float64  `json:"hfov"`
 	ViewWidth     float64  `json:"viewWidth"`
 	viewHeight    float64
+
+	// Aperture is the radius of the lens opening, which blurs objects away from the focus distance
+	Aperture       *float64 `json:"aperture"`
+	FocusDistance  *float64 `json:"focusDistance"`
+	ApertureBlades int      `json:"apertureBlades"`
 	*namedLens
 }
 
 // setAspectRatio sets the view port height to the specified aspect ratio
 func (l *PerspectiveLens) setAspectRatio(ratio float64) error {
+	if l.FocalLength != nil && *l.FocalLength <= 0.0 {
+		return fmt.Errorf("perspective focalLength must be positive, got %v", *l.FocalLength)
+	}
+	if l.OpticalRadius != nil && *l.OpticalRadius <= 0.0 {
+		return fmt.Errorf("perspective opticalRadius must be positive, got %v", *l.OpticalRadius)
+	}
+
 	if l.HFOV != 0.0 {
+		if l.HFOV < 0.0 || l.HFOV >= 180.0 {
+			return fmt.Errorf("perspective hfov must be greater than 0 and less than 180 degrees, got %v", l.HFOV)
+		}
+
 		hfovRadian := l.HFOV / 180.0 * math.Pi
 
 		if l.FocalLength != nil {
@@ -118,6 +148,16 @@ func (l *PerspectiveLens) setAspectRatio(ratio float64) error {
 		return fmt.Errorf("when using perspective lens with viewWidth, focalLength must be specified")
 	}
 
+	if l.Aperture != nil && *l.Aperture <= 0.0 {
+		return fmt.Errorf("perspective aperture must be positive, got %v", *l.Aperture)
+	}
+	if l.FocusDistance != nil && *l.FocusDistance <= 0.0 {
+		return fmt.Errorf("perspective focusDistance must be positive, got %v", *l.FocusDistance)
+	}
+	if l.ApertureBlades != 0 && l.ApertureBlades < 3 {
+		return fmt.Errorf("perspective apertureBlades must be zero for a circular aperture or at least 3, got %v", l.ApertureBlades)
+	}
+
 	l.viewHeight = l.ViewWidth / ratio
 	return nil
 }
@@ -134,9 +174,93 @@ func (l *PerspectiveLens) generateLightRay(screenX float64, screenY float64, sco
 
 	lightRay.Position = scope.Position
 	lightRay.Direction = direction
+
+	if l.Aperture != nil {
+		// Rays from across the aperture converge on the plane at the focus distance
+		focusDistance := *l.FocalLength
+		if l.FocusDistance != nil {
+			focusDistance = *l.FocusDistance
+		}
+		focus := scope.Position.Add(direction.Scale(focusDistance / direction.Dot(scope.GetForward())))
+
+		apertureX, apertureY := apertureSample(screenX, screenY, l.ApertureBlades)
+		lightRay.Position = lightRay.Position.Add(scope.GetRight().Scale(apertureX * *l.Aperture))
+		lightRay.Position = lightRay.Position.Add(scope.GetUp().Scale(apertureY * *l.Aperture))
+		lightRay.Direction, _ = focus.Subtract(lightRay.Position).Normalize()
+	}
 	return lightRay
 }
 
+// EquirectangularLens provides light ray generation for 360 by 180 degree equirectangular rendering
+type EquirectangularLens struct {
+	*namedLens
+}
+
+// setAspectRatio has no effect, as the projection always covers the full sphere
+func (l *EquirectangularLens) setAspectRatio(ratio float64) error {
+	return nil
+}
+
+// generateLightRay creates a light ray from the lens passing through the point represented by (screenX, screenY)
+// screenX and screenY range from -1.0 in the lower left corner to 1.0 in the upper right
+func (l *EquirectangularLens) generateLightRay(screenX float64, screenY float64, scope Scope) raytracing.Ray {
+	lightRay := raytracing.Ray{}
+
+	azimuth := screenX * math.Pi
+	elevation := screenY * math.Pi / 2.0
+
+	direction := scope.GetForward().Scale(math.Cos(elevation) * math.Cos(azimuth))
+	direction = direction.Add(scope.GetRight().Scale(math.Cos(elevation) * math.Sin(azimuth)))
+	direction = direction.Add(scope.GetUp().Scale(math.Sin(elevation)))
+	direction, _ = direction.Normalize()
+
+	lightRay.Position = scope.Position
+	lightRay.Direction = direction
+	return lightRay
+}
+
+// NewOrthographicLens creates an orthographic lens whose view is viewWidth wide
+func NewOrthographicLens(viewWidth float64) *OrthographicLens {
+	return &OrthographicLens{
+		ViewPort:  &ViewPort{ViewWidth: viewWidth},
+		namedLens: &namedLens{name: "orthographic"},
+	}
+}
+
+// NewFisheyeLens creates a fisheye lens with the given horizontal field of view in degrees.
+// If vfov is zero, the vertical field of view is derived from the image aspect ratio
+func NewFisheyeLens(hfov float64, vfov float64) *FisheyeLens {
+	return &FisheyeLens{HFOV: hfov, VFOV: vfov, namedLens: &namedLens{name: "fisheye"}}
+}
+
+// NewPerspectiveLens creates a perspective lens with the given horizontal field of view in degrees
+func NewPerspectiveLens(hfov float64, focalLength float64) *PerspectiveLens {
+	return &PerspectiveLens{HFOV: hfov, FocalLength: &focalLength, namedLens: &namedLens{name: "perspective"}}
+}
+
+// NewEquirectangularLens creates a lens covering the full sphere around the camera
+func NewEquirectangularLens() *EquirectangularLens {
+	return &EquirectangularLens{namedLens: &namedLens{name: "equirectangular"}}
+}
+
+// MarshalLens returns the JSON fields of a Lens, including the projection used by CreateLens to recreate it
+func MarshalLens(lens Lens) (map[string]json.RawMessage, error) {
+	b, err := json.Marshal(lens)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+
+	if fields["projection"], err = json.Marshal(lens.GetLensName()); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
 // CreateLens takes JSON data and returns an implementation of Lens matching that data
 func CreateLens(b []byte) (Lens, error) {
 	lens := &struct {
@@ -162,6 +286,13 @@ func CreateLens(b []byte) (Lens, error) {
 		}
 		lens.namedLens = &namedLens{name: "perspective"}
 		return &lens, nil
+	case "equirectangular":
+		var lens EquirectangularLens
+		if err := json.Unmarshal(b, &lens); err != nil {
+			return nil, err
+		}
+		lens.namedLens = &namedLens{name: "equirectangular"}
+		return &lens, nil
 	default:
 		var lens OrthographicLens
 		if err := json.Unmarshal(b, &lens); err != nil {
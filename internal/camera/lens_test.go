@@ -0,0 +1,146 @@
+package camera
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPerspectiveHFOVBounds(t *testing.T) {
+	one, zero, negative := 1.0, 0.0, -1.0
+	tests := []struct {
+		name string
+		lens PerspectiveLens
+		// err is part of the expected error, or empty if the lens is valid
+		err string
+	}{
+		{"smallest hfov", PerspectiveLens{HFOV: 1e-6, FocalLength: &one}, ""},
+		{"largest hfov", PerspectiveLens{HFOV: 179.999, FocalLength: &one}, ""},
+		{"hfov from optical radius", PerspectiveLens{HFOV: 90, OpticalRadius: &one}, ""},
+		{"view width without hfov", PerspectiveLens{ViewWidth: 2, FocalLength: &one}, ""},
+		{"negative hfov", PerspectiveLens{HFOV: -10, FocalLength: &one}, "hfov must be greater than 0 and less than 180"},
+		{"hfov of 180", PerspectiveLens{HFOV: 180, FocalLength: &one}, "hfov must be greater than 0 and less than 180"},
+		{"hfov above 180", PerspectiveLens{HFOV: 270, FocalLength: &one}, "hfov must be greater than 0 and less than 180"},
+		{"zero focal length", PerspectiveLens{HFOV: 60, FocalLength: &zero}, "focalLength must be positive"},
+		{"negative focal length", PerspectiveLens{HFOV: 60, FocalLength: &negative}, "focalLength must be positive"},
+		{"zero optical radius", PerspectiveLens{HFOV: 60, OpticalRadius: &zero}, "opticalRadius must be positive"},
+		{"negative optical radius", PerspectiveLens{HFOV: 60, OpticalRadius: &negative}, "opticalRadius must be positive"},
+	}
+
+	for _, test := range tests {
+		err := test.lens.setAspectRatio(4.0 / 3.0)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+				continue
+			}
+			width := test.lens.ViewWidth
+			if math.IsNaN(width) || math.IsInf(width, 0) || width <= 0.0 {
+				t.Errorf("%s: view width is %v", test.name, width)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: returned %v, want an error containing %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestFisheyeFOV(t *testing.T) {
+	tests := []struct {
+		name       string
+		hfov, vfov float64
+		ratio      float64
+		// want is the vertical field of view used, if the lens is valid
+		want float64
+		err  string
+	}{
+		{"derived vfov", 180, 0, 2, 90, ""},
+		{"derived from full circle", 360, 0, 1, 360, ""},
+		{"explicit vfov", 180, 120, 2, 120, ""},
+		{"explicit vfov ignores ratio", 120, 200, 0.5, 200, ""},
+		{"zero hfov", 0, 0, 1, 0, "hfov must be greater than 0"},
+		{"negative hfov", -90, 0, 1, 0, "hfov must be greater than 0"},
+		{"hfov above 360", 400, 0, 1, 0, "hfov must be greater than 0 and at most 360"},
+		{"negative vfov", 180, -30, 1, 0, "vfov must be greater than 0"},
+		{"vfov above 360", 180, 361, 1, 0, "vfov must be greater than 0 and at most 360"},
+		{"derived vfov above 360", 360, 0, 0.5, 0, "vfov must be greater than 0 and at most 360"},
+	}
+
+	for _, test := range tests {
+		lens := NewFisheyeLens(test.hfov, test.vfov)
+		err := lens.setAspectRatio(test.ratio)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: returned %v, want an error containing %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if lens.vfov != test.want {
+			t.Errorf("%s: vfov is %v, want %v", test.name, lens.vfov, test.want)
+		}
+		if lens.VFOV != test.vfov {
+			t.Errorf("%s: explicit VFOV changed from %v to %v", test.name, test.vfov, lens.VFOV)
+		}
+	}
+}
+
+func TestLensJSONRoundTrip(t *testing.T) {
+	scope := `"position": {"x": 1, "y": 2, "z": -5}, "target": {"x": 0, "y": 0, "z": 0}, "roll": 10, "antiAliasingFactor": 2`
+	tests := []struct {
+		name       string
+		projection string
+		fields     string
+	}{
+		{"orthographic", "orthographic", `"viewWidth": 4`},
+		{"perspective", "perspective", `"hfov": 60, "focalLength": 1.5, "aperture": 0.1, "focusDistance": 5, "apertureBlades": 6`},
+		{"perspective from optical radius", "perspective", `"hfov": 90, "opticalRadius": 2`},
+		{"fisheye", "fisheye", `"hfov": 180, "vfov": 120`},
+		{"equirectangular", "equirectangular", `"lightingModel": "ward"`},
+	}
+	for _, test := range tests {
+		var original Camera
+		data := fmt.Sprintf(`{%s, "projection": %q, %s}`, scope, test.projection, test.fields)
+		if err := json.Unmarshal([]byte(data), &original); err != nil {
+			t.Errorf("%s: couldn't unmarshal camera: %v", test.name, err)
+			continue
+		}
+		b, err := json.Marshal(&original)
+		if err != nil {
+			t.Errorf("%s: couldn't marshal camera: %v", test.name, err)
+			continue
+		}
+		var decoded Camera
+		if err := json.Unmarshal(b, &decoded); err != nil {
+			t.Errorf("%s: couldn't unmarshal marshalled camera %s: %v", test.name, b, err)
+			continue
+		}
+
+		// Cameras hold their lighting model as a function, which can't be compared, so the lens and scope
+		// are compared directly and the other options by marshalling again
+		if name := decoded.GetLensName(); name != test.projection {
+			t.Errorf("%s: marshalled camera has a %s lens", test.name, name)
+		}
+		if !reflect.DeepEqual(decoded.Lens, original.Lens) {
+			t.Errorf("%s: lens %+v changed to %+v", test.name, original.Lens, decoded.Lens)
+		}
+		if !reflect.DeepEqual(decoded.Scope, original.Scope) {
+			t.Errorf("%s: scope %+v changed to %+v", test.name, original.Scope, decoded.Scope)
+		}
+		again, err := json.Marshal(&decoded)
+		if err != nil {
+			t.Errorf("%s: couldn't marshal camera again: %v", test.name, err)
+			continue
+		}
+		if string(again) != string(b) {
+			t.Errorf("%s: marshalled %s, then %s", test.name, b, again)
+		}
+	}
+}
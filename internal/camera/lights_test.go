@@ -0,0 +1,98 @@
+package camera
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/brendanburkhart/raytracer/internal/scene"
+)
+
+// loadManyLightsScene loads the sphere on a plane lit by a hundred dim lights spread over a dome above it
+// instead of its single light, with the given number of light samples where zero samples every light
+func loadManyLightsScene(b *testing.B, lightSamples int) (*Camera, *scene.Scene) {
+	b.Helper()
+	input, err := os.ReadFile(filepath.Join(scenesDirectory, "sphere-on-plane.json"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := map[string]interface{}{}
+	if err = json.Unmarshal(input, &data); err != nil {
+		b.Fatal(err)
+	}
+
+	vector := func(x, y, z float64) map[string]float64 {
+		return map[string]float64{"x": x, "y": y, "z": z}
+	}
+	color := func(value float64) map[string]float64 {
+		return map[string]float64{"red": value, "green": value, "blue": value}
+	}
+	lights := []interface{}{}
+	for i := 0; i < 100; i++ {
+		// Ten rings of ten lights, rising towards the top of the dome
+		azimuth, elevation := 2.0*math.Pi*float64(i%10)/10.0, 0.15*math.Pi*float64(1+i/10)/2.0
+		lights = append(lights, map[string]interface{}{
+			"position": vector(8*math.Cos(elevation)*math.Cos(azimuth), 8*math.Sin(elevation)+1, 8*math.Cos(elevation)*math.Sin(azimuth)),
+			"diffuse":  color(0.02),
+			"specular": color(0.02),
+			"ambient":  color(0.3),
+		})
+	}
+
+	sceneData := data["scene"].(map[string]interface{})
+	sceneData["lights"] = lights
+	if lightSamples > 0 {
+		sceneData["lightSamples"] = lightSamples
+	}
+
+	output, err := json.Marshal(data)
+	if err != nil {
+		b.Fatal(err)
+	}
+	path := filepath.Join(b.TempDir(), "many-lights.json")
+	if err = os.WriteFile(path, output, 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	c, s := loadSceneFile(b, path)
+	antiAliasingFactor := 2
+	c.AntiAliasingFactor = &antiAliasingFactor
+	if err := c.SetImageSize(benchmarkWidth, benchmarkHeight); err != nil {
+		b.Fatal(err)
+	}
+	return c, s
+}
+
+// BenchmarkLightSamples renders a scene with 100 lights, testing every light at each hit or only some of them,
+// and reports the error of each against testing every light
+func BenchmarkLightSamples(b *testing.B) {
+	reference, referenceScene := loadManyLightsScene(b, 0)
+	if err := reference.Render(referenceScene, 15, 64); err != nil {
+		b.Fatal(err)
+	}
+	img, err := reference.Image()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, lightSamples := range []int{0, 16, 4, 1} {
+		name := "all"
+		if lightSamples > 0 {
+			name = strconv.Itoa(lightSamples)
+		}
+		b.Run(name, func(b *testing.B) {
+			c, s := loadManyLightsScene(b, lightSamples)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := c.Render(s, 15, 64); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(renderError(b, c, img.Pix), "rms-error")
+		})
+	}
+}
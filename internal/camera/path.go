@@ -0,0 +1,199 @@
+package camera
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+// Interpolations of the control points of a Path
+const (
+	PathCatmullRom = "catmull-rom"
+	PathBezier     = "bezier"
+)
+
+// Path is a smooth curve through space defined by control points. A Catmull-Rom path passes through every
+// point, while a Bezier path is a chain of cubic curves, each passing through its first and last points
+// and pulled towards the two between them, so it must have 3n+1 points
+type Path struct {
+	Interpolation string              `json:"interpolation"`
+	Points        []raytracing.Vector `json:"points"`
+}
+
+// initialize validates the path and sets the default interpolation
+func (p *Path) initialize() error {
+	switch p.Interpolation {
+	case "":
+		p.Interpolation = PathCatmullRom
+	case PathCatmullRom, PathBezier:
+	default:
+		return fmt.Errorf("unknown path interpolation '%s'", p.Interpolation)
+	}
+
+	if len(p.Points) == 0 {
+		return fmt.Errorf("path must have at least one point")
+	}
+	if p.Interpolation == PathBezier && (len(p.Points)-1)%3 != 0 {
+		return fmt.Errorf("bezier path must have 3n+1 points, got %d", len(p.Points))
+	}
+	return nil
+}
+
+// segments returns the number of curves making up the path
+func (p *Path) segments() int {
+	if p.Interpolation == PathBezier {
+		return (len(p.Points) - 1) / 3
+	}
+	return len(p.Points) - 1
+}
+
+// At returns the point along the path at t, where the path starts at 0 and ends at 1. Each curve
+// of the path spans an equal range of t, regardless of its length
+func (p *Path) At(t float64) raytracing.Vector {
+	segments := p.segments()
+	if segments == 0 {
+		return p.Points[0]
+	}
+
+	t = math.Max(0.0, math.Min(1.0, t)) * float64(segments)
+	segment := int(t)
+	if segment == segments {
+		segment--
+	}
+	u := t - float64(segment)
+
+	if p.Interpolation == PathBezier {
+		points := p.Points[3*segment:]
+		return bezier(points[0], points[1], points[2], points[3], u)
+	}
+
+	// The ends of the path are extended by repeating the first and last points
+	before, after := p.Points[maxInt(segment-1, 0)], p.Points[minInt(segment+2, len(p.Points)-1)]
+	return catmullRom(before, p.Points[segment], p.Points[segment+1], after, u)
+}
+
+// Velocity returns the rate of change of the point along the path with t, estimated by finite differences
+func (p *Path) Velocity(t float64) raytracing.Vector {
+	before, _, after, h := p.neighbours(t)
+	return after.Subtract(before).Scale(0.5 / h)
+}
+
+// Acceleration returns the second derivative of the point along the path with t, estimated by finite differences
+func (p *Path) Acceleration(t float64) raytracing.Vector {
+	before, at, after, h := p.neighbours(t)
+	return after.Subtract(at.Scale(2.0)).Add(before).Scale(1.0 / (h * h))
+}
+
+// neighbours returns points along the path a small step h either side of t, and the point
+// between them, which is moved inwards from t at the ends so every point lies on the path
+func (p *Path) neighbours(t float64) (before, at, after raytracing.Vector, h float64) {
+	h = 1e-4
+	t = math.Max(h, math.Min(1.0-h, t))
+	return p.At(t - h), p.At(t), p.At(t + h), h
+}
+
+// bezier returns the point at u along the cubic Bezier curve from p0 to p3 with control points p1 and p2
+func bezier(p0, p1, p2, p3 raytracing.Vector, u float64) raytracing.Vector {
+	v := 1.0 - u
+	return p0.Scale(v * v * v).
+		Add(p1.Scale(3.0 * v * v * u)).
+		Add(p2.Scale(3.0 * v * u * u)).
+		Add(p3.Scale(u * u * u))
+}
+
+// catmullRom returns the point at u along the uniform Catmull-Rom curve from p1 to p2, with
+// tangents set by the neighbouring points p0 and p3
+func catmullRom(p0, p1, p2, p3 raytracing.Vector, u float64) raytracing.Vector {
+	u2, u3 := u*u, u*u*u
+	return p0.Scale(-0.5*u3 + u2 - 0.5*u).
+		Add(p1.Scale(1.5*u3 - 2.5*u2 + 1.0)).
+		Add(p2.Scale(-1.5*u3 + 2.0*u2 + 0.5*u)).
+		Add(p3.Scale(0.5*u3 - 0.5*u2))
+}
+
+// Animation renders a sequence of frames with the camera moving along a path. The camera looks at the
+// fixed target or along the target path, or if neither is given, at the camera's own target if it has
+// one and otherwise in the camera's original direction
+type Animation struct {
+	Frames     int                `json:"frames"`
+	Path       Path               `json:"path"`
+	Target     *raytracing.Vector `json:"target"`
+	TargetPath *Path              `json:"targetPath"`
+	// Banking is the roll in degrees for each degree the path turns per frame, banking into turns like an
+	// aircraft. Turns are measured around the vertical axis, so climbs and dives don't bank the camera
+	Banking float64 `json:"banking"`
+}
+
+// Initialize validates the animation, and must be called before it is used
+func (a *Animation) Initialize() error {
+	if a.Frames < 1 {
+		return fmt.Errorf("animation must have at least one frame")
+	}
+	if a.Target != nil && a.TargetPath != nil {
+		return fmt.Errorf("animation cannot have both a target and a target path")
+	}
+
+	if err := a.Path.initialize(); err != nil {
+		return fmt.Errorf("animation path: %v", err)
+	}
+	if a.TargetPath != nil {
+		if err := a.TargetPath.initialize(); err != nil {
+			return fmt.Errorf("animation target path: %v", err)
+		}
+	}
+	return nil
+}
+
+// SetFrame moves the scope to where it is in the given frame, counting from zero. The
+// first and last frames are at the ends of the path
+func (a *Animation) SetFrame(scope *Scope, frame int) error {
+	t := 0.0
+	if a.Frames > 1 {
+		t = float64(frame) / float64(a.Frames-1)
+	}
+
+	scope.Position = a.Path.At(t)
+	if a.Target != nil || a.TargetPath != nil {
+		target := a.targetAt(t)
+		scope.Target = &target
+		// The target replaces any orientation given as angles
+		scope.Yaw, scope.Pitch = nil, nil
+	}
+
+	scope.bank = 0.0
+	if a.Banking != 0.0 && a.Frames > 1 {
+		// Without a target or angles the orientation isn't recomputed, so there would be nothing to roll
+		if scope.Target == nil && scope.Yaw == nil && scope.Pitch == nil {
+			return fmt.Errorf("banking requires the camera to look at a target or have yaw or pitch angles")
+		}
+		scope.bank = a.Banking * a.turnRate(t)
+	}
+
+	if err := scope.Initialize(); err != nil {
+		return fmt.Errorf("frame %d: %v", frame, err)
+	}
+	return nil
+}
+
+// targetAt returns the point the camera looks at at t
+func (a *Animation) targetAt(t float64) raytracing.Vector {
+	if a.Target != nil {
+		return *a.Target
+	}
+	return a.TargetPath.At(t)
+}
+
+// turnRate returns the rate the camera path turns at t in degrees per frame, around the vertical
+// axis, where turning to the left is positive
+func (a *Animation) turnRate(t float64) float64 {
+	velocity, acceleration := a.Path.Velocity(t), a.Path.Acceleration(t)
+	horizontal := velocity.X*velocity.X + velocity.Z*velocity.Z
+	if horizontal <= 1e-9*velocity.Dot(velocity) {
+		return 0.0
+	}
+
+	// The rate of change of heading with t, in radians
+	rate := velocity.Cross(acceleration).Y / horizontal
+	return rate / float64(a.Frames-1) * 180.0 / math.Pi
+}
@@ -0,0 +1,102 @@
+package camera
+
+import (
+	"math"
+	"testing"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+func vectorsClose(a, b raytracing.Vector) bool {
+	const tolerance = 1e-9
+	return math.Abs(a.X-b.X) < tolerance && math.Abs(a.Y-b.Y) < tolerance && math.Abs(a.Z-b.Z) < tolerance
+}
+
+func TestCatmullRomPassesThroughPoints(t *testing.T) {
+	path := Path{Points: []raytracing.Vector{
+		{X: 0, Y: 0, Z: 0},
+		{X: 1, Y: 2, Z: 0},
+		{X: 3, Y: 2, Z: 1},
+		{X: 4, Y: 0, Z: 1},
+	}}
+	if err := path.initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, point := range path.Points {
+		at := float64(i) / float64(len(path.Points)-1)
+		if got := path.At(at); !vectorsClose(got, point) {
+			t.Errorf("At(%v) = %v, want control point %v", at, got, point)
+		}
+	}
+}
+
+func TestCatmullRomMidpoints(t *testing.T) {
+	// Evenly spaced points along a line are interpolated linearly between the inner points, while the end
+	// segments are extended by repeating the end points, so they ease in and out of the ends
+	path := Path{Interpolation: PathCatmullRom, Points: []raytracing.Vector{
+		{X: 0, Y: 0, Z: 0},
+		{X: 1, Y: 0, Z: 0},
+		{X: 2, Y: 0, Z: 0},
+		{X: 3, Y: 0, Z: 0},
+	}}
+	if err := path.initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		t    float64
+		want raytracing.Vector
+	}{
+		{1.0 / 6.0, raytracing.Vector{X: 0.4375, Y: 0, Z: 0}},
+		{0.5, raytracing.Vector{X: 1.5, Y: 0, Z: 0}},
+		{5.0 / 6.0, raytracing.Vector{X: 2.5625, Y: 0, Z: 0}},
+	}
+	for _, test := range tests {
+		if got := path.At(test.t); !vectorsClose(got, test.want) {
+			t.Errorf("At(%v) = %v, want %v", test.t, got, test.want)
+		}
+	}
+}
+
+func TestBezierEndpointsAndMidpoint(t *testing.T) {
+	path := Path{Interpolation: PathBezier, Points: []raytracing.Vector{
+		{X: 0, Y: 0, Z: 0},
+		{X: 0, Y: 1, Z: 0},
+		{X: 1, Y: 1, Z: 0},
+		{X: 1, Y: 0, Z: 0},
+	}}
+	if err := path.initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		t    float64
+		want raytracing.Vector
+	}{
+		{0.0, raytracing.Vector{X: 0, Y: 0, Z: 0}},
+		{0.5, raytracing.Vector{X: 0.5, Y: 0.75, Z: 0}},
+		{1.0, raytracing.Vector{X: 1, Y: 0, Z: 0}},
+	}
+	for _, test := range tests {
+		if got := path.At(test.t); !vectorsClose(got, test.want) {
+			t.Errorf("At(%v) = %v, want %v", test.t, got, test.want)
+		}
+	}
+}
+
+func TestPathValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		path Path
+	}{
+		{"no points", Path{}},
+		{"unknown interpolation", Path{Interpolation: "linear", Points: []raytracing.Vector{{}}}},
+		{"bezier point count", Path{Interpolation: PathBezier, Points: make([]raytracing.Vector, 3)}},
+	}
+	for _, test := range tests {
+		if err := test.path.initialize(); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package camera
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// SavePFM encodes the internal high dynamic range image into a Portable Float Map file and writes to w.
+// Colors are stored unclamped as 32 bit floats, for use in compositing and external tone mapping
+func (c *Camera) SavePFM(w io.Writer) error {
+	if c.passes == 0 {
+		return fmt.Errorf("image must be rendered before saving it")
+	}
+	if c.tiled() {
+		return fmt.Errorf("HDR images cannot be saved from tiled renders")
+	}
+
+	hdr, _ := c.downsample()
+
+	writer := bufio.NewWriter(w)
+
+	// Negative scale indicates little-endian data
+	if _, err := fmt.Fprintf(writer, "PF\n%d %d\n-1.0\n", c.imageWidth, c.imageHeight); err != nil {
+		return err
+	}
+
+	// Rows are stored from bottom to top
+	row := make([]byte, 12*c.imageWidth)
+	for pixelY := c.imageHeight - 1; pixelY >= 0; pixelY-- {
+		for pixelX := 0; pixelX < c.imageWidth; pixelX++ {
+			pixelColor := hdr[pixelY*c.imageWidth+pixelX]
+			binary.LittleEndian.PutUint32(row[12*pixelX:], math.Float32bits(float32(pixelColor.Red)))
+			binary.LittleEndian.PutUint32(row[12*pixelX+4:], math.Float32bits(float32(pixelColor.Green)))
+			binary.LittleEndian.PutUint32(row[12*pixelX+8:], math.Float32bits(float32(pixelColor.Blue)))
+		}
+
+		if _, err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	return writer.Flush()
+}
+
+// SaveDepth encodes the distance from the camera to the closest hit of each pixel into a grayscale
+// Portable Float Map file and writes to w. Pixels where every ray missed are stored as +Inf.
+// RecordDepth must be set before rendering
+func (c *Camera) SaveDepth(w io.Writer) error {
+	if c.passes == 0 || !c.RecordDepth {
+		return fmt.Errorf("depth must be recorded while rendering before saving it")
+	}
+	if c.tiled() {
+		return fmt.Errorf("depth maps cannot be saved from tiled renders")
+	}
+
+	factor := c.renderWidth / c.imageWidth
+
+	writer := bufio.NewWriter(w)
+
+	if _, err := fmt.Fprintf(writer, "Pf\n%d %d\n-1.0\n", c.imageWidth, c.imageHeight); err != nil {
+		return err
+	}
+
+	row := make([]byte, 4*c.imageWidth)
+	for pixelY := c.imageHeight - 1; pixelY >= 0; pixelY-- {
+		for pixelX := 0; pixelX < c.imageWidth; pixelX++ {
+			depth := math.Inf(1)
+			for i := 0; i < factor; i++ {
+				for j := 0; j < factor; j++ {
+					depth = math.Min(depth, c.depth[c.bufferIndex(pixelX*factor+i, pixelY*factor+j)])
+				}
+			}
+			binary.LittleEndian.PutUint32(row[4*pixelX:], math.Float32bits(float32(depth)))
+		}
+
+		if _, err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	return writer.Flush()
+}
@@ -0,0 +1,149 @@
+package camera
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"time"
+
+	"github.com/brendanburkhart/raytracer/internal/scene"
+)
+
+// RenderTiled renders the Scene in horizontal tiles of TileHeight rows and encodes them into a png
+// file written to w as they are completed. Only one tile is held in memory at a time, rather than
+// the whole image, at the cost of not supporting progressive rendering, bloom, or the other outputs
+func (c *Camera) RenderTiled(s *scene.Scene, maxRayReflections int, threads int, w io.Writer) error {
+	return c.RenderTiledContext(context.Background(), s, maxRayReflections, threads, w)
+}
+
+// RenderTiledContext is RenderTiled, but stops early and returns ctx.Err() if ctx is cancelled.
+// The png written to w is incomplete after cancellation
+func (c *Camera) RenderTiledContext(ctx context.Context, s *scene.Scene, maxRayReflections int, threads int, w io.Writer) error {
+	if c.TileHeight == nil {
+		return fmt.Errorf("tile height must be set for tiled rendering")
+	}
+	if c.imageWidth == 0 {
+		return fmt.Errorf("camera cannot perform render until image size is set (using SetImageSize)")
+	}
+
+	start := time.Now()
+	img := &tiledImage{
+		camera: c,
+		render: func() error {
+			return c.RenderContext(ctx, s, maxRayReflections, threads)
+		},
+	}
+
+	err := png.Encode(w, img)
+	if img.err != nil {
+		return img.err
+	}
+
+	c.stats = RenderStats{
+		PrimaryRays: img.primaryRays,
+		Secondary:   img.secondary,
+		Duration:    time.Since(start),
+	}
+	return err
+}
+
+// tiled returns whether the buffers only hold a tile of the image
+func (c *Camera) tiled() bool {
+	return c.windowY != 0 || c.windowHeight != c.renderHeight
+}
+
+// tiledImage is an image.Image which renders each tile when the png encoder first reads a row of it.
+// The encoder reads rows in order, so each tile is only rendered once
+type tiledImage struct {
+	camera *Camera
+	render func() error
+
+	// pixels holds the quantized image rows from first to first+rows, or pixels16 for 16 bit images
+	pixels   []color.RGBA
+	pixels16 []color.NRGBA64
+	first    int
+	rows     int
+
+	primaryRays int64
+	secondary   scene.RayCounts
+	err         error
+}
+
+// ColorModel returns the color model of the image, which sets the bit depth of the png
+func (img *tiledImage) ColorModel() color.Model {
+	if *img.camera.BitDepth == 16 {
+		return color.NRGBA64Model
+	}
+	return color.RGBAModel
+}
+
+// Bounds returns the bounds of the whole image
+func (img *tiledImage) Bounds() image.Rectangle {
+	return image.Rect(0, 0, img.camera.imageWidth, img.camera.imageHeight)
+}
+
+// Opaque returns whether all pixels are known to be opaque without rendering them
+func (img *tiledImage) Opaque() bool {
+	return !img.camera.TransparentBackground && img.camera.Region == nil
+}
+
+// At returns the color of a pixel, rendering the tile containing it if necessary
+func (img *tiledImage) At(x int, y int) color.Color {
+	if y < img.first || y >= img.first+img.rows {
+		if img.err != nil {
+			return color.RGBA{}
+		}
+		if img.err = img.renderTile(y); img.err != nil {
+			return color.RGBA{}
+		}
+	}
+
+	index := (y-img.first)*img.camera.imageWidth + x
+	if img.pixels16 != nil {
+		return img.pixels16[index]
+	}
+	return img.pixels[index]
+}
+
+// renderTile renders and quantizes the tile containing image row y
+func (img *tiledImage) renderTile(y int) error {
+	c := img.camera
+	factor := c.renderWidth / c.imageWidth
+	tileHeight := *c.TileHeight
+
+	img.first = y - y%tileHeight
+	img.rows = minInt(tileHeight, c.imageHeight-img.first)
+	c.allocateWindow(img.first*factor, img.rows*factor)
+
+	if err := img.render(); err != nil {
+		return err
+	}
+	img.primaryRays += c.Stats().PrimaryRays
+	img.secondary.Add(c.Stats().Secondary)
+
+	bounds := image.Rect(0, img.first, c.imageWidth, img.first+img.rows)
+	if c.Region != nil {
+		bounds = bounds.Intersect(image.Rect(c.Region.X, c.Region.Y, c.Region.X+c.Region.Width, c.Region.Y+c.Region.Height))
+	}
+
+	hdr, alpha := c.downsample()
+	if *c.BitDepth == 16 {
+		img.pixels16 = make([]color.NRGBA64, len(hdr))
+	} else {
+		img.pixels = make([]color.RGBA, len(hdr))
+	}
+	for pixelY := bounds.Min.Y; pixelY < bounds.Max.Y; pixelY++ {
+		for pixelX := bounds.Min.X; pixelX < bounds.Max.X; pixelX++ {
+			index := (pixelY-img.first)*c.imageWidth + pixelX
+			if img.pixels16 != nil {
+				img.pixels16[index] = quantizePixel16(hdr[index], alpha[index])
+			} else {
+				img.pixels[index] = quantizePixel(hdr[index], alpha[index])
+			}
+		}
+	}
+	return nil
+}
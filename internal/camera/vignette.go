@@ -0,0 +1,45 @@
+package camera
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+// Vignette darkens the image towards its corners, based on the distance of each pixel from the center
+type Vignette struct {
+	Strength float64  `json:"strength"`
+	Falloff  *float64 `json:"falloff"`
+}
+
+// initialize validates the vignette parameters and sets defaults
+func (v *Vignette) initialize() error {
+	if v.Strength < 0.0 || v.Strength > 1.0 {
+		return fmt.Errorf("vignette strength must be between 0 and 1, got %v", v.Strength)
+	}
+	if v.Falloff != nil && *v.Falloff <= 0.0 {
+		return fmt.Errorf("vignette falloff must be positive, got %v", *v.Falloff)
+	}
+	if v.Falloff == nil {
+		falloff := 2.0
+		v.Falloff = &falloff
+	}
+	return nil
+}
+
+// apply darkens rows first to first+len(hdr)/width of a high dynamic range image of the given size, returning the result
+func (v *Vignette) apply(hdr []raytracing.Color, width int, height int, first int) []raytracing.Color {
+	centerX, centerY := 0.5*float64(width), 0.5*float64(height)
+	corner := math.Hypot(centerX, centerY)
+
+	result := make([]raytracing.Color, len(hdr))
+	for i := range hdr {
+		x := float64(i%width) + 0.5
+		y := float64(first+i/width) + 0.5
+
+		distance := math.Hypot(x-centerX, y-centerY) / corner
+		result[i] = hdr[i].Scale(1.0 - v.Strength*math.Pow(distance, *v.Falloff))
+	}
+	return result
+}
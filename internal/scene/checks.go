@@ -0,0 +1,71 @@
+package scene
+
+import (
+	"fmt"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing/object"
+)
+
+// checkGeometry returns warnings about objects which are probably mistakes, such as from typos: degenerate
+// geometry, objects which coincide with another of the same type, and spheres hidden inside opaque spheres
+func (s *Scene) checkGeometry() []string {
+	var warnings []string
+	warn := func(i int, format string, args ...interface{}) {
+		prefix := fmt.Sprintf("object %d (%s): ", i, object.TypeName(s.Objects[i]))
+		warnings = append(warnings, prefix+fmt.Sprintf(format, args...))
+	}
+
+	// Objects coincide when they have the same type and the same extent
+	extents := make(map[string]int)
+	for i, obj := range s.Objects {
+		if checker, ok := obj.(object.DegeneracyChecker); ok {
+			if degeneracy := checker.Degeneracy(); degeneracy != "" {
+				warn(i, "%s", degeneracy)
+			}
+		}
+
+		var extent string
+		switch o := obj.(type) {
+		case object.Plane:
+			extent = fmt.Sprintf("%v %v", o.Normal, o.Normal.Dot(o.Point))
+		case object.Sphere:
+			extent = fmt.Sprintf("%v %v", o.Center, o.Radius)
+		case object.Box:
+			extent = fmt.Sprintf("%v %v", o.MinCorner, o.MaxCorner)
+		case object.Bounded:
+			min, max := o.Bounds()
+			extent = fmt.Sprintf("%v %v", min, max)
+		default:
+			continue
+		}
+
+		key := object.TypeName(obj) + " " + extent
+		if first, ok := extents[key]; ok {
+			warn(i, "coincides with object %d, so only one of them is seen", first)
+		} else {
+			extents[key] = i
+		}
+	}
+
+	for i, obj := range s.Objects {
+		inner, ok := obj.(object.Sphere)
+		if !ok || inner.Radius <= 0.0 {
+			continue
+		}
+		for j, other := range s.Objects {
+			outer, ok := other.(object.Sphere)
+			if !ok || i == j || s.Materials[outer.MaterialID()].Transmittance > 0.0 {
+				continue
+			}
+			if inner.Center == outer.Center && inner.Radius == outer.Radius {
+				continue
+			}
+			if inner.Center.DistanceTo(outer.Center)+inner.Radius <= outer.Radius {
+				warn(i, "is entirely inside opaque object %d, so it is never seen", j)
+				break
+			}
+		}
+	}
+
+	return warnings
+}
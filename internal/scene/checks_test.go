@@ -0,0 +1,74 @@
+package scene
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+	"github.com/brendanburkhart/raytracer/pkg/raytracing/object"
+)
+
+func TestGeometryWarnings(t *testing.T) {
+	origin := raytracing.Vector{X: 0, Y: 0, Z: 0}
+	up := raytracing.Vector{X: 0, Y: 1, Z: 0}
+	one := raytracing.Vector{X: 1, Y: 1, Z: 1}
+	flat := raytracing.Vector{X: 1, Y: 0, Z: 1}
+
+	mesh, err := object.NewMesh([]raytracing.Vector{origin, {X: 1, Y: 0, Z: 0}, {X: 2, Y: 0, Z: 0}, {X: 0, Y: 1, Z: 0}}, [][3]int{{0, 1, 2}, {0, 1, 3}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const opaque, transparent = 0, 1
+
+	tests := []struct {
+		name    string
+		objects []object.Object
+		// warning is part of the expected warning, or empty if there should be none
+		warning string
+	}{
+		{"separate objects", []object.Object{object.NewSphere(origin, 1, opaque), object.NewSphere(one.Scale(3.0), 1, opaque), object.NewPlane(origin, up, opaque)}, ""},
+		{"zero radius sphere", []object.Object{object.NewSphere(origin, 0, opaque)}, "object 0 (sphere): sphere has zero radius"},
+		{"negative radius sphere", []object.Object{object.NewSphere(origin, -1, opaque)}, "object 0 (sphere): sphere has a negative radius"},
+		{"zero volume box", []object.Object{object.NewBox(origin, flat, opaque)}, "object 0 (box): box has zero volume"},
+		{"box with equal corners", []object.Object{object.NewBox(one, one, opaque)}, "object 0 (box): box has zero volume"},
+		{"zero normal plane", []object.Object{object.NewPlane(origin, raytracing.Vector{}, opaque)}, "object 0 (plane): plane has a zero normal"},
+		{"mesh with a zero area face", []object.Object{mesh}, "object 0 (mesh): mesh has 1 face(s) with zero area"},
+		{"coincident spheres", []object.Object{object.NewSphere(one, 1, opaque), object.NewSphere(one, 1, transparent)}, "object 1 (sphere): coincides with object 0"},
+		{"coincident planes", []object.Object{object.NewPlane(origin, up, opaque), object.NewPlane(raytracing.Vector{X: 5, Y: 0, Z: 2}, up, opaque)}, "object 1 (plane): coincides with object 0"},
+		{"coincident boxes", []object.Object{object.NewBox(origin, one, opaque), object.NewBox(one, origin, opaque)}, "object 1 (box): coincides with object 0"},
+		{"sphere inside opaque sphere", []object.Object{object.NewSphere(origin, 2, opaque), object.NewSphere(raytracing.Vector{X: 0.5, Y: 0, Z: 0}, 1, opaque)}, "object 1 (sphere): is entirely inside opaque object 0"},
+		{"sphere inside transparent sphere", []object.Object{object.NewSphere(origin, 2, transparent), object.NewSphere(raytracing.Vector{X: 0.5, Y: 0, Z: 0}, 1, opaque)}, ""},
+	}
+
+	for _, test := range tests {
+		for _, strict := range []bool{false, true} {
+			s := Scene{
+				Materials: []raytracing.Material{{}, {Transmittance: 0.9}},
+				Objects:   test.objects,
+				Strict:    strict,
+			}
+			err := s.Initialize()
+
+			if test.warning == "" {
+				if err != nil || len(s.Warnings) != 0 {
+					t.Errorf("%s: expected no warnings, got %v and error %v", test.name, s.Warnings, err)
+				}
+				continue
+			}
+
+			if strict {
+				if err == nil || !strings.Contains(err.Error(), test.warning) {
+					t.Errorf("%s: strict mode returned %v, want an error containing %q", test.name, err, test.warning)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+				continue
+			}
+			if len(s.Warnings) != 1 || !strings.Contains(s.Warnings[0], test.warning) {
+				t.Errorf("%s: warnings are %v, want one containing %q", test.name, s.Warnings, test.warning)
+			}
+		}
+	}
+}
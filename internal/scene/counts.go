@@ -0,0 +1,54 @@
+package scene
+
+// RayCounts counts the secondary rays traced from primary rays, and how deep their paths went. It isn't safe
+// for concurrent use, so each goroutine should count into its own and combine them with Add once finished
+type RayCounts struct {
+	Shadow    int64
+	Reflected int64
+	Refracted int64
+	// Diffuse counts the diffuse bounces of path tracing
+	Diffuse int64
+	// Depth is the number of bounces along the deepest path from each primary ray, summed over the primary rays
+	Depth int64
+
+	// start is the remaining depth of the current primary ray, and deepest is the deepest bounce from it so far
+	start   int
+	deepest int
+}
+
+// Add adds the counts of other to c
+func (c *RayCounts) Add(other RayCounts) {
+	c.Shadow += other.Shadow
+	c.Reflected += other.Reflected
+	c.Refracted += other.Refracted
+	c.Diffuse += other.Diffuse
+	c.Depth += other.Depth
+}
+
+// Total returns the number of secondary rays counted
+func (c RayCounts) Total() int64 {
+	return c.Shadow + c.Reflected + c.Refracted + c.Diffuse
+}
+
+// begin starts counting the rays from a primary ray with the given remaining depth, returning counts to
+// use in place of c, which are discarded if c is nil
+func (c *RayCounts) begin(remainingDepth int) *RayCounts {
+	if c == nil {
+		c = &RayCounts{}
+	}
+	c.start = remainingDepth
+	c.deepest = 0
+	return c
+}
+
+// end adds the depth of the finished primary ray
+func (c *RayCounts) end() {
+	c.Depth += int64(c.deepest)
+}
+
+// bounce records that a secondary ray with the given remaining depth is traced
+func (c *RayCounts) bounce(remainingDepth int) {
+	if depth := c.start - remainingDepth; depth > c.deepest {
+		c.deepest = depth
+	}
+}
@@ -4,42 +4,399 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/brendanburkhart/raytracer/internal/yaml"
 	"github.com/brendanburkhart/raytracer/pkg/raytracing"
 	"github.com/brendanburkhart/raytracer/pkg/raytracing/object"
 )
 
-// Scene describes a renderable scene and holds an output image
+// Scene describes a renderable scene and holds an output image. Once initialized, tracing only reads the
+// scene, so its exported methods other than Initialize and UnmarshalJSON are safe to call concurrently from
+// any number of goroutines, provided each goroutine counts rays into its own RayCounts. Changing the fields
+// of the scene while it is being traced is a data race, and state added to the scene which tracing changes
+// must be synchronized, or kept per goroutine like RayCounts
 type Scene struct {
-	Materials    []raytracing.Material `json:"materials"`
-	Objects      []object.Object       `json:"objects"`
-	Lights       []raytracing.Light    `json:"lights"`
-	ambientLight raytracing.Color
+	Materials         []raytracing.Material `json:"materials"`
+	MaterialsFile     string                `json:"materialsFile"`
+	Include           []string              `json:"include"`
+	Objects           []object.Object       `json:"objects"`
+	Lights            []raytracing.Light    `json:"lights"`
+	Brightness        *float64              `json:"brightness"`
+	GlossySamples     *int                  `json:"glossySamples"`
+	LightSamples      *int                  `json:"lightSamples"`
+	RouletteThreshold float64               `json:"rouletteThreshold"`
+	Seed              int64                 `json:"seed"`
+	Skybox            *Skybox               `json:"skybox"`
+	DepthFallback     string                `json:"depthFallback"`
+	PathTracing       bool                  `json:"pathTracing"`
+	Strict            bool                  `json:"strict"`
+	Epsilon           *float64              `json:"epsilon"`
+	FarClip           *float64              `json:"farClip"`
+	// MaxReflections replaces the maximum number of reflections requested by the renderer, and MaxRefractions
+	// separately limits refractions, since light passing through layers of glass is refracted many times
+	MaxReflections *int `json:"maxReflections"`
+	MaxRefractions *int `json:"maxRefractions"`
+	// NextEventEstimation samples light spheres directly when path tracing, so they don't only light surfaces
+	// through diffuse bounces which happen to reach them. It defaults to true, and false is for comparison
+	NextEventEstimation *bool `json:"nextEventEstimation"`
+	ambientLight        raytracing.Color
+	lightSpheres        []lightSphere
+	// minimumEpsilon is the smallest epsilon of any ray, see epsilonAt
+	minimumEpsilon float64
+	// hidden is whether each object is hidden from each kind of ray, indexed by kind and then object
+	hidden [raytracing.RayKinds][]bool
+
+	// Directory is the directory relative paths in the scene are resolved against
+	Directory string `json:"-"`
+	// Warnings describe objects which are probably mistakes, such as degenerate or coincident geometry,
+	// found when the scene is initialized
+	Warnings []string `json:"-"`
+}
+
+// Stats describes the contents of a Scene
+type Stats struct {
+	Objects   int
+	Triangles int
+	Lights    int
+}
+
+// Stats returns the number of objects, triangles and lights in the Scene
+func (s *Scene) Stats() Stats {
+	stats := Stats{
+		Objects: len(s.Objects),
+		Lights:  len(s.Lights),
+	}
+
+	for _, obj := range s.Objects {
+		if counter, ok := obj.(object.TriangleCounter); ok {
+			stats.Triangles += counter.TriangleCount()
+		}
+	}
+
+	return stats
 }
 
 // Initialize must be called before the Scene is used
 func (s *Scene) Initialize() (e error) {
-	for i, object := range s.Objects {
-		materialID := object.MaterialID()
+	if e = s.loadMaterials(); e != nil {
+		return
+	}
+	if e = s.loadObjectFiles(); e != nil {
+		return
+	}
+	if e = s.loadIncludes(nil); e != nil {
+		return
+	}
+
+	for i := range s.Materials {
+		if err := s.Materials[i].LoadTexture(s.Directory); err != nil {
+			e = fmt.Errorf("material %d: %v", i, err)
+			return
+		}
+		if s.Materials[i].RoughnessU < 0.0 || s.Materials[i].RoughnessV < 0.0 {
+			e = fmt.Errorf("material %d: roughnessU and roughnessV cannot be negative", i)
+			return
+		}
+		if s.Materials[i].DiffuseRoughness < 0.0 {
+			e = fmt.Errorf("material %d: diffuseRoughness cannot be negative", i)
+			return
+		}
+		if s.Materials[i].Transmittance < 0.0 || s.Materials[i].Transmittance > 1.0 {
+			e = fmt.Errorf("material %d: transmittance must be between 0 and 1", i)
+			return
+		}
+		if bump := s.Materials[i].Bump; bump != nil {
+			if err := bump.Validate(); err != nil {
+				e = fmt.Errorf("material %d: %v", i, err)
+				return
+			}
+		}
+		if procedural := s.Materials[i].Procedural; procedural != nil {
+			if err := procedural.Validate(); err != nil {
+				e = fmt.Errorf("material %d: %v", i, err)
+				return
+			}
+		}
+		if gradient := s.Materials[i].Gradient; gradient != nil {
+			if err := gradient.Validate(); err != nil {
+				e = fmt.Errorf("material %d: %v", i, err)
+				return
+			}
+		}
+		if wear := s.Materials[i].Wear; wear != nil {
+			if err := wear.Validate(); err != nil {
+				e = fmt.Errorf("material %d: %v", i, err)
+				return
+			}
+		}
+		if absorption := s.Materials[i].Absorption; absorption.Red < 0.0 || absorption.Green < 0.0 || absorption.Blue < 0.0 {
+			e = fmt.Errorf("material %d: absorption cannot be negative", i)
+			return
+		}
+		if s.Materials[i].RefractiveIndexOf(raytracing.RedChannel) <= 0.0 {
+			e = fmt.Errorf("material %d: refractive index must be positive for every channel", i)
+			return
+		}
+	}
+
+	if s.Skybox != nil {
+		if e = s.Skybox.load(s.Directory); e != nil {
+			return
+		}
+	}
+
+	ids := make(map[string]int)
+	for i, material := range s.Materials {
+		if material.Name == "" {
+			continue
+		}
+		if _, ok := ids[material.Name]; ok {
+			e = fmt.Errorf("duplicate material name %q", material.Name)
+			return
+		}
+		ids[material.Name] = i
+	}
+
+	objects := make(map[string]object.Object)
+	for i, obj := range s.Objects {
+		named, ok := obj.(object.NamedObject)
+		if !ok || named.ObjectName() == "" {
+			continue
+		}
+		if _, ok := objects[named.ObjectName()]; ok {
+			e = fmt.Errorf("duplicate name %q for object %d", named.ObjectName(), i)
+			return
+		}
+		objects[named.ObjectName()] = obj
+	}
+
+	for i, obj := range s.Objects {
+		if resolver, ok := obj.(object.InstanceResolver); ok {
+			if err := resolver.ResolveInstance(objects); err != nil {
+				e = fmt.Errorf("object %d: %v", i, err)
+				return
+			}
+		}
+	}
+
+	for i, obj := range s.Objects {
+		if resolver, ok := obj.(object.MaterialResolver); ok {
+			if err := resolver.ResolveMaterial(ids); err != nil {
+				e = fmt.Errorf("object %d: %v", i, err)
+				return
+			}
+		}
+	}
+
+	if len(s.Objects) > 0 && len(s.Materials) == 0 {
+		e = errors.New("scene has objects but no materials")
+		return
+	}
+
+	for i, obj := range s.Objects {
+		materialID := obj.MaterialID()
 		if materialID < 0 || materialID >= len(s.Materials) {
-			msg := fmt.Sprintf("invalid material id in object %d", i)
-			e = errors.New(msg)
+			e = fmt.Errorf("invalid material id %d in object %d (%s), must be between 0 and %d", materialID, i, object.TypeName(obj), len(s.Materials)-1)
 			return
 		}
 	}
 
+	s.Warnings = s.checkGeometry()
+	if s.Strict && len(s.Warnings) > 0 {
+		e = fmt.Errorf("strict mode: %s", strings.Join(s.Warnings, "; "))
+		return
+	}
+
+	for kind := range s.hidden {
+		s.hidden[kind] = make([]bool, len(s.Objects))
+		for i, obj := range s.Objects {
+			if filter, ok := obj.(object.VisibilityFilter); ok {
+				s.hidden[kind][i] = !filter.VisibleTo(raytracing.RayKind(kind))
+			}
+		}
+	}
+
 	s.ambientLight = raytracing.Color{}
 	for _, light := range s.Lights {
-		s.ambientLight.Red += light.Ambient.Red
-		s.ambientLight.Green += light.Ambient.Green
-		s.ambientLight.Blue += light.Ambient.Blue
+		s.ambientLight = s.ambientLight.Add(light.Ambient.Scale(light.IntensityScale()))
+	}
+	s.ambientLight = s.ambientLight.Scale(1.0 / float64(len(s.Lights)))
+
+	s.lightSpheres = nil
+	for i, light := range s.Lights {
+		if light.Radius == nil {
+			continue
+		}
+		if *light.Radius <= 0.0 {
+			e = fmt.Errorf("light %d: radius must be positive", i)
+			return
+		}
+		color := light.Diffuse.Scale(light.IntensityScale())
+		s.lightSpheres = append(s.lightSpheres, lightSphere{object.NewSphere(light.Position, *light.Radius, 0), color, i})
+	}
+
+	if s.NextEventEstimation == nil {
+		nextEventEstimation := true
+		s.NextEventEstimation = &nextEventEstimation
+	}
+
+	if s.Brightness == nil {
+		brightness := 1.0
+		s.Brightness = &brightness
+	}
+
+	switch s.DepthFallback {
+	case "", DepthFallbackNone, DepthFallbackAmbient, DepthFallbackBackground:
+	default:
+		e = fmt.Errorf("unknown depth fallback '%s'", s.DepthFallback)
+		return
+	}
+
+	if s.GlossySamples != nil && *s.GlossySamples < 1 {
+		e = errors.New("glossy samples must be at least one")
+		return
+	}
+	if s.GlossySamples == nil {
+		glossySamples := 8
+		s.GlossySamples = &glossySamples
+	}
+
+	if s.LightSamples != nil && *s.LightSamples < 1 {
+		e = errors.New("light samples must be at least one")
+		return
+	}
+
+	if s.FarClip != nil && *s.FarClip <= 0.0 {
+		e = errors.New("far clip must be positive")
+		return
+	}
+	radius := s.radius()
+	if s.FarClip == nil {
+		farClip := math.Max(defaultFarClip, 4.0*radius)
+		s.FarClip = &farClip
+	}
+	s.minimumEpsilon = relativeEpsilon * radius
+	if s.minimumEpsilon == 0.0 {
+		// Only infinite objects, or nothing at all, so there is no scale to go by
+		s.minimumEpsilon = relativeEpsilon
+	}
+
+	if (s.MaxReflections != nil && *s.MaxReflections < 0) || (s.MaxRefractions != nil && *s.MaxRefractions < 0) {
+		e = errors.New("max reflections and max refractions cannot be negative")
+		return
+	}
+
+	if s.Epsilon != nil && *s.Epsilon <= 0.0 {
+		e = errors.New("epsilon must be positive")
+		return
 	}
-	s.ambientLight.Red /= float64(len(s.Lights))
-	s.ambientLight.Green /= float64(len(s.Lights))
-	s.ambientLight.Blue /= float64(len(s.Lights))
 	return
 }
 
+// loadMaterials appends the materials from the materials file, if any, after the inline materials
+// so indices of inline materials are unaffected
+func (s *Scene) loadMaterials() error {
+	if s.MaterialsFile == "" {
+		return nil
+	}
+
+	path := s.MaterialsFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.Directory, path)
+	}
+
+	data, err := yaml.ReadJSON(path)
+	if err != nil {
+		return fmt.Errorf("unable to open materials file: %v", err)
+	}
+
+	var materials []raytracing.Material
+	if err = json.Unmarshal(data, &materials); err != nil {
+		return fmt.Errorf("couldn't unmarshal materials file %s: %v", s.MaterialsFile, err)
+	}
+
+	s.Materials = append(s.Materials, materials...)
+	return nil
+}
+
+// loadObjectFiles loads the files of objects which are generated from them, such as heightmaps
+func (s *Scene) loadObjectFiles() error {
+	for i, obj := range s.Objects {
+		if loader, ok := obj.(object.FileLoader); ok {
+			if err := loader.LoadFile(s.Directory); err != nil {
+				return fmt.Errorf("object %d: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// loadIncludes appends the materials, objects and lights of each included scene file after those of the
+// scene, so indices of the scene's own materials are unaffected. including is the chain of files which
+// included the scene, used to detect cycles
+func (s *Scene) loadIncludes(including []string) error {
+	for _, include := range s.Include {
+		path := include
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(s.Directory, path)
+		}
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("unable to resolve include %s: %v", include, err)
+		}
+
+		chain := append(append([]string{}, including...), path)
+		for _, ancestor := range including {
+			if ancestor == path {
+				return fmt.Errorf("cyclic include: %s", strings.Join(chain, " -> "))
+			}
+		}
+
+		data, err := yaml.ReadJSON(path)
+		if err != nil {
+			return fmt.Errorf("unable to open include: %v", err)
+		}
+
+		included := Scene{}
+		if err = json.Unmarshal(data, &included); err != nil {
+			return fmt.Errorf("couldn't unmarshal include %s: %v", include, err)
+		}
+		included.Directory = filepath.Dir(path)
+		if err = included.loadMaterials(); err != nil {
+			return fmt.Errorf("include %s: %v", include, err)
+		}
+		if err = included.loadObjectFiles(); err != nil {
+			return fmt.Errorf("include %s: %v", include, err)
+		}
+		if err = included.loadIncludes(chain); err != nil {
+			return fmt.Errorf("include %s: %v", include, err)
+		}
+
+		// Textures are loaded relative to the including scene, so the paths of included textures are made absolute
+		for i := range included.Materials {
+			if texture := included.Materials[i].Texture; texture != "" && !filepath.IsAbs(texture) {
+				included.Materials[i].Texture = filepath.Join(included.Directory, texture)
+			}
+		}
+
+		// Materials referenced by index in the included file are shifted to their position in this scene
+		for _, obj := range included.Objects {
+			if resolver, ok := obj.(object.MaterialResolver); ok {
+				resolver.OffsetMaterial(len(s.Materials))
+			}
+		}
+
+		s.Materials = append(s.Materials, included.Materials...)
+		s.Objects = append(s.Objects, included.Objects...)
+		s.Lights = append(s.Lights, included.Lights...)
+	}
+	return nil
+}
+
 // UnmarshalJSON unmarshals a Scene containing a slice of object.Object interfaces
 func (s *Scene) UnmarshalJSON(b []byte) error {
 	type Alias Scene
@@ -50,44 +407,438 @@ func (s *Scene) UnmarshalJSON(b []byte) error {
 		Alias: (*Alias)(s),
 	}
 
+	// Offsets of errors are relative to the scene, so they are nested to be located within the scene file
 	if err := json.Unmarshal(b, &auxiliary); err != nil {
-		return err
+		return raytracing.NestJSONError(b, fmt.Errorf("scene: %w", err))
 	}
 
 	s.Objects = auxiliary.JSONObjects
 	return nil
 }
 
-// FindIntersection finds the closest intersection between the specified ray and the scene.
-// Returns whether an intersection was found, and if so where and with what object index.
-func (s *Scene) FindIntersection(r raytracing.Ray) (bool, float64, int) {
+// Colors seen by reflected rays once the maximum number of reflections is reached
+const (
+	DepthFallbackNone       = "none"
+	DepthFallbackAmbient    = "ambient"
+	DepthFallbackBackground = "background"
+)
+
+// lightSphere is the visible geometry of a light, which is seen by rays but doesn't cast shadows
+type lightSphere struct {
+	object.Sphere
+	color raytracing.Color
+	// light is the index of the light in the scene's lights
+	light int
+}
+
+// defaultFarClip is the furthest distance at which rays intersect objects in scenes which fit well within it
+const defaultFarClip = 20000.0
+
+// radius returns the largest distance from the origin of the bounds of any bounded object, sphere or light,
+// which contains everything but infinite objects such as planes
+func (s *Scene) radius() float64 {
+	radius := 0.0
+	extend := func(min raytracing.Vector, max raytracing.Vector) {
+		furthest := raytracing.Vector{
+			X: math.Max(math.Abs(min.X), math.Abs(max.X)),
+			Y: math.Max(math.Abs(min.Y), math.Abs(max.Y)),
+			Z: math.Max(math.Abs(min.Z), math.Abs(max.Z)),
+		}
+		radius = math.Max(radius, furthest.Magnitude())
+	}
+
+	for _, obj := range s.Objects {
+		switch o := obj.(type) {
+		case object.Sphere:
+			radius = math.Max(radius, o.Center.Magnitude()+o.Radius)
+		case object.Bounded:
+			extend(o.Bounds())
+		}
+	}
+	for _, light := range s.Lights {
+		extend(light.Position, light.Position)
+	}
+	return radius
+}
+
+// DepthLimits returns the maximum numbers of reflections and refractions of rays in the scene, given
+// the maximum number of reflections requested by the renderer. A scene's own maxReflections takes
+// precedence, and refractions are limited to the same number as reflections unless set separately
+func (s *Scene) DepthLimits(maxReflections int) (reflections int, refractions int) {
+	reflections = maxReflections
+	if s.MaxReflections != nil {
+		reflections = *s.MaxReflections
+	}
+	refractions = reflections
+	if s.MaxRefractions != nil {
+		refractions = *s.MaxRefractions
+	}
+	return
+}
+
+// relativeEpsilon is the minimum distance of intersections along rays in proportion to the scale of where they
+// start, unless the scene sets a fixed epsilon. Rounding error in the position of a hit grows with the magnitude
+// of its coordinates and with the distance travelled to it, so a fixed epsilon is too small to prevent acne in
+// large scenes and large enough to miss geometry in tiny ones
+const relativeEpsilon = 1e-12
+
+// epsilonAt returns the minimum distance of intersections along rays starting at position, which was reached
+// by travelling distance along a ray. Hits near the origin have tiny coordinates but not tiny rounding error,
+// which also comes from the coordinates of the objects hit, so the epsilon is never less than the relative
+// epsilon of the scene's overall size
+func (s *Scene) epsilonAt(position raytracing.Vector, distance float64) float64 {
+	if s.Epsilon != nil {
+		return *s.Epsilon
+	}
+	scale := math.Max(distance, math.Max(math.Abs(position.X), math.Max(math.Abs(position.Y), math.Abs(position.Z))))
+	return math.Max(relativeEpsilon*scale, s.minimumEpsilon)
+}
+
+// withEpsilon returns r with the epsilon of its start if it doesn't have one, such as for rays from the camera
+func (s *Scene) withEpsilon(r raytracing.Ray) raytracing.Ray {
+	if r.Epsilon == 0.0 {
+		r.Epsilon = s.epsilonAt(r.Position, 0.0)
+	}
+	return r
+}
+
+// FindIntersection finds the closest intersection between the specified ray and the objects of the scene visible
+// to its kind of ray, up to the far clip. Returns whether an intersection was found, and if so a description of it and the object index.
+func (s *Scene) FindIntersection(r raytracing.Ray) (bool, object.HitInfo, int) {
+	return s.FindIntersectionWithin(r, *s.FarClip)
+}
+
+// FindIntersectionWithin finds the closest intersection between the specified ray and the objects of the scene
+// visible to its kind of ray within maxRange. Returns whether an intersection was found, and if so a description
+// of it and the object index.
+func (s *Scene) FindIntersectionWithin(r raytracing.Ray, maxRange float64) (bool, object.HitInfo, int) {
+	r = s.withEpsilon(r)
 	currentObject := -1
-	t := 20000.0
+	hit := object.HitInfo{Distance: maxRange}
 
-	var intersected bool
-	for i, object := range s.Objects {
-		if intersected, t = object.Intersect(r, t); intersected {
+	for i, obj := range s.Objects {
+		if s.hidden[r.Kind][i] {
+			continue
+		}
+		if intersected, objectHit := obj.Intersect(r, hit.Distance); intersected {
+			hit = objectHit
 			currentObject = i
 		}
 	}
 
-	intersected = (currentObject != -1)
-	return intersected, t, currentObject
+	intersected := (currentObject != -1)
+	return intersected, hit, currentObject
+}
+
+// FindIntersections finds the closest intersection between each of the rays and the scene, returning
+// whether each ray intersected, its hit, and the index of the object hit. Objects implementing
+// object.PacketIntersector intersect all of the rays at once, so the rays must all be the same kind
+func (s *Scene) FindIntersections(rays []raytracing.Ray) ([]bool, []object.HitInfo, []int) {
+	intersected := make([]bool, len(rays))
+	hits := make([]object.HitInfo, len(rays))
+	objects := make([]int, len(rays))
+	for i := range rays {
+		hits[i] = object.HitInfo{Distance: *s.FarClip}
+		objects[i] = -1
+	}
+
+	if len(rays) == 0 {
+		return intersected, hits, objects
+	}
+
+	rays = append([]raytracing.Ray(nil), rays...)
+	for i := range rays {
+		rays[i] = s.withEpsilon(rays[i])
+	}
+
+	packetIntersected := make([]bool, len(rays))
+	for i, obj := range s.Objects {
+		if s.hidden[rays[0].Kind][i] {
+			continue
+		}
+
+		if packet, ok := obj.(object.PacketIntersector); ok {
+			packet.IntersectPacket(rays, hits, packetIntersected)
+			for j, ok := range packetIntersected {
+				if ok {
+					intersected[j], objects[j] = true, i
+				}
+			}
+			continue
+		}
+
+		for j, r := range rays {
+			if ok, objectHit := obj.Intersect(r, hits[j].Distance); ok {
+				intersected[j], hits[j], objects[j] = true, objectHit, i
+			}
+		}
+	}
+
+	return intersected, hits, objects
+}
+
+// Occluded returns whether any object lies between the surface point and the light. The shadow ray
+// uses the normalized light direction, so hit distances can be compared directly to the light's distance.
+// The shadow ray starts epsilon from the surface, and ignores intersections closer than epsilon
+func (s *Scene) Occluded(position raytracing.Vector, normal raytracing.Vector, epsilon float64, light raytracing.VisibleLight) bool {
+	// Offset shadow ray origin to the side of the surface facing the light, to prevent self-shadowing
+	offset := normal.Scale(epsilon)
+	if normal.Dot(light.Direction) < 0.0 {
+		offset = offset.Negative()
+	}
+
+	lightRay := raytracing.Ray{
+		Position:  position.Add(offset),
+		Direction: light.Direction,
+		Kind:      raytracing.ShadowRay,
+		Epsilon:   epsilon,
+	}
+
+	intersected, _, _ := s.FindIntersectionWithin(lightRay, light.Distance)
+	return intersected
+}
+
+// visibleLights returns the lights which reach the start of r, a hit on a surface with the given normal,
+// without being occluded. When the scene sets fewer light samples than it has lights, only that many
+// lights are tested, chosen at random in proportion to their intensity over their distance. Each chosen
+// light is brightened by the inverse of its chance of being chosen, so on average the lighting is
+// unchanged, but each hit sees its own selection of lights, which appears as noise. Whether a diffuse
+// bounce may follow from the hit is given by bounces, see sampleLight. Shadow rays are counted in counts
+func (s *Scene) visibleLights(r raytracing.Ray, normal raytracing.Vector, bounces bool, counts *RayCounts) []raytracing.VisibleLight {
+	visibleLights := []raytracing.VisibleLight{}
+	if s.LightSamples == nil || *s.LightSamples >= len(s.Lights) {
+		for i := range s.Lights {
+			visibleLight, ok := s.sampleLight(r, normal, i, 1.0, bounces)
+			if !ok {
+				continue
+			}
+			counts.Shadow++
+			if !s.Occluded(r.Position, normal, r.Epsilon, visibleLight) {
+				visibleLights = append(visibleLights, visibleLight)
+			}
+		}
+		return visibleLights
+	}
+
+	candidates, cumulative, total := s.lightCandidates(r.Position)
+	if total <= 0.0 {
+		return visibleLights
+	}
+
+	// Each sample is drawn from its own equal slice of the distribution, so the chosen lights are spread
+	// across it rather than clumping on the brightest
+	samples := *s.LightSamples
+	for i := 0; i < samples; i++ {
+		target := total * (float64(i) + r.Random(s.Seed, -3-i)) / float64(samples)
+		chosen := sort.SearchFloat64s(cumulative, target)
+		if chosen == len(candidates) {
+			chosen--
+		}
+
+		probability := (cumulative[chosen] - previous(cumulative, chosen)) / total
+		if probability <= 0.0 {
+			continue
+		}
+		expected := float64(samples) * probability
+		light, ok := s.sampleLight(r, normal, candidates[chosen], expected, bounces)
+		if !ok {
+			continue
+		}
+		counts.Shadow++
+		if s.Occluded(r.Position, normal, r.Epsilon, light) {
+			continue
+		}
+		intensity := light.IntensityScale() / expected
+		light.Intensity = &intensity
+		visibleLights = append(visibleLights, light)
+	}
+	return visibleLights
+}
+
+// lightCandidates returns the indices of the lights which can be sampled directly from position, along with the
+// running total of their chances of being chosen, which are in proportion to their intensity over their distance
+func (s *Scene) lightCandidates(position raytracing.Vector) (candidates []int, cumulative []float64, total float64) {
+	candidates = make([]int, 0, len(s.Lights))
+	cumulative = make([]float64, 0, len(s.Lights))
+	for i, light := range s.Lights {
+		if s.PathTracing && light.Radius != nil && !*s.NextEventEstimation {
+			continue
+		}
+		visibleLight, ok := raytracing.NewVisibleLight(light, position)
+		if !ok {
+			continue
+		}
+		brightest := math.Max(light.Diffuse.Red, math.Max(light.Diffuse.Green, light.Diffuse.Blue)) +
+			math.Max(light.Specular.Red, math.Max(light.Specular.Green, light.Specular.Blue))
+		total += math.Abs(light.IntensityScale()) * brightest / visibleLight.Distance
+		candidates = append(candidates, i)
+		cumulative = append(cumulative, total)
+	}
+	return candidates, cumulative, total
+}
+
+// lightSampleCount returns the number of times the light with the given index is sampled directly from position
+// on average, which is less than one when lights are chosen at random
+func (s *Scene) lightSampleCount(position raytracing.Vector, index int) float64 {
+	if s.LightSamples == nil || *s.LightSamples >= len(s.Lights) {
+		return 1.0
+	}
+
+	candidates, cumulative, total := s.lightCandidates(position)
+	for i, candidate := range candidates {
+		if candidate == index && total > 0.0 {
+			return float64(*s.LightSamples) * (cumulative[i] - previous(cumulative, i)) / total
+		}
+	}
+	return 0.0
 }
 
-// TraceRay traces a given ray to its first intersection and performs lighting calculations
-func (s *Scene) TraceRay(r raytracing.Ray, lightStrength float64, remainingDepth int, lighting raytracing.LightingModel) (color raytracing.Color) {
-	intersected, t, currentObject := s.FindIntersection(r)
+// sampleLight returns the light with the given index as seen from the start of r, a hit on a surface with the given
+// normal, and whether it is seen at all. Point lights are seen in the direction of their position. When path tracing,
+// light spheres are area lights whose radiance is the color they're drawn in. Each sample is a direction chosen
+// uniformly from the cone covered by the sphere, with the light brightened by the solid angle of the cone. When a
+// diffuse bounce may follow, it can reach the sphere too, so the diffuse light of the sample is weighted against the
+// bounce by multiple importance sampling, given that the light is sampled expected times on average. Light spheres
+// aren't sampled if next event estimation is disabled, or from inside them
+func (s *Scene) sampleLight(r raytracing.Ray, normal raytracing.Vector, index int, expected float64, bounces bool) (raytracing.VisibleLight, bool) {
+	light := s.Lights[index]
+	if !s.PathTracing || light.Radius == nil {
+		return raytracing.NewVisibleLight(light, r.Position)
+	}
+	if !*s.NextEventEstimation {
+		return raytracing.VisibleLight{}, false
+	}
+
+	cosMax, solidAngle, ok := lightCone(light, r.Position)
+	if !ok {
+		return raytracing.VisibleLight{}, false
+	}
+	toCenter := light.Position.Subtract(r.Position)
+	axis, _ := toCenter.Normalize()
+	direction := r.RandomConeDirection(s.Seed, index, axis, cosMax)
+
+	// Distance along the direction to the near side of the sphere, where shadow rays stop
+	along := direction.Dot(toCenter)
+	distance := along - math.Sqrt(math.Max(0.0, along*along-toCenter.Dot(toCenter)+*light.Radius**light.Radius))
 
+	if bounces {
+		// The diffuse bounce faces the viewer, and is cosine distributed
+		if r.Direction.Dot(normal) > 0.0 {
+			normal = normal.Negative()
+		}
+		bouncePDF := math.Max(0.0, direction.Dot(normal)) / math.Pi
+		light.Diffuse = light.Diffuse.Scale(powerHeuristic(expected/solidAngle, bouncePDF))
+	}
+	intensity := light.IntensityScale() * solidAngle / math.Pi
+	light.Intensity = &intensity
+	return raytracing.VisibleLight{Light: light, Direction: direction, Distance: distance}, true
+}
+
+// bounceWeight returns the multiple importance sampling weight of the path traced diffuse bounce r from a surface
+// with the given normal facing it, which reached the sphere of the light with the given index, see sampleLight
+func (s *Scene) bounceWeight(r raytracing.Ray, normal raytracing.Vector, index int) float64 {
+	if !*s.NextEventEstimation {
+		return 1.0
+	}
+	_, solidAngle, ok := lightCone(s.Lights[index], r.Position)
+	if !ok {
+		return 1.0
+	}
+	lightPDF := s.lightSampleCount(r.Position, index) / solidAngle
+	return powerHeuristic(r.Direction.Dot(normal)/math.Pi, lightPDF)
+}
+
+// lightCone returns the cosine of the half angle of the cone of directions from position which reach the sphere
+// of a light, and the solid angle of the cone. Returns false if position is inside the sphere
+func lightCone(light raytracing.Light, position raytracing.Vector) (cosMax float64, solidAngle float64, ok bool) {
+	distance := light.Position.Subtract(position).Magnitude()
+	if distance <= *light.Radius {
+		return 0.0, 0.0, false
+	}
+	sine := *light.Radius / distance
+	cosMax = math.Sqrt(1.0 - sine*sine)
+	// 1 - cosMax, without losing precision for small cones
+	return cosMax, 2.0 * math.Pi * sine * sine / (1.0 + cosMax), true
+}
+
+// powerHeuristic returns the multiple importance sampling weight of a sample drawn with the probability density pdf,
+// when it could also have been drawn by another strategy with the probability density other
+func powerHeuristic(pdf float64, other float64) float64 {
+	return pdf * pdf / (pdf*pdf + other*other)
+}
+
+// previous returns the cumulative total before index i, which is zero for the first
+func previous(cumulative []float64, i int) float64 {
+	if i == 0 {
+		return 0.0
+	}
+	return cumulative[i-1]
+}
+
+// TraceRay traces a given ray to its first intersection and performs lighting calculations. The secondary
+// rays traced are added to counts, unless it is nil, which mustn't be shared with other goroutines. Rays are
+// reflected at most remainingDepth times and refracted at most remainingRefractions times, see DepthLimits
+func (s *Scene) TraceRay(r raytracing.Ray, lightStrength float64, remainingDepth int, remainingRefractions int, lighting raytracing.LightingModel, counts *RayCounts) (color raytracing.Color) {
+	counts = counts.begin(remainingDepth + remainingRefractions)
+	defer counts.end()
+
+	intersected, hit, currentObject := s.FindIntersection(r)
+	return s.shade(r, intersected, hit, currentObject, lightStrength, remainingDepth, remainingRefractions, lighting, *s.GlossySamples, counts)
+}
+
+// TraceHit performs lighting calculations for a ray whose first intersection has already been found,
+// such as by FindIntersections. The secondary rays traced are added to counts, unless it is nil, which
+// mustn't be shared with other goroutines
+func (s *Scene) TraceHit(r raytracing.Ray, intersected bool, hit object.HitInfo, currentObject int, lightStrength float64, remainingDepth int, remainingRefractions int, lighting raytracing.LightingModel, counts *RayCounts) raytracing.Color {
+	counts = counts.begin(remainingDepth + remainingRefractions)
+	defer counts.end()
+
+	return s.shade(r, intersected, hit, currentObject, lightStrength, remainingDepth, remainingRefractions, lighting, *s.GlossySamples, counts)
+}
+
+// traceRay traces a secondary ray like TraceRay, tracing glossySamples rays for reflections from rough materials
+func (s *Scene) traceRay(r raytracing.Ray, lightStrength float64, remainingDepth int, remainingRefractions int, lighting raytracing.LightingModel, glossySamples int, counts *RayCounts) raytracing.Color {
+	counts.bounce(remainingDepth + remainingRefractions)
+	intersected, hit, currentObject := s.FindIntersection(r)
+	return s.shade(r, intersected, hit, currentObject, lightStrength, remainingDepth, remainingRefractions, lighting, glossySamples, counts)
+}
+
+// shade performs lighting calculations for the first intersection of a ray, and traces its reflections
+func (s *Scene) shade(r raytracing.Ray, intersected bool, hit object.HitInfo, currentObject int, lightStrength float64, remainingDepth int, remainingRefractions int, lighting raytracing.LightingModel, glossySamples int, counts *RayCounts) raytracing.Color {
+	if light, ok := s.lightHit(r, intersected, hit); ok {
+		return light.color.Scale(lightStrength)
+	}
+	return s.shadeSurface(r, intersected, hit, currentObject, lightStrength, remainingDepth, remainingRefractions, lighting, glossySamples, counts)
+}
+
+// shadeSurface is shade, but without seeing visible lights in front of the intersection
+func (s *Scene) shadeSurface(r raytracing.Ray, intersected bool, hit object.HitInfo, currentObject int, lightStrength float64, remainingDepth int, remainingRefractions int, lighting raytracing.LightingModel, glossySamples int, counts *RayCounts) (color raytracing.Color) {
 	if !intersected {
+		if s.Skybox != nil {
+			color = s.Skybox.sample(r.Direction).Scale(lightStrength)
+		}
 		return
 	}
 
-	scaled := r.Direction.Scale(t)
-	intersection := r.Position.Add(scaled)
+	intersection := hit.Position
 	r.Position = intersection
-	normal := s.Objects[currentObject].SurfaceNormal(r)
-	material := s.Materials[s.Objects[currentObject].MaterialID()]
+	r.Epsilon = s.epsilonAt(intersection, hit.Distance)
+	normal := hit.Normal
+	material := s.Materials[s.Objects[currentObject].MaterialID()].Textured(hit.U, hit.V).Patterned(intersection)
+	if modifier, ok := s.Objects[currentObject].(object.MaterialModifier); ok {
+		material = modifier.ModifyMaterial(material, hit)
+	}
+
+	if hit.BackFace && material.Absorption != (raytracing.Color{}) {
+		// The ray travelled inside the object to reach the back of its surface, absorbing light on the way
+		transmission := material.Transmission(hit.Distance)
+		defer func() { color = color.Multiply(transmission) }()
+	}
+
+	if material.Bump != nil {
+		normal = material.Bump.Perturb(normal, intersection)
+	}
+	material = material.Graded(intersection, normal).Worn(intersection)
 
 	viewer := r.Direction.Negative()
 	var ok bool
@@ -96,38 +847,240 @@ func (s *Scene) TraceRay(r raytracing.Ray, lightStrength float64, remainingDepth
 		return
 	}
 
-	visibleLights := []raytracing.Light{}
-	for _, light := range s.Lights {
-		lightRay := raytracing.Ray{
-			Position:  intersection,
-			Direction: light.Position.Subtract(intersection),
+	if material.Unlit {
+		return s.shadeUnlit(r, normal, material, lightStrength, remainingDepth, remainingRefractions, lighting, glossySamples, counts)
+	}
+
+	// Lights are sampled directly at every hit, which is next event estimation when path tracing. Diffuse bounces
+	// follow from the hit unless the maximum number of reflections is reached, and can reach light spheres too
+	visibleLights := s.visibleLights(r, normal, s.PathTracing && remainingDepth > 0, counts)
+
+	reflectance := math.Min(material.ReflectanceAt(viewer.Dot(normal)), 1.0)
+
+	// Light not reflected or transmitted is available for local shading, so outgoing energy is conserved
+	surfaceStrength := lightStrength * (1.0 - reflectance) * (1.0 - material.Transmittance) * *s.Brightness
+
+	ambientLight := s.ambientLight
+	if s.PathTracing {
+		// Traced diffuse bounces replace the ambient approximation of indirect light
+		ambientLight = raytracing.Color{}
+	}
+
+	surfaceColor := lighting(visibleLights, ambientLight, viewer, intersection, normal, material)
+	color = surfaceColor.Scale(surfaceStrength)
+
+	if material.Transmittance > 0.0 {
+		refractedStrength := lightStrength * (1.0 - reflectance) * material.Transmittance
+		color = color.Add(s.traceRefraction(r, normal, material, refractedStrength, remainingDepth, remainingRefractions, lighting, glossySamples, counts))
+	}
+
+	r.Direction, _ = r.Direction.Reflect(normal).Normalize()
+	r.Kind = raytracing.ReflectedRay
+
+	if !s.PathTracing {
+		return color.Add(s.traceReflection(r, normal, material.Roughness, lightStrength*reflectance, remainingDepth, remainingRefractions, false, lighting, glossySamples, counts))
+	}
+
+	// Follow a single path, continuing as either the reflection or a diffuse bounce in proportion to the
+	// reflectance. Each is then weighted as if it were the only continuation, so the average is unchanged
+	if r.Random(s.Seed, -2) < reflectance {
+		return color.Add(s.traceReflection(r, normal, material.Roughness, lightStrength, remainingDepth, remainingRefractions, false, lighting, glossySamples, counts))
+	}
+
+	if viewer.Dot(normal) < 0.0 {
+		normal = normal.Negative()
+	}
+	// Transmitted light is already carried by the refraction, so only the rest is diffusely reflected. Brightness
+	// isn't applied here, as the surfaces the bounce reaches already apply it to their own lit color
+	diffuseStrength := lightStrength * (1.0 - material.Transmittance)
+	return color.Add(s.traceDiffuse(r, normal, material.Diffuse, diffuseStrength, remainingDepth, remainingRefractions, lighting, counts))
+}
+
+// shadeUnlit returns the diffuse color of an unlit material, which is seen without any lighting so no shadow
+// rays are traced, plus its reflection if it is reflective. Fresnel and transmittance don't apply
+func (s *Scene) shadeUnlit(r raytracing.Ray, normal raytracing.Vector, material raytracing.Material, lightStrength float64, remainingDepth int, remainingRefractions int, lighting raytracing.LightingModel, glossySamples int, counts *RayCounts) raytracing.Color {
+	reflectance := math.Min(material.Reflectance, 1.0)
+	color := material.Diffuse.Scale(lightStrength * (1.0 - reflectance))
+	if reflectance <= 0.0 {
+		return color
+	}
+
+	r.Direction, _ = r.Direction.Reflect(normal).Normalize()
+	r.Kind = raytracing.ReflectedRay
+	return color.Add(s.traceReflection(r, normal, material.Roughness, lightStrength*reflectance, remainingDepth, remainingRefractions, false, lighting, glossySamples, counts))
+}
+
+// lightHit returns the closest visible light hit by r in front of its first intersection, if any
+func (s *Scene) lightHit(r raytracing.Ray, intersected bool, hit object.HitInfo) (lightSphere, bool) {
+	maxRange := *s.FarClip
+	if intersected {
+		maxRange = hit.Distance
+	}
+	r = s.withEpsilon(r)
+
+	var closest lightSphere
+	found := false
+	for _, light := range s.lightSpheres {
+		if ok, lightHit := light.Intersect(r, maxRange); ok {
+			maxRange = lightHit.Distance
+			closest = light
+			found = true
 		}
+	}
+	return closest, found
+}
 
-		intersected, distance, _ := s.FindIntersection(lightRay)
-		if !intersected {
-			visibleLights = append(visibleLights, light)
-		} else if distance >= 1.0 {
-			visibleLights = append(visibleLights, light)
+// traceRefraction traces the refraction of r through a transparent surface with the given normal. When the
+// material disperses light and r carries every color, each channel is refracted separately by its own index
+func (s *Scene) traceRefraction(r raytracing.Ray, normal raytracing.Vector, material raytracing.Material, lightStrength float64, remainingDepth int, remainingRefractions int, lighting raytracing.LightingModel, glossySamples int, counts *RayCounts) raytracing.Color {
+	if material.Dispersion != 0.0 && r.Channel == raytracing.AllChannels {
+		var color raytracing.Color
+		for _, channel := range []raytracing.Channel{raytracing.RedChannel, raytracing.GreenChannel, raytracing.BlueChannel} {
+			r.Channel = channel
+			color = color.Add(s.traceRefraction(r, normal, material, lightStrength, remainingDepth, remainingRefractions, lighting, glossySamples, counts).Isolate(channel))
 		}
+		return color
 	}
 
-	surfaceColor := lighting(visibleLights, s.ambientLight, viewer, intersection, normal, material)
-	color.Red += surfaceColor.Red * lightStrength
-	color.Green += surfaceColor.Green * lightStrength
-	color.Blue += surfaceColor.Blue * lightStrength
+	direction, ok := r.Direction.Normalize()
+	if !ok {
+		return raytracing.Color{}
+	}
 
-	// Reflect direction of light ray across normal
-	reflect := 2.0 * r.Direction.Dot(normal)
-	r.Direction = r.Direction.Subtract(normal.Scale(reflect))
-	r.Direction, _ = r.Direction.Normalize()
+	// Rays pass into the object from the medium they travel through, and when leaving it pass back out into
+	// the medium around it, such as the glass of an outer object for objects nested inside it
+	index := material.RefractiveIndexOf(r.Channel)
+	entering := direction.Dot(normal) <= 0.0
+	eta := r.MediumIndex() / index
+	if !entering {
+		eta = index / r.OuterIndex()
+		normal = normal.Negative()
+	}
+
+	if r.Direction, ok = direction.Refract(normal, eta); !ok {
+		// Total internal reflection
+		r.Direction = direction.Reflect(normal)
+	} else if entering {
+		r.Enter(index)
+	} else {
+		r.Leave()
+	}
+	r.Kind = raytracing.ReflectedRay
+	return s.traceReflection(r, normal, 0.0, lightStrength, remainingDepth, remainingRefractions, true, lighting, glossySamples, counts)
+}
+
+// traceReflection traces the reflected or refracted ray r, which has the given strength, from a surface with the given normal
+// and roughness. A refracted ray uses up one of the remaining refractions and is counted in counts.Refracted, otherwise it
+// uses up one of the remaining reflections and is counted in counts.Reflected. Once those run out the depth fallback is
+// used instead
+func (s *Scene) traceReflection(r raytracing.Ray, normal raytracing.Vector, roughness float64, lightStrength float64, remainingDepth int, remainingRefractions int, refracted bool, lighting raytracing.LightingModel, glossySamples int, counts *RayCounts) raytracing.Color {
+	lightStrength, ok := s.roulette(r, lightStrength)
+	if !ok {
+		return raytracing.Color{}
+	}
+
+	remaining, count := &remainingDepth, &counts.Reflected
+	if refracted {
+		remaining, count = &remainingRefractions, &counts.Refracted
+	}
+
+	if *remaining <= 0 {
+		if lightStrength > 0.0 {
+			return s.depthFallback(r.Direction).Scale(lightStrength)
+		}
+		return raytracing.Color{}
+	}
+	*remaining--
+
+	if roughness > 0.0 {
+		*count += int64(glossySamples)
+		return s.traceGlossy(r, normal, roughness, lightStrength, remainingDepth, remainingRefractions, lighting, glossySamples, counts)
+	}
+	*count++
+	return s.traceRay(r, lightStrength, remainingDepth, remainingRefractions, lighting, glossySamples, counts)
+}
+
+// traceDiffuse traces a diffuse bounce from the start of r in a random direction about the normal, returning the
+// light it carries reflected by the diffuse color. Cosine weighting the direction matches Lambertian reflection,
+// so the light needs no further weighting, except that light spheres reached by the bounce are also sampled
+// directly, and their light is weighted against that by multiple importance sampling, see sampleLight
+func (s *Scene) traceDiffuse(r raytracing.Ray, normal raytracing.Vector, diffuse raytracing.Color, lightStrength float64, remainingDepth int, remainingRefractions int, lighting raytracing.LightingModel, counts *RayCounts) raytracing.Color {
+	// Rays are only as strong as the most reflective channel, then brightened per channel to match the diffuse color
+	albedo := math.Max(diffuse.Red, math.Max(diffuse.Green, diffuse.Blue))
+	if albedo <= 0.0 {
+		return raytracing.Color{}
+	}
+
+	r.Direction = r.RandomCosineDirection(s.Seed, 0, normal)
+	lightStrength, ok := s.roulette(r, lightStrength*albedo)
+	if !ok {
+		return raytracing.Color{}
+	}
 
-	var reflectedColor raytracing.Color
+	var incoming raytracing.Color
 	if remainingDepth > 0 {
-		reflectedColor = s.TraceRay(r, lightStrength*material.Reflectance, remainingDepth-1, lighting)
+		counts.Diffuse++
+		counts.bounce(remainingDepth - 1 + remainingRefractions)
+		intersected, hit, currentObject := s.FindIntersection(r)
+		if light, ok := s.lightHit(r, intersected, hit); ok {
+			// The light reaching the surface is part of its lit color, so it is brightened like direct light
+			strength := lightStrength * *s.Brightness * s.bounceWeight(r, normal, light.light)
+			incoming = light.color.Scale(strength)
+		} else {
+			incoming = s.shadeSurface(r, intersected, hit, currentObject, lightStrength, remainingDepth-1, remainingRefractions, lighting, 1, counts)
+		}
+	} else {
+		incoming = s.depthFallback(r.Direction).Scale(lightStrength)
 	}
+	return incoming.Multiply(diffuse).Scale(1.0 / albedo)
+}
 
-	color.Red = color.Red + reflectedColor.Red
-	color.Green = color.Green + reflectedColor.Green
-	color.Blue = color.Blue + reflectedColor.Blue
-	return
+// roulette terminates rays weaker than the roulette threshold at random, and compensates surviving rays for
+// those terminated. Returns the strength of r, and whether it survived
+func (s *Scene) roulette(r raytracing.Ray, lightStrength float64) (float64, bool) {
+	if lightStrength >= s.RouletteThreshold {
+		return lightStrength, true
+	}
+
+	survival := lightStrength / s.RouletteThreshold
+	if r.Random(s.Seed, -1) >= survival {
+		return 0.0, false
+	}
+	return lightStrength / survival, true
+}
+
+// depthFallback returns the color seen in place of a reflection in direction once the maximum number of
+// reflections is reached, which smooths the cutoff compared to black
+func (s *Scene) depthFallback(direction raytracing.Vector) raytracing.Color {
+	switch s.DepthFallback {
+	case DepthFallbackAmbient:
+		return s.ambientLight
+	case DepthFallbackBackground:
+		if s.Skybox != nil {
+			return s.Skybox.sample(direction)
+		}
+	}
+	return raytracing.Color{}
+}
+
+// traceGlossy averages samples of the reflected ray r randomly perturbed within a cone around the mirror
+// direction, whose width is set by the roughness. Further reflections of each sample only use a single
+// sample, so the number of rays doesn't grow exponentially with depth
+func (s *Scene) traceGlossy(r raytracing.Ray, normal raytracing.Vector, roughness float64, lightStrength float64, remainingDepth int, remainingRefractions int, lighting raytracing.LightingModel, samples int, counts *RayCounts) raytracing.Color {
+	side := r.Direction.Dot(normal)
+
+	colors := make([]raytracing.Color, 0, samples)
+	for i := 0; i < samples; i++ {
+		sample := r
+
+		// Perturbed rays must stay on the same side of the surface as the mirror reflection
+		perturbation := r.RandomInUnitSphere(s.Seed, i).Scale(roughness)
+		if direction, ok := r.Direction.Add(perturbation).Normalize(); ok && direction.Dot(normal)*side > 0.0 {
+			sample.Direction = direction
+		}
+
+		colors = append(colors, s.traceRay(sample, lightStrength, remainingDepth, remainingRefractions, lighting, 1, counts))
+	}
+
+	return raytracing.AverageColors(colors)
 }
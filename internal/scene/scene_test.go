@@ -0,0 +1,631 @@
+package scene
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+// loadScene unmarshals and initializes a scene from JSON
+func loadScene(t *testing.T, data string) *Scene {
+	t.Helper()
+	s := &Scene{}
+	if err := json.Unmarshal([]byte(data), s); err != nil {
+		t.Fatalf("couldn't unmarshal scene: %v", err)
+	}
+	if err := s.Initialize(); err != nil {
+		t.Fatalf("couldn't initialize scene: %v", err)
+	}
+	return s
+}
+
+func TestPathTracedTransparentMaterialConservesEnergy(t *testing.T) {
+	// A fully transparent sphere with no bending passes every ray straight through into the empty sky, so
+	// nothing is seen through it. Diffuse bounces from its surface would pick up light from the lit plane
+	s := loadScene(t, `{
+		"pathTracing": true,
+		"materials": [
+			{"diffuse": {"red": 1, "green": 1, "blue": 1}, "transmittance": 1, "refractiveIndex": 1},
+			{"diffuse": {"red": 1, "green": 1, "blue": 1}}
+		],
+		"lights": [{"position": {"x": 0, "y": 5, "z": -3}, "diffuse": {"red": 1, "green": 1, "blue": 1}}],
+		"objects": [
+			{"type": "sphere", "center": {"x": 0, "y": 1, "z": 0}, "radius": 1, "material": 0},
+			{"type": "plane", "point": {"x": 0, "y": 0, "z": 0}, "normal": {"x": 0, "y": 1, "z": 0}, "material": 1}
+		]
+	}`)
+
+	for i := 0; i < 16; i++ {
+		r := raytracing.Ray{
+			Position:  raytracing.Vector{X: -0.5 + float64(i)/16.0, Y: 1, Z: -5},
+			Direction: raytracing.Vector{X: 0, Y: 0, Z: 1},
+			Kind:      raytracing.CameraRay,
+		}
+		color := s.TraceRay(r, 1.0, 4, 4, raytracing.LambertianLighting, nil)
+		if color != (raytracing.Color{}) {
+			t.Fatalf("ray %d through transparent sphere saw %v, want black", i, color)
+		}
+	}
+}
+
+func TestPathTracedBrightness(t *testing.T) {
+	// Light bounces between a floor and a wall, so path traced rays pick up indirect light. Brightness scales each
+	// surface's lit color once, wherever along the path it is seen, so doubling it exactly doubles every ray
+	scene := func(brightness float64) *Scene {
+		return loadScene(t, fmt.Sprintf(`{
+			"pathTracing": true,
+			"brightness": %v,
+			"rouletteThreshold": 0.5,
+			"materials": [
+				{"diffuse": {"red": 0.8, "green": 0.8, "blue": 0.8}},
+				{"diffuse": {"red": 0.9, "green": 0.3, "blue": 0.2}}
+			],
+			"lights": [{"position": {"x": -2, "y": 5, "z": 0}, "diffuse": {"red": 1, "green": 1, "blue": 1}, "ambient": {"red": 0.2, "green": 0.2, "blue": 0.2}}],
+			"objects": [
+				{"type": "plane", "point": {"x": 0, "y": 0, "z": 0}, "normal": {"x": 0, "y": 1, "z": 0}, "material": 0},
+				{"type": "plane", "point": {"x": 1, "y": 0, "z": 0}, "normal": {"x": -1, "y": 0, "z": 0}, "material": 1}
+			]
+		}`, brightness))
+	}
+	dim, bright := scene(1.0), scene(2.0)
+
+	indirect := false
+	for i := 0; i < 32; i++ {
+		r := raytracing.Ray{
+			Position:  raytracing.Vector{X: -1 + float64(i)/16.0, Y: 1, Z: -5},
+			Direction: raytracing.Vector{X: 0, Y: -1, Z: 5},
+			Kind:      raytracing.CameraRay,
+		}
+		dimColor := dim.TraceRay(r, 1.0, 4, 4, raytracing.LambertianLighting, nil)
+		if brightColor := bright.TraceRay(r, 1.0, 4, 4, raytracing.LambertianLighting, nil); brightColor != dimColor.Scale(2.0) {
+			t.Errorf("ray %d: brightness 2 traced %v, want exactly twice %v", i, brightColor, dimColor)
+		}
+		if dimColor != dim.TraceRay(r, 1.0, 0, 4, raytracing.LambertianLighting, nil) {
+			indirect = true
+		}
+	}
+	if !indirect {
+		t.Errorf("no ray picked up indirect light")
+	}
+}
+
+func TestNextEventEstimationConverges(t *testing.T) {
+	// A white floor under light spheres, with nothing else for diffuse bounces to reach. The light above the
+	// origin covers a cone of half angle theta, so the origin of the floor is lit to 0.8 sin^2(theta)
+	above := `{"position": {"x": 0, "y": 2, "z": 0}, "radius": 1, "diffuse": {"red": 1, "green": 1, "blue": 1}}`
+	small := `{"position": {"x": 0, "y": 2, "z": 0}, "radius": 0.25, "diffuse": {"red": 1, "green": 1, "blue": 1}}`
+	beside := `{"position": {"x": 3, "y": 2, "z": 0}, "radius": 1, "diffuse": {"red": 1, "green": 1, "blue": 1}}`
+	point := `{"position": {"x": 0, "y": 5, "z": 0}, "diffuse": {"red": 1, "green": 1, "blue": 1}}`
+
+	tests := []struct {
+		name         string
+		lights       string
+		lightSamples string
+		// want is the exact color of the floor, or zero if it is only compared between the estimates
+		want float64
+	}{
+		{"light above", above, "null", 0.8 / 4.0},
+		{"small light", small, "null", 0.8 / 64.0},
+		{"light and point light", above + ", " + point, "null", 0.8/4.0 + 0.8},
+		{"two lights", above + ", " + beside, "null", 0.0},
+		{"two lights, one sampled", above + ", " + beside, "1", 0.0},
+	}
+
+	const samples = 20000
+	for _, test := range tests {
+		s := loadScene(t, fmt.Sprintf(`{
+			"pathTracing": true,
+			"lightSamples": %s,
+			"materials": [{"diffuse": {"red": 0.8, "green": 0.8, "blue": 0.8}}],
+			"lights": [%s],
+			"objects": [
+				{"type": "plane", "point": {"x": 0, "y": 0, "z": 0}, "normal": {"x": 0, "y": 1, "z": 0}, "material": 0}
+			]
+		}`, test.lightSamples, test.lights))
+
+		// estimate returns the mean color of the origin of the floor, seen from many directions, and its standard error
+		estimate := func(nextEventEstimation bool, maxReflections int) (float64, float64) {
+			s.NextEventEstimation = &nextEventEstimation
+			sum, squares := 0.0, 0.0
+			for i := 0; i < samples; i++ {
+				position := raytracing.Vector{X: -5 + 10*float64(i)/samples, Y: 1, Z: -5}
+				direction, _ := position.Negative().Normalize()
+				r := raytracing.Ray{Position: position, Direction: direction, Kind: raytracing.CameraRay}
+				color := s.TraceRay(r, 1.0, maxReflections, 0, raytracing.LambertianLighting, nil)
+				sum += color.Red
+				squares += color.Red * color.Red
+			}
+			mean := sum / samples
+			return mean, math.Sqrt((squares/samples - mean*mean) / samples)
+		}
+
+		bruteForce, bruteForceError := estimate(false, 1)
+		weighted, weightedError := estimate(true, 1)
+		direct, directError := estimate(true, 0)
+
+		// Both estimates converge to the same color, without counting any light twice
+		if difference := math.Abs(bruteForce - weighted); difference > 4.0*math.Hypot(bruteForceError, weightedError) {
+			t.Errorf("%s: brute force is %v ± %v, next event estimation is %v ± %v", test.name, bruteForce, bruteForceError, weighted, weightedError)
+		}
+		// Without a bounce to weight it against, sampling the lights directly must light the floor by itself
+		if difference := math.Abs(direct - weighted); difference > 4.0*math.Hypot(directError, weightedError) {
+			t.Errorf("%s: without bounces is %v ± %v, with bounces is %v ± %v", test.name, direct, directError, weighted, weightedError)
+		}
+		if test.want != 0.0 && math.Abs(weighted-test.want) > 4.0*weightedError+1e-9 {
+			t.Errorf("%s: next event estimation is %v ± %v, want %v", test.name, weighted, weightedError, test.want)
+		}
+		if weightedError > bruteForceError/2.0 {
+			t.Errorf("%s: next event estimation has standard error %v, brute force %v", test.name, weightedError, bruteForceError)
+		}
+	}
+}
+
+func TestRefractionTotalInternalReflection(t *testing.T) {
+	// Rays inside the glass below the plane meet its surface, and a light sphere lies along their reflection.
+	// Above the critical angle of 41.8 degrees they reflect into the light, below it they refract out into
+	// the empty sky
+	s := loadScene(t, `{
+		"materials": [{"transmittance": 1, "refractiveIndex": 1.5}],
+		"lights": [{"position": {"x": 0, "y": -2, "z": 0}, "radius": 0.5, "diffuse": {"red": 1, "green": 1, "blue": 1}}],
+		"objects": [
+			{"type": "plane", "point": {"x": 0, "y": 0, "z": 0}, "normal": {"x": 0, "y": 1, "z": 0}, "material": 0}
+		]
+	}`)
+	light := raytracing.Color{Red: 1, Green: 1, Blue: 1}
+
+	tests := []struct {
+		angle     float64
+		reflected bool
+	}{
+		{20.0, false},
+		{45.0, true},
+		{60.0, true},
+		{80.0, true},
+	}
+	for _, test := range tests {
+		radians := test.angle * math.Pi / 180.0
+		direction := raytracing.Vector{X: math.Sin(radians), Y: math.Cos(radians), Z: 0}
+		// The ray reaches the surface at x = -2 tan(angle), so its reflection passes through the light
+		r := raytracing.Ray{
+			Position:  raytracing.Vector{X: -3.0 * math.Tan(radians), Y: -1, Z: 0},
+			Direction: direction,
+			Kind:      raytracing.CameraRay,
+		}
+
+		color := s.TraceRay(r, 1.0, 4, 4, raytracing.LambertianLighting, nil)
+		if math.IsNaN(color.Red) || math.IsNaN(color.Green) || math.IsNaN(color.Blue) {
+			t.Fatalf("at %v degrees, color %v is NaN", test.angle, color)
+		}
+
+		want := raytracing.Color{}
+		if test.reflected {
+			want = light
+		}
+		if color != want {
+			t.Errorf("at %v degrees, saw %v, want %v", test.angle, color, want)
+		}
+	}
+}
+
+func TestTwoSidedPlaneLitFromBehind(t *testing.T) {
+	// The light and the viewer are both below the plane, whose normal faces up
+	for _, twoSided := range []bool{false, true} {
+		s := loadScene(t, fmt.Sprintf(`{
+			"materials": [{"diffuse": {"red": 1, "green": 1, "blue": 1}}],
+			"lights": [{"position": {"x": 0, "y": -3, "z": 0}, "diffuse": {"red": 1, "green": 1, "blue": 1}}],
+			"objects": [
+				{"type": "plane", "point": {"x": 0, "y": 0, "z": 0}, "normal": {"x": 0, "y": 1, "z": 0}, "twoSided": %v, "material": 0}
+			]
+		}`, twoSided))
+
+		r := raytracing.Ray{
+			Position:  raytracing.Vector{X: 1, Y: -2, Z: 0},
+			Direction: raytracing.Vector{X: 0, Y: 1, Z: 0},
+			Kind:      raytracing.CameraRay,
+		}
+		color := s.TraceRay(r, 1.0, 4, 4, raytracing.LambertianLighting, nil)
+		if lit := color != (raytracing.Color{}); lit != twoSided {
+			t.Errorf("two-sided %v: plane seen from behind is %v", twoSided, color)
+		}
+	}
+}
+
+func TestInvalidMaterialIDs(t *testing.T) {
+	tests := []struct {
+		name      string
+		materials string
+		material  int
+		want      string
+	}{
+		{"too large", `[{}, {}]`, 2, "invalid material id 2 in object 1 (sphere), must be between 0 and 1"},
+		{"negative", `[{}, {}]`, -1, "invalid material id -1 in object 1 (sphere), must be between 0 and 1"},
+		{"no materials", `[]`, 0, "scene has objects but no materials"},
+	}
+	for _, test := range tests {
+		s := &Scene{}
+		data := fmt.Sprintf(`{
+			"materials": %s,
+			"objects": [
+				{"type": "plane", "point": {"x": 0, "y": 0, "z": 0}, "normal": {"x": 0, "y": 1, "z": 0}, "material": 0},
+				{"type": "sphere", "center": {"x": 0, "y": 1, "z": 0}, "radius": 1, "material": %d}
+			]
+		}`, test.materials, test.material)
+		if err := json.Unmarshal([]byte(data), s); err != nil {
+			t.Fatalf("%s: couldn't unmarshal scene: %v", test.name, err)
+		}
+		if err := s.Initialize(); err == nil || err.Error() != test.want {
+			t.Errorf("%s: Initialize returned %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestNamedMaterials(t *testing.T) {
+	// Inline materials come before named ones, which objects reference by name so the index they resolve to
+	// follows the material and not its position
+	const data = `{
+		"materials": [%s
+			{"name": "red", "diffuse": {"red": 1, "green": 0, "blue": 0}},
+			{"name": "blue", "diffuse": {"red": 0, "green": 0, "blue": 1}}
+		],
+		"objects": [
+			{"type": "sphere", "center": {"x": 0, "y": 1, "z": 0}, "radius": 1, "material": "blue"},
+			{"type": "sphere", "center": {"x": 3, "y": 1, "z": 0}, "radius": 1, "material": "red"},
+			{"type": "sphere", "center": {"x": 6, "y": 1, "z": 0}, "radius": 1, "material": 0}
+		]
+	}`
+	for _, inserted := range []int{0, 2} {
+		s := loadScene(t, fmt.Sprintf(data, strings.Repeat(`{},`, inserted)))
+		for i, want := range []int{inserted + 1, inserted, 0} {
+			if got := s.Objects[i].MaterialID(); got != want {
+				t.Errorf("%d materials inserted: object %d has material %d, want %d", inserted, i, got, want)
+			}
+		}
+	}
+
+	tests := []struct {
+		name      string
+		materials string
+		material  string
+		want      string
+	}{
+		{"missing", `[{"name": "red"}]`, `"blue"`, `object 0: material "blue" is not defined, materials must have a matching "name" to be referenced by name`},
+		{"unnamed", `[{}]`, `"red"`, `object 0: material "red" is not defined, materials must have a matching "name" to be referenced by name`},
+		{"duplicate", `[{"name": "red"}, {"name": "red"}]`, `"red"`, `duplicate material name "red"`},
+	}
+	for _, test := range tests {
+		s := &Scene{}
+		data := fmt.Sprintf(`{
+			"materials": %s,
+			"objects": [{"type": "sphere", "center": {"x": 0, "y": 1, "z": 0}, "radius": 1, "material": %s}]
+		}`, test.materials, test.material)
+		if err := json.Unmarshal([]byte(data), s); err != nil {
+			t.Fatalf("%s: couldn't unmarshal scene: %v", test.name, err)
+		}
+		if err := s.Initialize(); err == nil || err.Error() != test.want {
+			t.Errorf("%s: Initialize returned %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestOcclusionAtLightDistances(t *testing.T) {
+	// A light directly above the origin of the floor, with a small sphere either between them or beyond the light
+	tests := []struct {
+		lightHeight, blockerHeight float64
+		occluded                   bool
+	}{
+		{0.5, 0.25, true},
+		{0.5, 0.75, false},
+		{1.0, 0.5, true},
+		{1.0, 1.5, false},
+		{3.0, 2.9, true},
+		{3.0, 3.1, false},
+		{100.0, 1.0, true},
+		{100.0, 99.0, true},
+		{100.0, 101.0, false},
+	}
+	for _, test := range tests {
+		s := loadScene(t, fmt.Sprintf(`{
+			"materials": [{"diffuse": {"red": 1, "green": 1, "blue": 1}, "specular": {"red": 0, "green": 0, "blue": 0}}],
+			"lights": [{"position": {"x": 0, "y": %v, "z": 0}, "diffuse": {"red": 1, "green": 1, "blue": 1}}],
+			"objects": [
+				{"type": "plane", "point": {"x": 0, "y": 0, "z": 0}, "normal": {"x": 0, "y": 1, "z": 0}, "material": 0},
+				{"type": "sphere", "center": {"x": 0, "y": %v, "z": 0}, "radius": 0.01, "material": 0}
+			]
+		}`, test.lightHeight, test.blockerHeight))
+
+		position := raytracing.Vector{X: 0, Y: 0, Z: 0}
+		normal := raytracing.Vector{X: 0, Y: 1, Z: 0}
+		light, ok := raytracing.NewVisibleLight(s.Lights[0], position)
+		if !ok {
+			t.Fatalf("light at height %v has no direction", test.lightHeight)
+		}
+		if light.Distance != test.lightHeight {
+			t.Errorf("light at height %v is %v away", test.lightHeight, light.Distance)
+		}
+		if occluded := s.Occluded(position, normal, s.epsilonAt(position, 0.0), light); occluded != test.occluded {
+			t.Errorf("light at height %v, blocker at %v: occluded is %v, want %v", test.lightHeight, test.blockerHeight, occluded, test.occluded)
+		}
+	}
+}
+
+func TestLightingDoesNotFallOff(t *testing.T) {
+	// Lights don't fall off with distance, so a floor lit from directly above is equally bright at every height,
+	// and a light at an angle lights it by the cosine of the angle alone
+	tests := []struct {
+		x, height float64
+		want      float64
+	}{
+		{0, 0.5, 1.0},
+		{0, 2, 1.0},
+		{0, 50, 1.0},
+		{0, 5000, 1.0},
+		{1, 1, math.Sqrt(0.5)},
+		{10, 10, math.Sqrt(0.5)},
+		{1000, 1000, math.Sqrt(0.5)},
+	}
+	for _, test := range tests {
+		s := loadScene(t, fmt.Sprintf(`{
+			"materials": [{"diffuse": {"red": 1, "green": 1, "blue": 1}}],
+			"lights": [{"position": {"x": %v, "y": %v, "z": 0}, "diffuse": {"red": 1, "green": 1, "blue": 1}}],
+			"objects": [
+				{"type": "plane", "point": {"x": 0, "y": 0, "z": 0}, "normal": {"x": 0, "y": 1, "z": 0}, "material": 0}
+			]
+		}`, test.x, test.height))
+
+		r := raytracing.Ray{
+			Position:  raytracing.Vector{X: 0, Y: 1, Z: -1},
+			Direction: raytracing.Vector{X: 0, Y: -1, Z: 1},
+			Kind:      raytracing.CameraRay,
+		}
+		color := s.TraceRay(r, 1.0, 4, 4, raytracing.LambertianLighting, nil)
+		if math.Abs(color.Red-test.want) > 1e-9 {
+			t.Errorf("light at (%v, %v): floor is %v, want %v", test.x, test.height, color.Red, test.want)
+		}
+	}
+}
+
+func TestMirrorConservesEnergy(t *testing.T) {
+	// A white floor, which would be fully lit by the light above it, reflects a light sphere. The floor's own
+	// shading only gets the light it doesn't reflect, so the two never add up to more than the light received
+	for _, reflectance := range []float64{0.0, 0.25, 0.5, 0.75, 1.0} {
+		s := loadScene(t, fmt.Sprintf(`{
+			"materials": [{"diffuse": {"red": 1, "green": 1, "blue": 1}, "reflectance": %v}],
+			"lights": [{"position": {"x": 0, "y": 2, "z": 0}, "radius": 0.5, "diffuse": {"red": 1, "green": 1, "blue": 1}}],
+			"objects": [
+				{"type": "plane", "point": {"x": 0, "y": 0, "z": 0}, "normal": {"x": 0, "y": 1, "z": 0}, "material": 0}
+			]
+		}`, reflectance))
+
+		// The ray meets the floor at z = -2, and its mirror reflection passes through the center of the light sphere
+		r := raytracing.Ray{
+			Position:  raytracing.Vector{X: 0, Y: 2, Z: -4},
+			Direction: raytracing.Vector{X: 0, Y: -1, Z: 1},
+			Kind:      raytracing.CameraRay,
+		}
+		color := s.TraceRay(r, 1.0, 4, 4, raytracing.PhongLighting, nil)
+		for _, channel := range []float64{color.Red, color.Green, color.Blue} {
+			if channel > 1.0+1e-9 {
+				t.Errorf("reflectance %v: floor is %v, brighter than the light it receives", reflectance, color)
+				break
+			}
+		}
+
+		// A perfect mirror shows only the reflected light, and a matte floor only its own shading
+		switch reflectance {
+		case 1.0:
+			if color != (raytracing.Color{Red: 1, Green: 1, Blue: 1}) {
+				t.Errorf("perfect mirror is %v, want exactly the light sphere", color)
+			}
+		case 0.0:
+			if color.Red <= 0.0 || color.Red > 1.0 {
+				t.Errorf("matte floor is %v, want it lit", color)
+			}
+		}
+	}
+}
+
+func TestFacingMirrorsStopAtMaxReflections(t *testing.T) {
+	input, err := os.ReadFile(filepath.Join("..", "..", "scenes", "facing-mirrors.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := struct {
+		Scene Scene `json:"scene"`
+	}{}
+	if err = json.Unmarshal(input, &data); err != nil {
+		t.Fatalf("couldn't unmarshal facing-mirrors.json: %v", err)
+	}
+	if err = data.Scene.Initialize(); err != nil {
+		t.Fatalf("couldn't initialize facing-mirrors.json: %v", err)
+	}
+
+	// Mirrors which only reflect half the light, and the ambient light as the depth fallback. The ray meets a
+	// mirror once more than the reflections it may trace, and that last mirror reflects the fallback, so the
+	// color seen with at most n reflections is exactly 0.5^(n+1)
+	halfMirrors := loadScene(t, `{
+		"materials": [{"diffuse": {"red": 0, "green": 0, "blue": 0}, "ambient": {"red": 0, "green": 0, "blue": 0}, "reflectance": 0.5}],
+		"lights": [{"position": {"x": 0, "y": 5, "z": 0}, "ambient": {"red": 1, "green": 1, "blue": 1}}],
+		"depthFallback": "ambient",
+		"objects": [
+			{"type": "plane", "point": {"x": -2, "y": 0, "z": 0}, "normal": {"x": 1, "y": 0, "z": 0}, "material": 0},
+			{"type": "plane", "point": {"x": 2, "y": 0, "z": 0}, "normal": {"x": -1, "y": 0, "z": 0}, "material": 0}
+		]
+	}`)
+
+	// A ray perpendicular to the mirrors bounces between them forever, until it runs out of reflections
+	r := raytracing.Ray{
+		Position:  raytracing.Vector{X: 0, Y: 2, Z: 0},
+		Direction: raytracing.Vector{X: 1, Y: 0, Z: 0},
+		Kind:      raytracing.CameraRay,
+	}
+	for _, maxReflections := range []int{0, 1, 2, 5, 20} {
+		counts := RayCounts{}
+		data.Scene.TraceRay(r, 1.0, maxReflections, 0, raytracing.PhongLighting, &counts)
+		if counts.Reflected != int64(maxReflections) || counts.Depth != int64(maxReflections) {
+			t.Errorf("%d reflections: traced %d reflected rays to depth %d", maxReflections, counts.Reflected, counts.Depth)
+		}
+
+		want := math.Pow(0.5, float64(maxReflections+1))
+		if color := halfMirrors.TraceRay(r, 1.0, maxReflections, 0, raytracing.PhongLighting, nil); color != (raytracing.Color{Red: want, Green: want, Blue: want}) {
+			t.Errorf("%d reflections: half mirrors are %v, want %v", maxReflections, color, want)
+		}
+	}
+}
+
+func TestEpsilonAtSceneScales(t *testing.T) {
+	for _, scale := range []float64{1e-6, 1.0, 1e6} {
+		// A large sphere whose surface passes through the origin, where the coordinates of hits are tiny compared
+		// to their rounding error, and a small sphere just above it, out of the way of the light
+		s := loadScene(t, fmt.Sprintf(`{
+			"materials": [{"diffuse": {"red": 1, "green": 1, "blue": 1}}],
+			"lights": [{"position": {"x": %v, "y": %v, "z": 0}, "diffuse": {"red": 1, "green": 1, "blue": 1}}],
+			"objects": [
+				{"type": "sphere", "center": {"x": 0, "y": %v, "z": 0}, "radius": %v, "material": 0},
+				{"type": "sphere", "center": {"x": %v, "y": %v, "z": 0}, "radius": %v, "material": 0}
+			]
+		}`, 0.1*scale, 10*scale, -scale, scale, 0.05*scale, 0.02*scale, 0.01*scale))
+
+		occluded := 0
+		for i := 0; i < 1000; i++ {
+			// Points on the large sphere near the origin, whose normals are close to y
+			angle := 1e-3 * (float64(i) - 500.0) / 500.0
+			normal := raytracing.Vector{X: math.Sin(angle), Y: math.Cos(angle), Z: 0}
+			position := raytracing.Vector{X: 0, Y: -scale, Z: 0}.Add(normal.Scale(scale))
+			light, _ := raytracing.NewVisibleLight(s.Lights[0], position)
+			if s.Occluded(position, normal, s.epsilonAt(position, 0.0), light) {
+				occluded++
+			}
+		}
+		if occluded > 0 {
+			t.Errorf("scale %v: %d of 1000 points near the origin are in shadow", scale, occluded)
+		}
+
+		// Rays from the origin still hit the small sphere, only a few hundredths of the scale away
+		direction, _ := raytracing.Vector{X: 0.05, Y: 0.02, Z: 0}.Normalize()
+		r := raytracing.Ray{Direction: direction, Kind: raytracing.ReflectedRay}
+		r.Epsilon = s.epsilonAt(r.Position, 0.0)
+		want := (math.Hypot(0.05, 0.02) - 0.01) * scale
+		if intersected, hit, object := s.FindIntersection(r); !intersected || object != 1 || math.Abs(hit.Distance-want) > 1e-9*scale {
+			t.Errorf("scale %v: ray from the origin hit object %d at %v, want the small sphere at %v", scale, object, hit.Distance, want)
+		}
+	}
+}
+
+func TestFarClip(t *testing.T) {
+	sphere := `{"type": "sphere", "center": {"x": 0, "y": 0, "z": %v}, "radius": 1, "material": 0}`
+	plane := `{"type": "plane", "point": {"x": 0, "y": 0, "z": %v}, "normal": {"x": 0, "y": 0, "z": -1}, "material": 0}`
+
+	// An object seen by a ray from the origin along the z axis, ahead of the far clip or beyond it
+	tests := []struct {
+		name     string
+		farClip  string
+		object   string
+		distance float64
+		hit      bool
+	}{
+		{"just inside", "100", sphere, 99.99, true},
+		{"just outside", "100", sphere, 100.01, false},
+		// Planes are infinite, so they don't change the default far clip of 20000
+		{"inside the default", "null", plane, 19999, true},
+		{"beyond the default", "null", plane, 20001, false},
+		// The default far clip grows to contain a distant sphere
+		{"distant sphere", "null", sphere, 50000, true},
+	}
+
+	for _, test := range tests {
+		// The near side of the sphere is at the distance
+		position := test.distance
+		if test.object == sphere {
+			position++
+		}
+		s := loadScene(t, fmt.Sprintf(`{
+			"farClip": %s,
+			"materials": [{"diffuse": {"red": 1, "green": 1, "blue": 1}}],
+			"lights": [{"position": {"x": 0, "y": 0, "z": 0}, "diffuse": {"red": 1, "green": 1, "blue": 1}}],
+			"objects": [`+test.object+`]
+		}`, test.farClip, position))
+
+		r := raytracing.Ray{Direction: raytracing.Vector{X: 0, Y: 0, Z: 1}, Kind: raytracing.CameraRay}
+		intersected, hit, _ := s.FindIntersection(r)
+		if intersected != test.hit {
+			t.Errorf("%s: object %v away with far clip %v: intersected is %v, want %v", test.name, test.distance, *s.FarClip, intersected, test.hit)
+		}
+		if intersected && math.Abs(hit.Distance-test.distance) > 1e-6 {
+			t.Errorf("%s: object was hit at %v, want %v", test.name, hit.Distance, test.distance)
+		}
+	}
+}
+
+func TestNestedGlass(t *testing.T) {
+	// A glass sphere nested in the middle of another, in front of an unlit backdrop whose color is the x coordinate
+	// where rays land on it. Rays through the middle of the spheres are refracted four times
+	scene := func(innerIndex string) *Scene {
+		return loadScene(t, fmt.Sprintf(`{
+			"materials": [
+				{"transmittance": 1, "refractiveIndex": 1.5},
+				{"transmittance": 1, "refractiveIndex": %s},
+				{"unlit": true, "gradient": {"direction": {"x": 1, "y": 0, "z": 0}, "min": -10, "max": 10,
+					"stops": [{"position": 0, "color": {"red": 0, "green": 0, "blue": 0}}, {"position": 1, "color": {"red": 1, "green": 1, "blue": 1}}]}}
+			],
+			"lights": [{"position": {"x": 0, "y": 10, "z": 0}, "diffuse": {"red": 1, "green": 1, "blue": 1}}],
+			"objects": [
+				{"type": "sphere", "center": {"x": 0, "y": 0, "z": 0}, "radius": 2, "material": 0},
+				{"type": "sphere", "center": {"x": 0, "y": 0, "z": 0}, "radius": 1, "material": 1},
+				{"type": "plane", "point": {"x": 0, "y": 0, "z": 10}, "normal": {"x": 0, "y": 0, "z": -1}, "material": 2}
+			]
+		}`, innerIndex))
+	}
+
+	r := raytracing.Ray{
+		Position:  raytracing.Vector{X: 0.7, Y: 0, Z: -5},
+		Direction: raytracing.Vector{X: 0, Y: 0, Z: 1},
+		Kind:      raytracing.CameraRay,
+	}
+	// landing returns where r lands on the backdrop within the given depth limits, and the number of refracted
+	// rays traced
+	landing := func(s *Scene, maxReflections int, maxRefractions int) (float64, int64) {
+		counts := RayCounts{}
+		color := s.TraceRay(r, 1.0, maxReflections, maxRefractions, raytracing.LambertianLighting, &counts)
+		return 20.0*color.Red - 10.0, counts.Refracted
+	}
+
+	// Rays only leave the inner sphere into the glass of the outer one, so glass nested in glass of the same
+	// index doesn't bend them, and they land where they would through the outer sphere alone
+	single := loadScene(t, `{
+		"materials": [
+			{"transmittance": 1, "refractiveIndex": 1.5},
+			{"unlit": true, "gradient": {"direction": {"x": 1, "y": 0, "z": 0}, "min": -10, "max": 10,
+				"stops": [{"position": 0, "color": {"red": 0, "green": 0, "blue": 0}}, {"position": 1, "color": {"red": 1, "green": 1, "blue": 1}}]}}
+		],
+		"lights": [{"position": {"x": 0, "y": 10, "z": 0}, "diffuse": {"red": 1, "green": 1, "blue": 1}}],
+		"objects": [
+			{"type": "sphere", "center": {"x": 0, "y": 0, "z": 0}, "radius": 2, "material": 0},
+			{"type": "plane", "point": {"x": 0, "y": 0, "z": 10}, "normal": {"x": 0, "y": 0, "z": -1}, "material": 1}
+		]
+	}`)
+	want, _ := landing(single, 0, 2)
+	if want >= 0.7 {
+		t.Fatalf("ray through a single sphere landed at %v, want it bent towards the axis", want)
+	}
+	if got, refracted := landing(scene("1.5"), 0, 4); math.Abs(got-want) > 1e-9 || refracted != 4 {
+		t.Errorf("nested glass of the same index: landed at %v after %d refractions, want %v after 4", got, refracted, want)
+	}
+	// A denser inner sphere bends the ray further
+	if got, _ := landing(scene("2.0"), 0, 4); got >= want-0.01 {
+		t.Errorf("denser nested glass: landed at %v, want further towards the axis than %v", got, want)
+	}
+
+	// The fourth refraction is the last one needed, and refractions aren't limited by the number of reflections
+	if got, refracted := landing(scene("1.5"), 0, 3); got != -10.0 || refracted != 3 {
+		t.Errorf("three refractions: landed at %v after %d refractions, want the ray to end inside the glass", got, refracted)
+	}
+	if got, _ := landing(scene("1.5"), 0, 40); math.Abs(got-want) > 1e-9 {
+		t.Errorf("forty refractions: landed at %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,97 @@
+package scene
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+// Skybox surrounds the scene with six images forming the faces of a cube, seen by rays which miss every object
+type Skybox struct {
+	PositiveX string `json:"positiveX"`
+	NegativeX string `json:"negativeX"`
+	PositiveY string `json:"positiveY"`
+	NegativeY string `json:"negativeY"`
+	PositiveZ string `json:"positiveZ"`
+	NegativeZ string `json:"negativeZ"`
+	// Filter is the texture filter for the faces, default is bilinear
+	Filter string `json:"filter"`
+	// Wrap is the wrap mode for the faces, default is clamp so samples don't bleed across edges
+	Wrap  string `json:"wrap"`
+	faces [6]*raytracing.Texture
+}
+
+// Indices of the faces of a Skybox
+const (
+	facePositiveX = iota
+	faceNegativeX
+	facePositiveY
+	faceNegativeY
+	facePositiveZ
+	faceNegativeZ
+)
+
+// load decodes the face images, resolving relative paths against directory
+func (sb *Skybox) load(directory string) error {
+	if sb.Filter == "" {
+		sb.Filter = raytracing.FilterBilinear
+	}
+	if sb.Wrap == "" {
+		sb.Wrap = raytracing.WrapClamp
+	}
+
+	paths := [6]string{sb.PositiveX, sb.NegativeX, sb.PositiveY, sb.NegativeY, sb.PositiveZ, sb.NegativeZ}
+	for i, path := range paths {
+		if path == "" {
+			return fmt.Errorf("skybox must specify all six faces")
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(directory, path)
+		}
+
+		face, err := raytracing.LoadTexture(path, sb.Filter, sb.Wrap)
+		if err != nil {
+			return fmt.Errorf("unable to load skybox face %s: %v", paths[i], err)
+		}
+		sb.faces[i] = face
+	}
+
+	return nil
+}
+
+// face selects the face of the cube seen in a direction, using its dominant axis, and returns the
+// coordinates within the face from 0.0 to 1.0, with v increasing downwards in the image. Faces are
+// oriented as they appear from inside the cube, following the usual cube map convention
+func face(direction raytracing.Vector) (index int, u float64, v float64) {
+	x, y, z := direction.X, direction.Y, direction.Z
+	absX, absY, absZ := math.Abs(x), math.Abs(y), math.Abs(z)
+
+	var major, s, t float64
+	switch {
+	case absX >= absY && absX >= absZ && x > 0.0:
+		index, major, s, t = facePositiveX, absX, -z, -y
+	case absX >= absY && absX >= absZ:
+		index, major, s, t = faceNegativeX, absX, z, -y
+	case absY >= absZ && y > 0.0:
+		index, major, s, t = facePositiveY, absY, x, z
+	case absY >= absZ:
+		index, major, s, t = faceNegativeY, absY, x, -z
+	case z > 0.0:
+		index, major, s, t = facePositiveZ, absZ, x, -y
+	default:
+		index, major, s, t = faceNegativeZ, absZ, -x, -y
+	}
+
+	if major == 0.0 {
+		return index, 0.5, 0.5
+	}
+	return index, 0.5 * (s/major + 1.0), 0.5 * (t/major + 1.0)
+}
+
+// sample returns the color of the skybox seen in a direction
+func (sb *Skybox) sample(direction raytracing.Vector) raytracing.Color {
+	index, u, v := face(direction)
+	return sb.faces[index].Sample(u, v)
+}
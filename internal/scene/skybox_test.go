@@ -0,0 +1,53 @@
+package scene
+
+import (
+	"testing"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+func TestSkyboxFace(t *testing.T) {
+	tests := []struct {
+		name      string
+		direction raytracing.Vector
+		index     int
+		u, v      float64
+	}{
+		{"+x axis", raytracing.Vector{X: 1, Y: 0, Z: 0}, facePositiveX, 0.5, 0.5},
+		{"-x axis", raytracing.Vector{X: -1, Y: 0, Z: 0}, faceNegativeX, 0.5, 0.5},
+		{"+y axis", raytracing.Vector{X: 0, Y: 1, Z: 0}, facePositiveY, 0.5, 0.5},
+		{"-y axis", raytracing.Vector{X: 0, Y: -1, Z: 0}, faceNegativeY, 0.5, 0.5},
+		{"+z axis", raytracing.Vector{X: 0, Y: 0, Z: 1}, facePositiveZ, 0.5, 0.5},
+		{"-z axis", raytracing.Vector{X: 0, Y: 0, Z: -1}, faceNegativeZ, 0.5, 0.5},
+
+		// Off axis directions check the orientation of each face as seen from inside the cube
+		{"+x face", raytracing.Vector{X: 1, Y: 0.5, Z: 0.25}, facePositiveX, 0.375, 0.25},
+		{"-x face", raytracing.Vector{X: -1, Y: 0.5, Z: 0.25}, faceNegativeX, 0.625, 0.25},
+		{"+y face", raytracing.Vector{X: 0.25, Y: 1, Z: 0.5}, facePositiveY, 0.625, 0.75},
+		{"-y face", raytracing.Vector{X: 0.25, Y: -1, Z: 0.5}, faceNegativeY, 0.625, 0.25},
+		{"+z face", raytracing.Vector{X: 0.5, Y: 0.25, Z: 1}, facePositiveZ, 0.75, 0.375},
+		{"-z face", raytracing.Vector{X: 0.5, Y: 0.25, Z: -1}, faceNegativeZ, 0.25, 0.375},
+
+		// Directions along edges and through corners tie between faces, and are resolved towards x, then y
+		{"+x+y edge", raytracing.Vector{X: 1, Y: 1, Z: 0}, facePositiveX, 0.5, 0.0},
+		{"+x-z edge", raytracing.Vector{X: 1, Y: 0, Z: -1}, facePositiveX, 1.0, 0.5},
+		{"-x+z edge", raytracing.Vector{X: -1, Y: 0, Z: 1}, faceNegativeX, 1.0, 0.5},
+		{"+y-z edge", raytracing.Vector{X: 0, Y: 1, Z: -1}, facePositiveY, 0.5, 0.0},
+		{"-y+z edge", raytracing.Vector{X: 0, Y: -1, Z: 1}, faceNegativeY, 0.5, 0.0},
+		{"+x+y+z corner", raytracing.Vector{X: 1, Y: 1, Z: 1}, facePositiveX, 0.0, 0.0},
+		{"-x-y-z corner", raytracing.Vector{X: -1, Y: -1, Z: -1}, faceNegativeX, 0.0, 1.0},
+		{"-x+y-z corner", raytracing.Vector{X: -1, Y: 1, Z: -1}, faceNegativeX, 0.0, 0.0},
+
+		{"zero direction", raytracing.Vector{}, faceNegativeX, 0.5, 0.5},
+	}
+
+	for _, test := range tests {
+		// The face and coordinates don't depend on the length of the direction
+		for _, scale := range []float64{1.0, 3.0} {
+			index, u, v := face(test.direction.Scale(scale))
+			if index != test.index || u != test.u || v != test.v {
+				t.Errorf("%s: face(%v) = %d, (%v, %v), want %d, (%v, %v)", test.name, test.direction.Scale(scale), index, u, v, test.index, test.u, test.v)
+			}
+		}
+	}
+}
@@ -0,0 +1,500 @@
+// Package yaml converts scene files written in a subset of YAML to JSON, so they can be decoded by the
+// same structs as JSON scene files and always produce identical scenes.
+//
+// The subset covers what scene authoring needs: comments, block mappings and sequences, flow mappings
+// and sequences such as {x: 1, y: 2} which may span several lines, and plain, single-quoted and
+// double-quoted scalars. Anchors, aliases, tags, multi-line block scalars and multiple documents are
+// not supported and are reported as errors.
+package yaml
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// IsYAML returns whether a path has a YAML file extension
+func IsYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// ReadJSON reads a file as JSON, converting it first if it has a YAML file extension
+func ReadJSON(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil || !IsYAML(path) {
+		return data, err
+	}
+	return ToJSON(data)
+}
+
+// ToJSON converts a YAML document to JSON
+func ToJSON(data []byte) ([]byte, error) {
+	lines, err := splitLines(string(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("YAML document is empty")
+	}
+
+	p := parser{lines: lines}
+	value, err := p.block(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].number)
+	}
+	return value, nil
+}
+
+// line is a non-empty line of a YAML document, without its indentation or comment
+type line struct {
+	number int
+	indent int
+	text   string
+}
+
+// splitLines returns the lines of a document holding content
+func splitLines(document string) ([]line, error) {
+	var lines []line
+	for i, text := range strings.Split(strings.ReplaceAll(document, "\r\n", "\n"), "\n") {
+		number := i + 1
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs cannot be used for indentation", number)
+		}
+
+		content := strings.TrimRight(stripComment(trimmed), " \t")
+		if content == "" {
+			continue
+		}
+		if len(trimmed) == len(text) && (content == "---" || content == "...") {
+			if len(lines) > 0 {
+				return nil, fmt.Errorf("line %d: multiple documents are not supported", number)
+			}
+			continue
+		}
+		lines = append(lines, line{number: number, indent: len(text) - len(trimmed), text: content})
+	}
+	return lines, nil
+}
+
+// stripComment removes a comment from a line. A comment starts with # at the start of the line or
+// after whitespace, outside of quoted scalars
+func stripComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return text[:i]
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" [{,:", text[i-1]) >= 0):
+			quote = c
+		}
+	}
+	return text
+}
+
+// parser converts the lines of a document to JSON, nested by indentation
+type parser struct {
+	lines []line
+	pos   int
+}
+
+// block converts the block node starting at the current line, which is indented by indent
+func (p *parser) block(indent int) (json.RawMessage, error) {
+	current := p.lines[p.pos]
+	if isSequenceItem(current.text) {
+		return p.sequence(indent)
+	}
+	if _, _, ok, err := splitKey(current.text); err != nil {
+		return nil, fmt.Errorf("line %d: %v", current.number, err)
+	} else if ok {
+		return p.mapping(indent)
+	}
+	return p.inline(current.text)
+}
+
+// sequence converts a block sequence of items starting with "-" at indent
+func (p *parser) sequence(indent int) (json.RawMessage, error) {
+	var items []json.RawMessage
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isSequenceItem(p.lines[p.pos].text) {
+		current := p.lines[p.pos]
+		content := strings.TrimLeft(current.text[1:], " ")
+
+		var item json.RawMessage
+		var err error
+		if content == "" {
+			p.pos++
+			item, err = p.nested(indent, false)
+		} else {
+			// The content of the item is parsed as a block indented to its column, so following lines
+			// at that column, such as further keys of a mapping, belong to the item
+			column := indent + len(current.text) - len(content)
+			p.lines[p.pos] = line{number: current.number, indent: column, text: content}
+			item, err = p.block(column)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].number)
+	}
+	return joinJSON('[', items, ']'), nil
+}
+
+// mapping converts a block mapping of "key: value" lines at indent
+func (p *parser) mapping(indent int) (json.RawMessage, error) {
+	var members []json.RawMessage
+	keys := make(map[string]bool)
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		current := p.lines[p.pos]
+		key, value, ok, err := splitKey(current.text)
+		if err == nil && !ok {
+			err = fmt.Errorf("expected \"key: value\"")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", current.number, err)
+		}
+		if keys[key] {
+			return nil, fmt.Errorf("line %d: duplicate key %q", current.number, key)
+		}
+		keys[key] = true
+
+		var converted json.RawMessage
+		if value == "" {
+			p.pos++
+			converted, err = p.nested(indent, true)
+		} else {
+			converted, err = p.inline(value)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name, _ := json.Marshal(key)
+		members = append(members, append(append(name, ':'), converted...))
+	}
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].number)
+	}
+	return joinJSON('{', members, '}'), nil
+}
+
+// nested converts the block node which is the value of a key or sequence item with nothing after it
+// on its line, or null if there is none. The value of a key may be a sequence at the indent of the key
+func (p *parser) nested(indent int, sequenceAllowed bool) (json.RawMessage, error) {
+	if p.pos < len(p.lines) {
+		next := p.lines[p.pos]
+		if next.indent > indent || (sequenceAllowed && next.indent == indent && isSequenceItem(next.text)) {
+			return p.block(next.indent)
+		}
+	}
+	return json.RawMessage("null"), nil
+}
+
+// inline converts a flow node or scalar starting on the current line, which replaces the text of the
+// line. Flow collections which are not closed on the line continue onto the following lines
+func (p *parser) inline(text string) (json.RawMessage, error) {
+	start := p.lines[p.pos].number
+	p.pos++
+	if text[0] == '[' || text[0] == '{' {
+		for !balanced(text) && p.pos < len(p.lines) {
+			text += " " + p.lines[p.pos].text
+			p.pos++
+		}
+	}
+
+	f := flow{text: text}
+	value, err := f.value(false)
+	if err == nil {
+		f.skipSpaces()
+		if f.pos < len(f.text) {
+			err = fmt.Errorf("unexpected %q", f.text[f.pos:])
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", start, err)
+	}
+	return value, nil
+}
+
+// isSequenceItem returns whether a line is an item of a block sequence
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitKey splits a "key: value" line of a block mapping, returning whether the line is one
+func splitKey(text string) (key string, value string, ok bool, err error) {
+	var rest string
+	switch text[0] {
+	case '"', '\'':
+		f := flow{text: text}
+		raw, err := f.quoted()
+		if err != nil {
+			return "", "", false, err
+		}
+		if err = json.Unmarshal(raw, &key); err != nil {
+			return "", "", false, err
+		}
+		rest = strings.TrimLeft(text[f.pos:], " ")
+		if rest != ":" && !strings.HasPrefix(rest, ": ") {
+			return "", "", false, nil
+		}
+	case '[', '{':
+		return "", "", false, nil
+	default:
+		colon := strings.Index(text, ": ")
+		if colon < 0 {
+			if !strings.HasSuffix(text, ":") {
+				return "", "", false, nil
+			}
+			colon = len(text) - 1
+		}
+		key = strings.TrimRight(text[:colon], " ")
+		rest = text[colon:]
+	}
+	return key, strings.TrimLeft(rest[1:], " "), true, nil
+}
+
+// balanced returns whether every flow collection opened in text is closed, ignoring quoted scalars
+func balanced(text string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// flow converts flow collections and scalars within a single string
+type flow struct {
+	text string
+	pos  int
+}
+
+// value converts the node at the current position. Within a flow collection, plain scalars end at
+// the indicators which separate and close entries
+func (f *flow) value(inCollection bool) (json.RawMessage, error) {
+	f.skipSpaces()
+	if f.pos >= len(f.text) {
+		return nil, fmt.Errorf("missing value")
+	}
+
+	switch c := f.text[f.pos]; c {
+	case '[':
+		return f.sequence()
+	case '{':
+		return f.mapping()
+	case '"', '\'':
+		return f.quoted()
+	case '&', '*', '!', '|', '>', '%', '@', '`':
+		return nil, fmt.Errorf("unsupported YAML syntax %q", string(c))
+	}
+
+	terminators := ""
+	if inCollection {
+		terminators = ",]}"
+	}
+	return plain(f.plain(terminators)), nil
+}
+
+// sequence converts a flow sequence such as [1, 2, 3]
+func (f *flow) sequence() (json.RawMessage, error) {
+	f.pos++
+	var items []json.RawMessage
+	for {
+		f.skipSpaces()
+		if f.consume(']') {
+			return joinJSON('[', items, ']'), nil
+		}
+		item, err := f.value(true)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if err = f.separator(']'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// mapping converts a flow mapping such as {x: 1, y: 2}
+func (f *flow) mapping() (json.RawMessage, error) {
+	f.pos++
+	var members []json.RawMessage
+	keys := make(map[string]bool)
+	for {
+		f.skipSpaces()
+		if f.consume('}') {
+			return joinJSON('{', members, '}'), nil
+		}
+
+		var key string
+		if c := f.text[f.pos]; c == '"' || c == '\'' {
+			raw, err := f.quoted()
+			if err != nil {
+				return nil, err
+			}
+			if err = json.Unmarshal(raw, &key); err != nil {
+				return nil, err
+			}
+		} else {
+			key = f.plain(":,}")
+		}
+		f.skipSpaces()
+		if !f.consume(':') {
+			return nil, fmt.Errorf("expected \":\" after key %q", key)
+		}
+		if keys[key] {
+			return nil, fmt.Errorf("duplicate key %q", key)
+		}
+		keys[key] = true
+
+		value, err := f.value(true)
+		if err != nil {
+			return nil, err
+		}
+		name, _ := json.Marshal(key)
+		members = append(members, append(append(name, ':'), value...))
+		if err = f.separator('}'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// separator consumes the comma between entries of a flow collection, leaving its closing indicator
+func (f *flow) separator(closing byte) error {
+	f.skipSpaces()
+	if f.consume(',') || (f.pos < len(f.text) && f.text[f.pos] == closing) {
+		return nil
+	}
+	return fmt.Errorf("expected \",\" or %q", string(closing))
+}
+
+// quoted converts a single or double quoted scalar to a JSON string
+func (f *flow) quoted() (json.RawMessage, error) {
+	quote := f.text[f.pos]
+	var value strings.Builder
+	for i := f.pos + 1; i < len(f.text); i++ {
+		c := f.text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case c == quote && quote == '\'' && i+1 < len(f.text) && f.text[i+1] == '\'':
+			// Single quotes are escaped by repeating them
+			value.WriteByte('\'')
+			i++
+			continue
+		case c == quote:
+			raw := f.text[f.pos : i+1]
+			f.pos = i + 1
+			if quote == '"' {
+				var s string
+				if err := json.Unmarshal([]byte(raw), &s); err != nil {
+					return nil, fmt.Errorf("invalid double-quoted string %s", raw)
+				}
+				return json.Marshal(s)
+			}
+			return json.Marshal(value.String())
+		}
+		value.WriteByte(c)
+	}
+	return nil, fmt.Errorf("unterminated quoted string")
+}
+
+// plain returns the plain scalar at the current position, which ends at any of the terminators
+func (f *flow) plain(terminators string) string {
+	start := f.pos
+	for f.pos < len(f.text) && strings.IndexByte(terminators, f.text[f.pos]) < 0 {
+		f.pos++
+	}
+	return strings.TrimRight(f.text[start:f.pos], " ")
+}
+
+// skipSpaces advances past spaces
+func (f *flow) skipSpaces() {
+	for f.pos < len(f.text) && f.text[f.pos] == ' ' {
+		f.pos++
+	}
+}
+
+// consume advances past c if it is at the current position, returning whether it was
+func (f *flow) consume(c byte) bool {
+	if f.pos < len(f.text) && f.text[f.pos] == c {
+		f.pos++
+		return true
+	}
+	return false
+}
+
+var (
+	integerPattern = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	floatPattern   = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+// plain converts a plain scalar to JSON, resolving nulls, booleans and numbers as YAML does
+func plain(scalar string) json.RawMessage {
+	switch scalar {
+	case "", "~", "null", "Null", "NULL":
+		return json.RawMessage("null")
+	case "true", "True", "TRUE":
+		return json.RawMessage("true")
+	case "false", "False", "FALSE":
+		return json.RawMessage("false")
+	}
+
+	if integerPattern.MatchString(scalar) {
+		if i, err := strconv.ParseInt(scalar, 10, 64); err == nil {
+			return json.RawMessage(strconv.FormatInt(i, 10))
+		}
+	}
+	if floatPattern.MatchString(scalar) {
+		if f, err := strconv.ParseFloat(scalar, 64); err == nil {
+			return json.RawMessage(strconv.FormatFloat(f, 'g', -1, 64))
+		}
+	}
+
+	s, _ := json.Marshal(scalar)
+	return s
+}
+
+// joinJSON joins JSON values with commas between opening and closing brackets
+func joinJSON(opening byte, values []json.RawMessage, closing byte) json.RawMessage {
+	joined := []byte{opening}
+	for i, value := range values {
+		if i > 0 {
+			joined = append(joined, ',')
+		}
+		joined = append(joined, value...)
+	}
+	return append(joined, closing)
+}
@@ -0,0 +1,87 @@
+package raytracing
+
+import (
+	"fmt"
+	"math"
+)
+
+// Patterns for procedural bump mapping
+const (
+	BumpNoise   = "noise"
+	BumpChecker = "checker"
+)
+
+// Bump perturbs surface normals using a procedural height pattern of the hit position, giving the
+// appearance of surface relief without changing the geometry
+type Bump struct {
+	Pattern   string  `json:"pattern"`
+	Amplitude float64 `json:"amplitude"`
+	Scale     float64 `json:"scale"`
+}
+
+// Validate checks the bump parameters and sets defaults
+func (b *Bump) Validate() error {
+	if b.Pattern == "" {
+		b.Pattern = BumpNoise
+	}
+	if b.Pattern != BumpNoise && b.Pattern != BumpChecker {
+		return fmt.Errorf("unknown bump pattern %q", b.Pattern)
+	}
+	if b.Scale <= 0.0 {
+		return fmt.Errorf("bump scale must be positive")
+	}
+	return nil
+}
+
+// Perturb returns the normal at position tilted by the slope of the height pattern
+func (b *Bump) Perturb(normal Vector, position Vector) Vector {
+	// The gradient is estimated by central differences, using a step small relative to the pattern
+	step := b.Scale * 1e-3
+	gradient := Vector{
+		X: b.height(position.Add(Vector{X: step})) - b.height(position.Add(Vector{X: -step})),
+		Y: b.height(position.Add(Vector{Y: step})) - b.height(position.Add(Vector{Y: -step})),
+		Z: b.height(position.Add(Vector{Z: step})) - b.height(position.Add(Vector{Z: -step})),
+	}.Scale(1.0 / (2.0 * step))
+
+	// Only the slope along the surface tilts the normal
+	tangential := gradient.Subtract(gradient.ProjectOnto(normal))
+	perturbed, ok := normal.Subtract(tangential).Normalize()
+	if !ok {
+		return normal
+	}
+	return perturbed
+}
+
+// height returns the height of the pattern at a position, scaled by the amplitude
+func (b *Bump) height(position Vector) float64 {
+	p := position.Scale(1.0 / b.Scale)
+	if b.Pattern == BumpChecker {
+		// Raised and sunken cells alternate, with smooth slopes between them. The pattern is flat
+		// within planes along the axes half way between cell centers
+		return b.Amplitude * math.Cos(math.Pi*p.X) * math.Cos(math.Pi*p.Y) * math.Cos(math.Pi*p.Z)
+	}
+	return b.Amplitude * valueNoise(p)
+}
+
+// valueNoise returns smoothly interpolated pseudo-random values between -1.0 and 1.0 assigned to
+// the points of the integer lattice
+func valueNoise(p Vector) float64 {
+	x0, y0, z0 := math.Floor(p.X), math.Floor(p.Y), math.Floor(p.Z)
+	fx, fy, fz := smoothstep(p.X-x0), smoothstep(p.Y-y0), smoothstep(p.Z-z0)
+
+	corner := func(dx float64, dy float64, dz float64) float64 {
+		hash := mix(uint64(int64(x0 + dx)))
+		hash = mix(hash ^ uint64(int64(y0+dy)))
+		hash = mix(hash ^ uint64(int64(z0+dz)))
+		return 2.0*float64(hash>>11)/float64(1<<53) - 1.0
+	}
+
+	near := lerp(lerp(corner(0, 0, 0), corner(1, 0, 0), fx), lerp(corner(0, 1, 0), corner(1, 1, 0), fx), fy)
+	far := lerp(lerp(corner(0, 0, 1), corner(1, 0, 1), fx), lerp(corner(0, 1, 1), corner(1, 1, 1), fx), fy)
+	return lerp(near, far, fz)
+}
+
+// smoothstep eases t between 0.0 and 1.0 so interpolated noise has a continuous slope
+func smoothstep(t float64) float64 {
+	return t * t * (3.0 - 2.0*t)
+}
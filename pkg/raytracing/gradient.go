@@ -0,0 +1,95 @@
+package raytracing
+
+import (
+	"fmt"
+	"math"
+)
+
+// Inputs of gradient materials
+const (
+	GradientHeight = "height"
+	GradientNormal = "normal"
+)
+
+// RampStop is a color at a position along a color ramp
+type RampStop struct {
+	Position float64 `json:"position"`
+	Color    Color   `json:"color"`
+}
+
+// Gradient replaces the diffuse color of a material by mapping a scalar function of each hit through a
+// color ramp, either the height of the hit position along a direction or the cosine between the surface
+// normal and a direction
+type Gradient struct {
+	Input     string  `json:"input"`
+	Direction *Vector `json:"direction"`
+	// Min and Max are the values of the input mapped to the start and end of the ramp
+	Min   *float64   `json:"min"`
+	Max   *float64   `json:"max"`
+	Stops []RampStop `json:"stops"`
+}
+
+// Validate checks the gradient parameters and sets defaults
+func (g *Gradient) Validate() error {
+	if g.Input == "" {
+		g.Input = GradientHeight
+	}
+	if g.Input != GradientHeight && g.Input != GradientNormal {
+		return fmt.Errorf("unknown gradient input %q", g.Input)
+	}
+
+	if g.Direction == nil {
+		g.Direction = &Vector{X: 0.0, Y: 1.0, Z: 0.0}
+	}
+	direction, ok := g.Direction.Normalize()
+	if !ok {
+		return fmt.Errorf("gradient direction must be non-zero")
+	}
+	g.Direction = &direction
+
+	if g.Min == nil {
+		min := 0.0
+		if g.Input == GradientNormal {
+			min = -1.0
+		}
+		g.Min = &min
+	}
+	if g.Max == nil {
+		max := 1.0
+		g.Max = &max
+	}
+	if *g.Max <= *g.Min {
+		return fmt.Errorf("gradient max must be greater than min")
+	}
+
+	if len(g.Stops) < 2 {
+		return fmt.Errorf("gradient must have at least 2 stops")
+	}
+	for i := 1; i < len(g.Stops); i++ {
+		if g.Stops[i].Position < g.Stops[i-1].Position {
+			return fmt.Errorf("gradient stop positions must be in increasing order")
+		}
+	}
+	return nil
+}
+
+// ColorAt returns the color of the gradient for a hit at a position with the given surface normal
+func (g *Gradient) ColorAt(position Vector, normal Vector) Color {
+	value := position.Dot(*g.Direction)
+	if g.Input == GradientNormal {
+		value = normal.Dot(*g.Direction)
+	}
+	t := (value - *g.Min) / (*g.Max - *g.Min)
+
+	// Positions before the first stop or after the last take the color of that stop
+	if t <= g.Stops[0].Position {
+		return g.Stops[0].Color
+	}
+	for i := 1; i < len(g.Stops); i++ {
+		a, b := g.Stops[i-1], g.Stops[i]
+		if t < b.Position {
+			return a.Color.Blend(b.Color, (t-a.Position)/math.Max(b.Position-a.Position, 1e-12))
+		}
+	}
+	return g.Stops[len(g.Stops)-1].Color
+}
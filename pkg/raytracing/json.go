@@ -0,0 +1,75 @@
+package raytracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// JSONError is a syntax or type error from unmarshalling a JSON value nested within a larger document, such as
+// by an UnmarshalJSON method. The offset of the error is relative to the start of Value
+type JSONError struct {
+	Value []byte
+	Err   error
+}
+
+func (e *JSONError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *JSONError) Unwrap() error {
+	return e.Err
+}
+
+// NestJSONError returns err, an error from unmarshalling value, along with the value its offset is relative to.
+// encoding/json doesn't locate errors returned by UnmarshalJSON methods within the document being unmarshalled,
+// so if err holds a JSONError from a value nested within value, its offset is moved onto value. Nested values are
+// located by their first occurrence in value, and an identical value earlier in the document would have failed
+// the same way
+func NestJSONError(value []byte, err error) error {
+	offset := jsonErrorOffset(err)
+	if offset == nil {
+		return err
+	}
+
+	var nested *JSONError
+	if !errors.As(err, &nested) {
+		return &JSONError{Value: value, Err: err}
+	}
+
+	if start := bytes.Index(value, nested.Value); start >= 0 {
+		*offset += int64(start)
+		nested.Value = value
+	}
+	return err
+}
+
+// JSONErrorOffset returns the offset within document of a syntax or type error from unmarshalling it, including
+// errors within nested values returned by NestJSONError. Returns false if err has no offset within document
+func JSONErrorOffset(document []byte, err error) (int64, bool) {
+	err = NestJSONError(document, err)
+	offset := jsonErrorOffset(err)
+	if offset == nil {
+		return 0, false
+	}
+
+	var nested *JSONError
+	if errors.As(err, &nested) && !bytes.Equal(nested.Value, document) {
+		return 0, false
+	}
+	return *offset, true
+}
+
+// jsonErrorOffset returns the offset of the syntax or type error in err, or nil if there isn't one
+func jsonErrorOffset(err error) *int64 {
+	var syntaxError *json.SyntaxError
+	if errors.As(err, &syntaxError) {
+		return &syntaxError.Offset
+	}
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		return &typeError.Offset
+	}
+	return nil
+}
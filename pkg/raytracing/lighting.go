@@ -1,15 +1,121 @@
 package raytracing
 
 import (
+	"encoding/json"
+	"fmt"
 	"math"
+	"path/filepath"
+)
+
+// Tolerances of ray intersections with primitives
+const (
+	// HitEpsilon is the default minimum distance of intersections along rays. Secondary rays start on the
+	// surface they leave, and rounding error would otherwise let them hit it again, causing shadow and
+	// reflection acne. Too large a value misses geometry closer than it, such as in contact shadows and
+	// thin objects, so it should grow with the scale of the scene
+	HitEpsilon = 1e-4
+	// ParallelEpsilon is the magnitude below which the cosine of a ray with a surface normal is treated as
+	// zero, so rays parallel to the surface miss it rather than dividing by nearly zero. Triangles scale it
+	// by the lengths of their edges, since their determinant grows with their size
+	ParallelEpsilon = 1e-8
 )
 
 // Ray is a 3 dimensional ray
 type Ray struct {
 	Position  Vector `json:"position"`
 	Direction Vector `json:"direction"`
+	// Epsilon is the minimum distance of intersections along the ray, or HitEpsilon if it is zero
+	Epsilon float64 `json:"-"`
+	// Kind is the purpose of the ray, which objects and materials can use to behave differently
+	Kind RayKind `json:"-"`
+	// Channel is the color carried by the ray, which is only a single channel once dispersed
+	Channel Channel `json:"-"`
+	// media are the refractive indices of the transparent objects the ray has entered and not yet left,
+	// innermost last, and depth is how many there are, which may be more than are held
+	media [MaxMedia]float64
+	depth int
+}
+
+// MaxMedia is the number of nested transparent objects whose refractive indices a ray keeps track of. Inside
+// more than this, rays take the innermost to be the last one they keep track of
+const MaxMedia = 4
+
+// MediumIndex returns the refractive index of the medium the ray travels through, which is 1.0 for air
+// outside of every object
+func (r Ray) MediumIndex() float64 {
+	return r.mediumAt(r.depth)
 }
 
+// OuterIndex returns the refractive index of the medium around the innermost object the ray is inside, which
+// it passes into when leaving that object
+func (r Ray) OuterIndex() float64 {
+	return r.mediumAt(r.depth - 1)
+}
+
+// mediumAt returns the refractive index of the medium depth objects deep
+func (r Ray) mediumAt(depth int) float64 {
+	if depth <= 0 {
+		return 1.0
+	}
+	if depth > MaxMedia {
+		depth = MaxMedia
+	}
+	return r.media[depth-1]
+}
+
+// Enter records the ray passing into a transparent object with the given refractive index
+func (r *Ray) Enter(index float64) {
+	if r.depth < MaxMedia {
+		r.media[r.depth] = index
+	}
+	r.depth++
+}
+
+// Leave records the ray passing out of the innermost transparent object it is inside, if any
+func (r *Ray) Leave() {
+	if r.depth > 0 {
+		r.depth--
+	}
+}
+
+// MinDistance returns the minimum distance of intersections along the ray
+func (r Ray) MinDistance() float64 {
+	if r.Epsilon > 0.0 {
+		return r.Epsilon
+	}
+	return HitEpsilon
+}
+
+// Channel is a color channel carried by a ray
+type Channel int
+
+// Color channels carried by rays
+const (
+	// AllChannels is carried by rays which haven't been dispersed
+	AllChannels Channel = iota
+	RedChannel
+	GreenChannel
+	BlueChannel
+)
+
+// RayKind is the purpose of a ray
+type RayKind int
+
+// Kinds of rays traced through the scene
+const (
+	// UntypedRay is a ray whose purpose is unknown, which is treated like any other ray
+	UntypedRay RayKind = iota
+	// CameraRay is a primary ray from the camera
+	CameraRay
+	// ShadowRay tests whether a light reaches a surface
+	ShadowRay
+	// ReflectedRay is a reflection or diffuse bounce from a surface
+	ReflectedRay
+
+	// RayKinds is the number of kinds of rays
+	RayKinds = 4
+)
+
 // Color is a RGB color
 type Color struct {
 	Red   float64 `json:"red"`
@@ -19,64 +125,267 @@ type Color struct {
 
 // Material describes a syrface based on diffusion color and reflectance
 type Material struct {
+	Name        string  `json:"name"`
 	Specular    Color   `json:"specular"`
 	Diffuse     Color   `json:"diffuse"`
 	Ambient     Color   `json:"ambient"`
 	Alpha       float64 `json:"alpha"`
 	Reflectance float64 `json:"reflectance"`
+	Fresnel     bool    `json:"fresnel"`
+	Roughness   float64 `json:"roughness"`
+	// Unlit materials ignore lights and show their diffuse color as is, such as for backgrounds and markers
+	Unlit bool `json:"unlit"`
+	// Transmittance is the fraction of the light not reflected which is refracted through the surface
+	Transmittance   float64  `json:"transmittance"`
+	RefractiveIndex *float64 `json:"refractiveIndex"`
+	// Dispersion is how much the refractive index increases from red to green and from green to blue light
+	Dispersion float64 `json:"dispersion"`
+	Bump       *Bump   `json:"bump"`
+	// Procedural is a solid pattern replacing the diffuse color, evaluated at the hit position
+	Procedural *Procedural `json:"procedural"`
+	// Gradient maps the height or surface normal of hits through a color ramp replacing the diffuse color
+	Gradient *Gradient `json:"gradient"`
+	// Wear blends the material towards worn parameters in patches of noise, evaluated at the hit position
+	Wear *Wear `json:"wear"`
+	// Absorption is the fraction of each color absorbed per unit distance travelled inside the material
+	Absorption Color `json:"absorption"`
+	// DiffuseRoughness is the standard deviation in radians of the facet angles of Oren-Nayar lighting
+	DiffuseRoughness float64 `json:"diffuseRoughness"`
+	// RoughnessU and RoughnessV are the roughness of Ward lighting along and across the tangent direction
+	RoughnessU float64 `json:"roughnessU"`
+	RoughnessV float64 `json:"roughnessV"`
+	// Tangent is the direction of RoughnessU, such as the grain of brushed metal, projected onto each surface
+	Tangent *Vector `json:"tangent"`
+	// Texture is the path of an image replacing the diffuse color, mapped by the surface coordinates of hits
+	Texture       string `json:"texture"`
+	TextureFilter string `json:"textureFilter"`
+	TextureWrap   string `json:"textureWrap"`
+	texture       *Texture
+}
+
+// UnmarshalJSON unmarshals a Material, using defaults for omitted fields so a material can be partially
+// specified: white specular, mid-gray diffuse, no ambient, an alpha of 1.0 and no reflectance
+func (m *Material) UnmarshalJSON(b []byte) error {
+	type Alias Material
+	auxiliary := &struct {
+		Specular *Color   `json:"specular"`
+		Diffuse  *Color   `json:"diffuse"`
+		Alpha    *float64 `json:"alpha"`
+		*Alias
+	}{
+		Alias: (*Alias)(m),
+	}
+	if err := json.Unmarshal(b, &auxiliary); err != nil {
+		return NestJSONError(b, err)
+	}
+
+	m.Specular = Color{Red: 1.0, Green: 1.0, Blue: 1.0}
+	if auxiliary.Specular != nil {
+		m.Specular = *auxiliary.Specular
+	}
+	m.Diffuse = Color{Red: 0.5, Green: 0.5, Blue: 0.5}
+	if auxiliary.Diffuse != nil {
+		m.Diffuse = *auxiliary.Diffuse
+	}
+	m.Alpha = 1.0
+	if auxiliary.Alpha != nil {
+		m.Alpha = *auxiliary.Alpha
+	}
+	return nil
+}
+
+// LoadTexture loads the texture of the material, if it has one, resolving a relative path against directory
+func (m *Material) LoadTexture(directory string) error {
+	if m.Texture == "" {
+		return nil
+	}
+
+	if m.TextureFilter == "" {
+		m.TextureFilter = FilterBilinear
+	}
+	if m.TextureWrap == "" {
+		m.TextureWrap = WrapRepeat
+	}
+
+	path := m.Texture
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(directory, path)
+	}
+
+	texture, err := LoadTexture(path, m.TextureFilter, m.TextureWrap)
+	if err != nil {
+		return fmt.Errorf("unable to load texture %s: %v", m.Texture, err)
+	}
+	m.texture = texture
+	return nil
+}
+
+// Textured returns the material with its diffuse color replaced by its texture at the surface coordinates u and v
+func (m Material) Textured(u float64, v float64) Material {
+	if m.texture != nil {
+		m.Diffuse = m.texture.Sample(u, v)
+	}
+	return m
+}
+
+// Patterned returns the material with its diffuse color replaced by its procedural pattern at a position
+func (m Material) Patterned(position Vector) Material {
+	if m.Procedural != nil {
+		m.Diffuse = m.Procedural.ColorAt(position)
+	}
+	return m
+}
+
+// Graded returns the material with its diffuse color replaced by its gradient for a hit at a position
+// with the given surface normal
+func (m Material) Graded(position Vector, normal Vector) Material {
+	if m.Gradient != nil {
+		m.Diffuse = m.Gradient.ColorAt(position, normal)
+	}
+	return m
+}
+
+// ReflectanceAt returns the reflectance of the material when viewed at an angle with the given cosine
+// to the surface normal. With Fresnel enabled, Schlick's approximation is used so reflectance rises
+// from the base reflectance when viewed head-on towards total reflection at grazing angles
+func (m Material) ReflectanceAt(cosine float64) float64 {
+	if !m.Fresnel {
+		return m.Reflectance
+	}
+
+	return m.Reflectance + (1.0-m.Reflectance)*math.Pow(1.0-math.Abs(cosine), 5.0)
+}
+
+// defaultRefractiveIndex is the refractive index of glass, used when a material doesn't specify one
+const defaultRefractiveIndex = 1.5
+
+// RefractiveIndexOf returns the refractive index of the material for light of the given channel
+func (m Material) RefractiveIndexOf(channel Channel) float64 {
+	index := defaultRefractiveIndex
+	if m.RefractiveIndex != nil {
+		index = *m.RefractiveIndex
+	}
+
+	switch channel {
+	case RedChannel:
+		return index - m.Dispersion
+	case BlueChannel:
+		return index + m.Dispersion
+	}
+	return index
+}
+
+// Transmission returns the fraction of each color remaining after travelling distance through the material,
+// which decays exponentially with distance by the Beer-Lambert law
+func (m Material) Transmission(distance float64) Color {
+	return Color{
+		Red:   math.Exp(-m.Absorption.Red * distance),
+		Green: math.Exp(-m.Absorption.Green * distance),
+		Blue:  math.Exp(-m.Absorption.Blue * distance),
+	}
 }
 
 // Light describes a light source
 type Light struct {
-	Position Vector `json:"position"`
-	Specular Color  `json:"specular"`
-	Diffuse  Color  `json:"diffuse"`
-	Ambient  Color  `json:"ambient"`
+	Position  Vector   `json:"position"`
+	Specular  Color    `json:"specular"`
+	Diffuse   Color    `json:"diffuse"`
+	Ambient   Color    `json:"ambient"`
+	Intensity *float64 `json:"intensity"`
+	// Radius of a sphere drawn at the light's position in its diffuse color, so the light is visible
+	Radius *float64 `json:"radius"`
+}
+
+// IntensityScale returns the multiplier applied to every component of the light, which defaults to 1.0
+func (l Light) IntensityScale() float64 {
+	if l.Intensity == nil {
+		return 1.0
+	}
+	return *l.Intensity
+}
+
+// VisibleLight is a light which reaches a location, along with the normalized direction
+// from that location to the light and the distance to it
+type VisibleLight struct {
+	Light
+	Direction Vector
+	Distance  float64
+}
+
+// NewVisibleLight precomputes the direction and distance from position to the light.
+// Returns false if the light is at the position, and so has no direction
+func NewVisibleLight(light Light, position Vector) (VisibleLight, bool) {
+	dist := light.Position.Subtract(position)
+	direction, ok := dist.Normalize()
+	return VisibleLight{Light: light, Direction: direction, Distance: dist.Magnitude()}, ok
 }
 
 // LightingModel is a function type that takes information about a location,
 // calculates lighting using a specific lighitng model and returns a color for
 // that location. The surface normal vector should be normalized.
-type LightingModel func(lights []Light, ambientLight Color, viewer Vector, position Vector, normal Vector, material Material) (color Color)
+type LightingModel func(lights []VisibleLight, ambientLight Color, viewer Vector, position Vector, normal Vector, material Material) (color Color)
 
 // LambertianLighting calculates the Lambertian lighting model. The surface normal vector should be normalized.
-func LambertianLighting(lights []Light, _ Color, _ Vector, position Vector, normal Vector, material Material) (color Color) {
+func LambertianLighting(lights []VisibleLight, _ Color, _ Vector, _ Vector, normal Vector, material Material) (color Color) {
 	for _, light := range lights {
-		dist := light.Position.Subtract(position)
+		lightVec := light.Direction
 
 		// Light doesn't reach surface - angle between surface normal and light is more than 90
-		if normal.Dot(dist) <= 0.0 {
-			continue
-		}
-
-		// Normalize light ray
-		lightVec, ok := dist.Normalize()
-		if !ok {
+		if normal.Dot(lightVec) <= 0.0 {
 			continue
 		}
 
 		// Lambertian diffusion
-		surfaceLightLevel := lightVec.Dot(normal)
-		color.Red += surfaceLightLevel * light.Diffuse.Red * material.Diffuse.Red
-		color.Green += surfaceLightLevel * light.Diffuse.Green * material.Diffuse.Green
-		color.Blue += surfaceLightLevel * light.Diffuse.Blue * material.Diffuse.Blue
+		surfaceLightLevel := lightVec.Dot(normal) * light.IntensityScale()
+		color = color.Add(light.Diffuse.Multiply(material.Diffuse).Scale(surfaceLightLevel))
 	}
 	return
 }
 
-// PhongLighting calculates the Phong lighting model. The surface normal vector should be normalized.
-func PhongLighting(lights []Light, ambientLight Color, viewer Vector, position Vector, normal Vector, material Material) (color Color) {
+// OrenNayarLighting calculates the Oren-Nayar lighting model, a diffuse model for rough matte surfaces which
+// are brighter than Lambertian surfaces when lit from behind the viewer. With a DiffuseRoughness of zero it is
+// identical to the Lambertian model. The surface normal vector should be normalized.
+func OrenNayarLighting(lights []VisibleLight, _ Color, viewer Vector, _ Vector, normal Vector, material Material) (color Color) {
+	variance := material.DiffuseRoughness * material.DiffuseRoughness
+	a := 1.0 - 0.5*variance/(variance+0.33)
+	b := 0.45 * variance / (variance + 0.09)
+
+	viewerCos := math.Min(viewer.Dot(normal), 1.0)
+	viewerAngle := math.Acos(math.Max(viewerCos, 0.0))
+	viewerPlanar, viewerOk := viewer.Subtract(normal.Scale(viewerCos)).Normalize()
+
 	for _, light := range lights {
-		dist := light.Position.Subtract(position)
+		lightVec := light.Direction
 
 		// Light doesn't reach surface - angle between surface normal and light is more than 90
-		if normal.Dot(dist) <= 0.0 {
+		lightCos := math.Min(normal.Dot(lightVec), 1.0)
+		if lightCos <= 0.0 {
 			continue
 		}
+		lightAngle := math.Acos(lightCos)
 
-		// Normalize light ray
-		lightVec, ok := dist.Normalize()
-		if !ok {
+		// Brightening depends on how closely the light and viewer directions line up around the normal
+		azimuthCos := 0.0
+		if lightPlanar, ok := lightVec.Subtract(normal.Scale(lightCos)).Normalize(); ok && viewerOk {
+			azimuthCos = math.Max(0.0, lightPlanar.Dot(viewerPlanar))
+		}
+
+		alpha := math.Max(lightAngle, viewerAngle)
+		beta := math.Min(lightAngle, viewerAngle)
+
+		surfaceLightLevel := lightCos * (a + b*azimuthCos*math.Sin(alpha)*math.Tan(beta)) * light.IntensityScale()
+		color = color.Add(light.Diffuse.Multiply(material.Diffuse).Scale(surfaceLightLevel))
+	}
+	return
+}
+
+// PhongLighting calculates the Phong lighting model. The surface normal vector should be normalized.
+func PhongLighting(lights []VisibleLight, ambientLight Color, viewer Vector, _ Vector, normal Vector, material Material) (color Color) {
+	for _, light := range lights {
+		lightVec := light.Direction
+
+		// Light doesn't reach surface - angle between surface normal and light is more than 90
+		if normal.Dot(lightVec) <= 0.0 {
 			continue
 		}
 
@@ -84,49 +393,175 @@ func PhongLighting(lights []Light, ambientLight Color, viewer Vector, position V
 		reflectDiff := normal.Scale(2.0 * lightVec.Dot(normal))
 		reflectedLight := reflectDiff.Subtract(lightVec)
 
-		reflectedLight, ok = reflectedLight.Normalize()
+		reflectedLight, ok := reflectedLight.Normalize()
 		if !ok {
 			continue
 		}
 
-		diffCoef := math.Max(0.0, lightVec.Dot(normal))
-		diffuse := Color{
-			Red:   diffCoef * light.Diffuse.Red * material.Diffuse.Red,
-			Green: diffCoef * light.Diffuse.Green * material.Diffuse.Green,
-			Blue:  diffCoef * light.Diffuse.Blue * material.Diffuse.Blue}
+		intensity := light.IntensityScale()
+
+		diffCoef := math.Max(0.0, lightVec.Dot(normal)) * intensity
+		diffuse := light.Diffuse.Multiply(material.Diffuse).Scale(diffCoef)
 
 		specBase := math.Max(0.0, reflectedLight.Dot(viewer))
-		specCoef := math.Pow(specBase, material.Alpha)
+		specCoef := math.Pow(specBase, material.Alpha) * intensity
 		if specBase <= 0.0 {
 			specCoef = 0.0
 		}
 
-		specular := Color{
-			Red:   specCoef * light.Specular.Red * material.Specular.Red,
-			Green: specCoef * light.Specular.Green * material.Specular.Green,
-			Blue:  specCoef * light.Specular.Blue * material.Specular.Blue}
+		specular := light.Specular.Multiply(material.Specular).Scale(specCoef)
 
-		color.Red += diffuse.Red + specular.Red
-		color.Green += diffuse.Green + specular.Green
-		color.Blue += diffuse.Blue + specular.Blue
+		color = color.Add(diffuse).Add(specular)
 	}
 
-	color.Red += ambientLight.Red * material.Ambient.Red
-	color.Green += ambientLight.Green * material.Ambient.Green
-	color.Blue += ambientLight.Blue * material.Ambient.Blue
+	return color.Add(ambientLight.Multiply(material.Ambient))
+}
 
-	return
+// defaultWardRoughness is the Ward roughness used when a material doesn't specify one
+const defaultWardRoughness = 0.1
+
+// WardLighting calculates the anisotropic Ward lighting model, whose highlights are stretched along the material's
+// tangent direction when RoughnessU and RoughnessV differ. Diffuse and ambient lighting match the Phong model.
+// The surface normal vector should be normalized.
+func WardLighting(lights []VisibleLight, ambientLight Color, viewer Vector, _ Vector, normal Vector, material Material) (color Color) {
+	roughnessU, roughnessV := material.RoughnessU, material.RoughnessV
+	if roughnessU <= 0.0 {
+		roughnessU = defaultWardRoughness
+	}
+	if roughnessV <= 0.0 {
+		roughnessV = defaultWardRoughness
+	}
+
+	tangent, bitangent := tangentFrame(normal, material.Tangent)
+	viewerCos := viewer.Dot(normal)
+
+	for _, light := range lights {
+		lightVec := light.Direction
+
+		// Light doesn't reach surface - angle between surface normal and light is more than 90
+		lightCos := normal.Dot(lightVec)
+		if lightCos <= 0.0 {
+			continue
+		}
+
+		intensity := light.IntensityScale()
+		color = color.Add(light.Diffuse.Multiply(material.Diffuse).Scale(lightCos * intensity))
+
+		halfway, ok := lightVec.Add(viewer).Normalize()
+		if !ok || viewerCos <= 0.0 {
+			continue
+		}
+
+		// The Ward reflectance, scaled by pi to match the unnormalized diffuse term
+		u := halfway.Dot(tangent) / roughnessU
+		v := halfway.Dot(bitangent) / roughnessV
+		h := halfway.Dot(normal)
+		reflectance := math.Exp(-(u*u+v*v)/(h*h)) / (4.0 * roughnessU * roughnessV * math.Sqrt(lightCos*viewerCos))
+
+		specular := light.Specular.Multiply(material.Specular).Scale(reflectance * lightCos * intensity)
+		color = color.Add(specular)
+	}
+
+	return color.Add(ambientLight.Multiply(material.Ambient))
+}
+
+// tangentFrame returns unit tangent and bitangent vectors perpendicular to the normal, with the tangent as close
+// as possible to the direction, which defaults to the x axis
+func tangentFrame(normal Vector, direction *Vector) (Vector, Vector) {
+	preferred := Vector{X: 1, Y: 0, Z: 0}
+	if direction != nil {
+		preferred = *direction
+	}
+
+	tangent, ok := preferred.Subtract(preferred.ProjectOnto(normal)).Normalize()
+	if !ok {
+		// The direction is parallel to the normal, so any perpendicular tangent will do
+		axis := Vector{X: 0, Y: 1, Z: 0}
+		if math.Abs(normal.Y) > 0.9 {
+			axis = Vector{X: 0, Y: 0, Z: 1}
+		}
+		tangent, _ = normal.Cross(axis).Normalize()
+	}
+
+	return tangent, normal.Cross(tangent)
 }
 
 // AverageColors returns the average of a slice of Color
 func AverageColors(colors []Color) (average Color) {
 	for _, color := range colors {
-		average.Red += color.Red
-		average.Green += color.Green
-		average.Blue += color.Blue
+		average = average.Add(color)
 	}
-	average.Red /= float64(len(colors))
-	average.Green /= float64(len(colors))
-	average.Blue /= float64(len(colors))
-	return
+	return average.Scale(1.0 / float64(len(colors)))
+}
+
+// Add returns the sum of two colors
+func (c Color) Add(other Color) Color {
+	return Color{
+		Red:   c.Red + other.Red,
+		Green: c.Green + other.Green,
+		Blue:  c.Blue + other.Blue,
+	}
+}
+
+// Scale returns the color with each channel multiplied by scale
+func (c Color) Scale(scale float64) Color {
+	return Color{
+		Red:   c.Red * scale,
+		Green: c.Green * scale,
+		Blue:  c.Blue * scale,
+	}
+}
+
+// Multiply returns the channel-wise product of two colors, such as a light color filtered by a surface color
+func (c Color) Multiply(other Color) Color {
+	return Color{
+		Red:   c.Red * other.Red,
+		Green: c.Green * other.Green,
+		Blue:  c.Blue * other.Blue,
+	}
+}
+
+// Blend linearly interpolates from the color to other, where t of 0.0 is the color and 1.0 is other
+func (c Color) Blend(other Color, t float64) Color {
+	return Color{
+		Red:   lerp(c.Red, other.Red, t),
+		Green: lerp(c.Green, other.Green, t),
+		Blue:  lerp(c.Blue, other.Blue, t),
+	}
+}
+
+// Isolate returns the color with every channel except the given one set to zero
+func (c Color) Isolate(channel Channel) Color {
+	switch channel {
+	case RedChannel:
+		return Color{Red: c.Red}
+	case GreenChannel:
+		return Color{Green: c.Green}
+	case BlueChannel:
+		return Color{Blue: c.Blue}
+	}
+	return c
+}
+
+// Clamp returns the color with each channel limited to between min and max
+func (c Color) Clamp(min float64, max float64) Color {
+	return Color{
+		Red:   math.Max(min, math.Min(c.Red, max)),
+		Green: math.Max(min, math.Min(c.Green, max)),
+		Blue:  math.Max(min, math.Min(c.Blue, max)),
+	}
+}
+
+// SanitizeNaN returns the color with any NaN channels replaced by zero
+func (c Color) SanitizeNaN() Color {
+	if math.IsNaN(c.Red) {
+		c.Red = 0.0
+	}
+	if math.IsNaN(c.Green) {
+		c.Green = 0.0
+	}
+	if math.IsNaN(c.Blue) {
+		c.Blue = 0.0
+	}
+	return c
 }
@@ -0,0 +1,210 @@
+package raytracing
+
+import (
+	"math"
+	"testing"
+)
+
+func TestColorOperators(t *testing.T) {
+	a := Color{Red: 0.5, Green: 0.25, Blue: 1}
+	b := Color{Red: 0.25, Green: 2, Blue: -1}
+
+	tests := []struct {
+		name      string
+		got, want Color
+	}{
+		{"Add", a.Add(b), Color{Red: 0.75, Green: 2.25, Blue: 0}},
+		{"Add zero", a.Add(Color{}), a},
+		{"Scale", a.Scale(2), Color{Red: 1, Green: 0.5, Blue: 2}},
+		{"Scale by zero", a.Scale(0), Color{}},
+		{"Multiply", a.Multiply(b), Color{Red: 0.125, Green: 0.5, Blue: -1}},
+		{"Multiply by white", a.Multiply(Color{Red: 1, Green: 1, Blue: 1}), a},
+		{"Blend start", a.Blend(b, 0), a},
+		{"Blend end", a.Blend(b, 1), b},
+		{"Blend middle", a.Blend(b, 0.5), Color{Red: 0.375, Green: 1.125, Blue: 0}},
+		{"Isolate red", a.Isolate(RedChannel), Color{Red: 0.5}},
+		{"Isolate green", a.Isolate(GreenChannel), Color{Green: 0.25}},
+		{"Isolate blue", a.Isolate(BlueChannel), Color{Blue: 1}},
+		{"Isolate all", a.Isolate(AllChannels), a},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s = %v, want %v", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestColorClampAndSanitizeNaN(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name      string
+		got, want Color
+	}{
+		{"Clamp negative", Color{Red: -0.5, Green: 0.5, Blue: -2}.Clamp(0, 1), Color{Red: 0, Green: 0.5, Blue: 0}},
+		{"Clamp bright", Color{Red: 1.5, Green: 1, Blue: math.Inf(1)}.Clamp(0, 1), Color{Red: 1, Green: 1, Blue: 1}},
+		{"Clamp negative infinity", Color{Red: math.Inf(-1)}.Clamp(0, 1), Color{}},
+		{"SanitizeNaN", Color{Red: nan, Green: 0.5, Blue: nan}.SanitizeNaN(), Color{Red: 0, Green: 0.5, Blue: 0}},
+		{"SanitizeNaN keeps negatives", Color{Red: -1, Green: nan, Blue: 2}.SanitizeNaN(), Color{Red: -1, Green: 0, Blue: 2}},
+		{"SanitizeNaN then Clamp", Color{Red: nan, Green: -1, Blue: 3}.SanitizeNaN().Clamp(0, 1), Color{Red: 0, Green: 0, Blue: 1}},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s = %v, want %v", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestWardIsotropicReduction(t *testing.T) {
+	// With equal roughness along and across the tangent, Ward reflectance only depends on the angle delta between
+	// the halfway vector and the normal, as exp(-tan^2(delta)/a^2) / (4 a^2 sqrt(cos(i) cos(o))), here scaled by pi.
+	// The light is lightAngle degrees from the normal on one side, and the viewer viewerAngle degrees on the other
+	tests := []struct {
+		lightAngle, viewerAngle float64
+		roughness               float64
+		// want is the specular color, the reflectance times the cosine of the light angle
+		want float64
+	}{
+		{0, 0, 0.1, 25},
+		{60, 60, 0.1, 25},
+		{45, 45, 0.3, 2.777777778},
+		{30, 10, 0.2, 2.694022038},
+		{40, 0, 0.25, 0.4203983826},
+		{20, 50, 0.15, 0.5525824077},
+		{70, 30, 0.4, 0.4290422958},
+		// Zero roughness is the default of 0.1
+		{60, 60, 0, 25},
+	}
+
+	normal := Vector{X: 0, Y: 0, Z: 1}
+	tangents := []*Vector{nil, {X: 0, Y: 1, Z: 0}, {X: 0.6, Y: 0.8, Z: 0.5}}
+	for _, test := range tests {
+		material := Material{Specular: Color{Red: 1, Green: 1, Blue: 1}, RoughnessU: test.roughness, RoughnessV: test.roughness}
+		lightAngle, viewerAngle := test.lightAngle*math.Pi/180.0, test.viewerAngle*math.Pi/180.0
+
+		// Isotropic reflectance is the same whichever way the tangent points and however the plane of the light
+		// and viewer is turned about the normal
+		for _, tangent := range tangents {
+			material.Tangent = tangent
+			for _, azimuth := range []float64{0, 1, 2.5} {
+				in := Vector{X: math.Sin(lightAngle) * math.Cos(azimuth), Y: math.Sin(lightAngle) * math.Sin(azimuth), Z: math.Cos(lightAngle)}
+				viewer := Vector{X: -math.Sin(viewerAngle) * math.Cos(azimuth), Y: -math.Sin(viewerAngle) * math.Sin(azimuth), Z: math.Cos(viewerAngle)}
+				light := VisibleLight{Light: Light{Specular: Color{Red: 1, Green: 1, Blue: 1}}, Direction: in, Distance: 1}
+
+				color := WardLighting([]VisibleLight{light}, Color{}, viewer, Vector{}, normal, material)
+				if math.Abs(color.Red-test.want) > 1e-9*math.Max(1.0, test.want) {
+					t.Errorf("light at %v, viewer at %v, roughness %v, tangent %v, azimuth %v: specular is %v, want %v", test.lightAngle, test.viewerAngle, test.roughness, tangent, azimuth, color.Red, test.want)
+				}
+			}
+		}
+	}
+}
+
+// directionAt returns the unit vector at angle degrees from the z axis, turned azimuth degrees about it from the x axis
+func directionAt(angle, azimuth float64) Vector {
+	angle, azimuth = angle*math.Pi/180.0, azimuth*math.Pi/180.0
+	return Vector{X: math.Sin(angle) * math.Cos(azimuth), Y: math.Sin(angle) * math.Sin(azimuth), Z: math.Cos(angle)}
+}
+
+func TestOrenNayarLighting(t *testing.T) {
+	normal := Vector{X: 0, Y: 0, Z: 1}
+	white := Color{Red: 1, Green: 1, Blue: 1}
+	lightFrom := func(direction Vector) []VisibleLight {
+		return []VisibleLight{{Light: Light{Diffuse: white}, Direction: direction, Distance: 1}}
+	}
+
+	// Light and viewer directions, as angles from the normal and azimuths about it in degrees, including grazing
+	// and retroreflecting directions, and viewers below the horizon as seen across silhouettes
+	angles := []float64{0, 30, 60, 85, 89.9, 89.9999}
+	azimuths := []float64{0, 45, 90, 180}
+	for _, lightAngle := range angles {
+		for _, viewerAngle := range append(angles, 90, 95) {
+			for _, azimuth := range azimuths {
+				lights := lightFrom(directionAt(lightAngle, 0))
+				viewer := directionAt(viewerAngle, azimuth)
+
+				// At zero roughness it is exactly Lambertian
+				material := Material{Diffuse: white}
+				lambert := LambertianLighting(lights, Color{}, viewer, Vector{}, normal, material)
+				if got := OrenNayarLighting(lights, Color{}, viewer, Vector{}, normal, material); math.Abs(got.Red-lambert.Red) > 1e-12 {
+					t.Errorf("light at %v, viewer at %v, azimuth %v: smooth surface is %v, Lambertian is %v", lightAngle, viewerAngle, azimuth, got.Red, lambert.Red)
+				}
+
+				// Rough surfaces stay finite at grazing angles, as cos(i) tan(beta) is at most sin(i)
+				for _, roughness := range []float64{0.3, 1.0} {
+					material.DiffuseRoughness = roughness
+					variance := roughness * roughness
+					limit := 1.0 - 0.5*variance/(variance+0.33) + 0.45*variance/(variance+0.09)
+					if got := OrenNayarLighting(lights, Color{}, viewer, Vector{}, normal, material); math.IsNaN(got.Red) || got.Red < 0.0 || got.Red > limit+1e-9 {
+						t.Errorf("light at %v, viewer at %v, azimuth %v, roughness %v: rough surface is %v, want between 0 and %v", lightAngle, viewerAngle, azimuth, roughness, got.Red, limit)
+					}
+				}
+			}
+		}
+	}
+
+	// Lit from behind the viewer, rough surfaces retroreflect as cos(t) (A + B sin(t) tan(t)), so compared to a
+	// Lambertian surface, which is lit as cos(t), they brighten towards grazing angles
+	material := Material{Diffuse: white, DiffuseRoughness: 0.5}
+	a, b := 1.0-0.5*0.25/(0.25+0.33), 0.45*0.25/(0.25+0.09)
+	previous := 0.0
+	for _, angle := range []float64{0, 30, 60, 80} {
+		direction := directionAt(angle, 0)
+		got := OrenNayarLighting(lightFrom(direction), Color{}, direction, Vector{}, normal, material).Red
+
+		theta := angle * math.Pi / 180.0
+		if want := math.Cos(theta) * (a + b*math.Sin(theta)*math.Tan(theta)); math.Abs(got-want) > 1e-9 {
+			t.Errorf("retroreflection at %v: rough surface is %v, want %v", angle, got, want)
+		}
+		if brightening := got / math.Cos(theta); brightening <= previous {
+			t.Errorf("retroreflection at %v: rough surface is %v times as bright as Lambertian, no more than %v closer to the normal", angle, brightening, previous)
+		} else {
+			previous = brightening
+		}
+
+		// Viewed from the opposite side of the normal instead the surface is never brighter than when retroreflecting
+		if opposite := OrenNayarLighting(lightFrom(direction), Color{}, directionAt(angle, 180), Vector{}, normal, material).Red; angle > 0 && opposite >= got {
+			t.Errorf("at %v: viewed opposite the light is %v, retroreflection %v", angle, opposite, got)
+		}
+	}
+	if previous < 2.0 {
+		t.Errorf("retroreflection at 80 is %v times as bright as Lambertian, want at least twice", previous)
+	}
+}
+
+func TestRayMedia(t *testing.T) {
+	var r Ray
+	check := func(name string, medium, outer float64) {
+		t.Helper()
+		if r.MediumIndex() != medium || r.OuterIndex() != outer {
+			t.Errorf("%s: medium index %v and outer index %v, want %v and %v", name, r.MediumIndex(), r.OuterIndex(), medium, outer)
+		}
+	}
+
+	check("in air", 1.0, 1.0)
+	r.Enter(1.5)
+	check("in glass", 1.5, 1.0)
+	r.Enter(1.33)
+	check("in water in glass", 1.33, 1.5)
+
+	// Beyond the media kept track of, the last one kept is taken as the innermost
+	for i := 2; i < MaxMedia+2; i++ {
+		r.Enter(2.0 + float64(i))
+	}
+	last := 2.0 + float64(MaxMedia-1)
+	check("too deep", last, last)
+	for i := 2; i < MaxMedia+2; i++ {
+		r.Leave()
+	}
+	check("back in water in glass", 1.33, 1.5)
+
+	// Copies of the ray keep track of their media separately
+	copied := r
+	copied.Leave()
+	check("after leaving a copy", 1.33, 1.5)
+
+	r.Leave()
+	r.Leave()
+	check("back in air", 1.0, 1.0)
+	r.Leave()
+	check("leaving air", 1.0, 1.0)
+}
@@ -34,6 +34,23 @@ func (v Vector) Magnitude() float64 {
 	return math.Sqrt(v.Dot(v))
 }
 
+// DistanceTo returns the distance between the points at this and the other vector
+func (v Vector) DistanceTo(other Vector) float64 {
+	return other.Subtract(v).Magnitude()
+}
+
+// AngleBetween returns the angle in radians between this and the other vector, from 0 to pi.
+// The zero vector has no direction, so the angle to it is 0
+func (v Vector) AngleBetween(other Vector) float64 {
+	magnitudes := v.Magnitude() * other.Magnitude()
+	if magnitudes <= 0.0 {
+		return 0.0
+	}
+	// Rounding can push the cosine of nearly parallel vectors slightly outside of -1.0 to 1.0
+	cosine := math.Max(-1.0, math.Min(v.Dot(other)/magnitudes, 1.0))
+	return math.Acos(cosine)
+}
+
 // Add returns the sum of this and the other vector
 func (v Vector) Add(other Vector) Vector {
 	return Vector{
@@ -69,6 +86,47 @@ func (v Vector) Scale(scale float64) Vector {
 		Z: v.Z * scale}
 }
 
+// ClampMagnitude returns the vector scaled down to a magnitude of max if it is longer, keeping its direction.
+// Vectors no longer than max, including the zero vector, are unchanged, and a max of 0 or less gives the zero vector
+func (v Vector) ClampMagnitude(max float64) Vector {
+	if max <= 0.0 {
+		return Vector{}
+	}
+	magnitude := v.Magnitude()
+	if magnitude <= max {
+		return v
+	}
+	return v.Scale(max / magnitude)
+}
+
+// ProjectOnto returns the component of the vector parallel to the other vector, so subtracting it
+// projects the vector onto the plane perpendicular to other. Projecting onto the zero vector, which
+// has no direction, gives the zero vector
+func (v Vector) ProjectOnto(other Vector) Vector {
+	squared := other.Dot(other)
+	if squared <= 0.0 {
+		return Vector{}
+	}
+	return other.Scale(v.Dot(other) / squared)
+}
+
+// Reflect returns the vector reflected across the plane with the specified normal, which should be normalized
+func (v Vector) Reflect(normal Vector) Vector {
+	return v.Subtract(normal.Scale(2.0 * v.Dot(normal)))
+}
+
+// Refract returns the normalized vector v refracted through a surface with the specified normal, which faces
+// against v, where eta is the ratio of the refractive index v travels from to the one it enters. Returns
+// false if the vector is totally internally reflected. v and the normal should be normalized
+func (v Vector) Refract(normal Vector, eta float64) (Vector, bool) {
+	cosine := -v.Dot(normal)
+	k := 1.0 - eta*eta*(1.0-cosine*cosine)
+	if k < 0.0 {
+		return Vector{}, false
+	}
+	return v.Scale(eta).Add(normal.Scale(eta*cosine - math.Sqrt(k))).Normalize()
+}
+
 // Normalize returns a boolean indicating success
 func (v Vector) Normalize() (Vector, bool) {
 	mag := v.Magnitude()
@@ -0,0 +1,91 @@
+package raytracing
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRefractTotalInternalReflection(t *testing.T) {
+	// Leaving glass of index 1.5 into air, the critical angle is asin(1/1.5), about 41.8 degrees
+	normal := Vector{X: 0, Y: -1, Z: 0}
+	eta := 1.5
+
+	tests := []struct {
+		angle     float64
+		refracted bool
+	}{
+		{0.0, true},
+		{30.0, true},
+		{41.0, true},
+		{42.0, false},
+		{60.0, false},
+		{89.0, false},
+	}
+	for _, test := range tests {
+		radians := test.angle * math.Pi / 180.0
+		v := Vector{X: math.Sin(radians), Y: math.Cos(radians), Z: 0}
+
+		refracted, ok := v.Refract(normal, eta)
+		if ok != test.refracted {
+			t.Errorf("at %v degrees, refracted = %v, want %v", test.angle, ok, test.refracted)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if math.IsNaN(refracted.X) || math.IsNaN(refracted.Y) || math.IsNaN(refracted.Z) {
+			t.Errorf("at %v degrees, refracted direction %v is NaN", test.angle, refracted)
+		}
+		// Snell's law: the sine of the angle is scaled by eta, and the ray continues out through the surface
+		if sine := refracted.X; math.Abs(sine-eta*math.Sin(radians)) > 1e-9 || refracted.Y <= 0.0 {
+			t.Errorf("at %v degrees, refracted direction %v doesn't follow Snell's law", test.angle, refracted)
+		}
+	}
+}
+
+func TestClampMagnitude(t *testing.T) {
+	v := Vector{X: 3, Y: 0, Z: 4}
+	tests := []struct {
+		name   string
+		vector Vector
+		max    float64
+		want   Vector
+	}{
+		{"longer than max", v, 2.5, Vector{X: 1.5, Y: 0, Z: 2}},
+		{"exactly max", v, 5, v},
+		{"shorter than max", v, 10, v},
+		{"zero vector", Vector{}, 1, Vector{}},
+		{"zero max", v, 0, Vector{}},
+		{"negative max", v, -1, Vector{}},
+	}
+	for _, test := range tests {
+		if got := test.vector.ClampMagnitude(test.max); !got.Equals(test.want) {
+			t.Errorf("%s: %v.ClampMagnitude(%v) = %v, want %v", test.name, test.vector, test.max, got, test.want)
+		}
+	}
+}
+
+func TestProjectOnto(t *testing.T) {
+	tests := []struct {
+		name          string
+		vector, other Vector
+		want          Vector
+	}{
+		{"onto an axis", Vector{X: 2, Y: 3, Z: 4}, Vector{X: 0, Y: 5, Z: 0}, Vector{X: 0, Y: 3, Z: 0}},
+		{"onto a diagonal", Vector{X: 1, Y: 0, Z: 0}, Vector{X: 1, Y: 1, Z: 0}, Vector{X: 0.5, Y: 0.5, Z: 0}},
+		{"parallel", Vector{X: -2, Y: -4, Z: 0}, Vector{X: 1, Y: 2, Z: 0}, Vector{X: -2, Y: -4, Z: 0}},
+		{"perpendicular", Vector{X: 1, Y: 0, Z: 0}, Vector{X: 0, Y: 0, Z: 3}, Vector{}},
+		{"zero vector", Vector{}, Vector{X: 1, Y: 2, Z: 3}, Vector{}},
+		{"onto the zero vector", Vector{X: 1, Y: 2, Z: 3}, Vector{}, Vector{}},
+	}
+	for _, test := range tests {
+		got := test.vector.ProjectOnto(test.other)
+		if !got.Equals(test.want) {
+			t.Errorf("%s: %v.ProjectOnto(%v) = %v, want %v", test.name, test.vector, test.other, got, test.want)
+		}
+		// The remainder is perpendicular to other
+		if remainder := test.vector.Subtract(got); math.Abs(remainder.Dot(test.other)) > 1e-9 {
+			t.Errorf("%s: remainder %v isn't perpendicular to %v", test.name, remainder, test.other)
+		}
+	}
+}
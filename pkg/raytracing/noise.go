@@ -0,0 +1,51 @@
+package raytracing
+
+import (
+	"math"
+)
+
+// gradients are the directions to the edges of a cube, from which noise gradients at lattice points are chosen
+var gradients = [12]Vector{
+	{X: 1, Y: 1, Z: 0}, {X: -1, Y: 1, Z: 0}, {X: 1, Y: -1, Z: 0}, {X: -1, Y: -1, Z: 0},
+	{X: 1, Y: 0, Z: 1}, {X: -1, Y: 0, Z: 1}, {X: 1, Y: 0, Z: -1}, {X: -1, Y: 0, Z: -1},
+	{X: 0, Y: 1, Z: 1}, {X: 0, Y: -1, Z: 1}, {X: 0, Y: 1, Z: -1}, {X: 0, Y: -1, Z: -1},
+}
+
+// Noise returns gradient (Perlin) noise at p, which varies smoothly between about -1.0 and 1.0 and is zero
+// at the points of the integer lattice. The pattern is determined by the seed, so renders are reproducible
+func Noise(p Vector, seed int64) float64 {
+	x0, y0, z0 := math.Floor(p.X), math.Floor(p.Y), math.Floor(p.Z)
+	offset := Vector{X: p.X - x0, Y: p.Y - y0, Z: p.Z - z0}
+
+	// corner returns the contribution of the gradient at a corner of the lattice cell containing p
+	corner := func(dx float64, dy float64, dz float64) float64 {
+		hash := mix(uint64(seed))
+		hash = mix(hash ^ uint64(int64(x0+dx)))
+		hash = mix(hash ^ uint64(int64(y0+dy)))
+		hash = mix(hash ^ uint64(int64(z0+dz)))
+		return gradients[hash%12].Dot(offset.Subtract(Vector{X: dx, Y: dy, Z: dz}))
+	}
+
+	fx, fy, fz := fade(offset.X), fade(offset.Y), fade(offset.Z)
+	near := lerp(lerp(corner(0, 0, 0), corner(1, 0, 0), fx), lerp(corner(0, 1, 0), corner(1, 1, 0), fx), fy)
+	far := lerp(lerp(corner(0, 0, 1), corner(1, 0, 1), fx), lerp(corner(0, 1, 1), corner(1, 1, 1), fx), fy)
+	return lerp(near, far, fz)
+}
+
+// Turbulence sums the magnitude of octaves of noise at p, each at twice the frequency and half the
+// amplitude of the last, giving detail at many scales. The result is between 0.0 and about 1.0
+func Turbulence(p Vector, octaves int, seed int64) float64 {
+	sum := 0.0
+	amplitude := 0.5
+	for i := 0; i < octaves; i++ {
+		sum += amplitude * math.Abs(Noise(p, seed))
+		p = p.Scale(2.0)
+		amplitude *= 0.5
+	}
+	return sum / (1.0 - amplitude*2.0)
+}
+
+// fade eases t between 0.0 and 1.0 so interpolated noise has continuous first and second derivatives
+func fade(t float64) float64 {
+	return t * t * t * (t*(t*6.0-15.0) + 10.0)
+}
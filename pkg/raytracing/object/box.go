@@ -10,17 +10,30 @@ import (
 // Box is a representation of an axis aligned box
 type Box struct {
 	*Material
+	Culling
+	Visibility
+	Named
+	Placement
 	MinCorner raytracing.Vector `json:"minCorner"`
 	MaxCorner raytracing.Vector `json:"maxCorner"`
 	center    raytracing.Vector
 	extent    raytracing.Vector
 }
 
+// NewBox creates an axis aligned box between two opposite corners, using the material with the given id
+func NewBox(minCorner raytracing.Vector, maxCorner raytracing.Vector, material int) Box {
+	b := Box{Material: newMaterial(material), MinCorner: minCorner, MaxCorner: maxCorner}
+	b.Initialize()
+	return b
+}
+
 func boxFactory(data *json.RawMessage) (Object, error) {
 	obj := Box{}
 	if err := json.Unmarshal(*data, &obj); err != nil {
 		return obj, err
 	}
+	obj.MinCorner = obj.MinCorner.Add(obj.Offset)
+	obj.MaxCorner = obj.MaxCorner.Add(obj.Offset)
 	obj.Initialize()
 	return obj, nil
 }
@@ -41,9 +54,17 @@ func (b *Box) Initialize() {
 	b.extent = b.MaxCorner.Subtract(b.center)
 }
 
+// Degeneracy describes whether the box has zero volume, because its corners are equal along an axis
+func (b Box) Degeneracy() string {
+	if b.extent.X == 0.0 || b.extent.Y == 0.0 || b.extent.Z == 0.0 {
+		return "box has zero volume, its corners are equal along at least one axis"
+	}
+	return ""
+}
+
 // Intersect returns whether there is an intersection with r within maxRange,
-// and if so where it occurred. If there is no intersection, the scaling value will be maxRange
-func (b Box) Intersect(r raytracing.Ray, maxRange float64) (bool, float64) {
+// and if so describes it. If there is no intersection, the hit distance will be maxRange
+func (b Box) Intersect(r raytracing.Ray, maxRange float64) (bool, HitInfo) {
 	var tMin, tMax float64
 
 	x1 := (b.MinCorner.X - r.Position.X) / r.Direction.X
@@ -64,10 +85,23 @@ func (b Box) Intersect(r raytracing.Ray, maxRange float64) (bool, float64) {
 	tMin = math.Max(tMin, math.Min(z1, z2))
 	tMax = math.Min(tMax, math.Max(z1, z2))
 
-	if tMin < tMax && tMin > 1e-4 && tMin < maxRange {
-		return true, tMin
+	minDistance := r.MinDistance()
+	t := tMin
+	if t <= minDistance {
+		// The ray starts inside the box, such as when refracted into it, so it hits the far side
+		t = tMax
+	}
+
+	if tMin < tMax && t > minDistance && t < maxRange {
+		hit := surfaceHit(r, t)
+		hit.Normal = b.SurfaceNormal(raytracing.Ray{Position: hit.Position, Direction: r.Direction})
+		hit.BackFace = r.Direction.Dot(hit.Normal) > 0.0
+		if b.culled(hit) {
+			return false, miss(maxRange)
+		}
+		return true, hit
 	}
-	return false, maxRange
+	return false, miss(maxRange)
 }
 
 // SurfaceNormal returns the normal vector to the box
@@ -0,0 +1,129 @@
+package object
+
+import (
+	"math"
+	"sort"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+// bvhLeafSize is the largest number of triangles stored in a leaf of a bounding volume hierarchy
+const bvhLeafSize = 4
+
+// bvhNode is a node of a bounding volume hierarchy over triangles. Leaves hold a range of the
+// triangles, which are ordered during construction so each leaf's triangles are contiguous
+type bvhNode struct {
+	min   raytracing.Vector
+	max   raytracing.Vector
+	left  *bvhNode
+	right *bvhNode
+	first int
+	count int
+}
+
+// buildBVH reorders the triangles and builds a bounding volume hierarchy over them
+func buildBVH(triangles []Triangle) *bvhNode {
+	return buildBVHNode(triangles, 0)
+}
+
+func buildBVHNode(triangles []Triangle, first int) *bvhNode {
+	node := &bvhNode{first: first, count: len(triangles)}
+	node.min, node.max = triangleBounds(triangles)
+	if len(triangles) <= bvhLeafSize {
+		return node
+	}
+
+	// Split at the median centroid along the longest axis of the bounds
+	extent := node.max.Subtract(node.min)
+	axis := func(v raytracing.Vector) float64 { return v.X }
+	if extent.Y > extent.X && extent.Y >= extent.Z {
+		axis = func(v raytracing.Vector) float64 { return v.Y }
+	} else if extent.Z > extent.X && extent.Z > extent.Y {
+		axis = func(v raytracing.Vector) float64 { return v.Z }
+	}
+
+	sort.Slice(triangles, func(i, j int) bool {
+		return axis(centroid(triangles[i])) < axis(centroid(triangles[j]))
+	})
+
+	half := len(triangles) / 2
+	node.left = buildBVHNode(triangles[:half], first)
+	node.right = buildBVHNode(triangles[half:], first+half)
+	return node
+}
+
+// triangleBounds returns the bounding box of the triangles
+func triangleBounds(triangles []Triangle) (raytracing.Vector, raytracing.Vector) {
+	inf := math.Inf(1)
+	min := raytracing.Vector{X: inf, Y: inf, Z: inf}
+	max := raytracing.Vector{X: -inf, Y: -inf, Z: -inf}
+	for _, tr := range triangles {
+		trMin, trMax := tr.Bounds()
+		min = raytracing.Vector{X: math.Min(min.X, trMin.X), Y: math.Min(min.Y, trMin.Y), Z: math.Min(min.Z, trMin.Z)}
+		max = raytracing.Vector{X: math.Max(max.X, trMax.X), Y: math.Max(max.Y, trMax.Y), Z: math.Max(max.Z, trMax.Z)}
+	}
+	return min, max
+}
+
+func centroid(tr Triangle) raytracing.Vector {
+	return tr.A.Add(tr.B).Add(tr.C).Scale(1.0 / 3.0)
+}
+
+// intersect finds the closest intersection of r with the triangles in the hierarchy within maxRange
+func (n *bvhNode) intersect(triangles []Triangle, r raytracing.Ray, inverse raytracing.Vector, maxRange float64) (bool, HitInfo) {
+	if !n.hitsBounds(r, inverse, maxRange) {
+		return false, miss(maxRange)
+	}
+
+	if n.left == nil {
+		return intersectTriangles(triangles[n.first:n.first+n.count], r, maxRange)
+	}
+
+	intersected, hit := n.left.intersect(triangles, r, inverse, maxRange)
+	if rightIntersected, rightHit := n.right.intersect(triangles, r, inverse, hit.Distance); rightIntersected {
+		return true, rightHit
+	}
+	return intersected, hit
+}
+
+// hitsBounds returns whether r enters the bounding box of the node within maxRange, using the slab method
+func (n *bvhNode) hitsBounds(r raytracing.Ray, inverse raytracing.Vector, maxRange float64) bool {
+	near, far := 0.0, maxRange
+	slabs := [3][4]float64{
+		{r.Position.X, inverse.X, n.min.X, n.max.X},
+		{r.Position.Y, inverse.Y, n.min.Y, n.max.Y},
+		{r.Position.Z, inverse.Z, n.min.Z, n.max.Z},
+	}
+
+	for _, slab := range slabs {
+		t0 := (slab[2] - slab[0]) * slab[1]
+		t1 := (slab[3] - slab[0]) * slab[1]
+		if t0 > t1 {
+			t0, t1 = t1, t0
+		}
+
+		// NaN arises for rays parallel to and exactly on a slab boundary, which shouldn't exclude the box
+		if !math.IsNaN(t0) {
+			near = math.Max(near, t0)
+		}
+		if !math.IsNaN(t1) {
+			far = math.Min(far, t1)
+		}
+		if near > far {
+			return false
+		}
+	}
+	return true
+}
+
+// intersectTriangles finds the closest intersection of r with any of the triangles within maxRange
+func intersectTriangles(triangles []Triangle, r raytracing.Ray, maxRange float64) (bool, HitInfo) {
+	intersected := false
+	hit := miss(maxRange)
+	for _, tr := range triangles {
+		if ok, triangleHit := tr.Intersect(r, hit.Distance); ok {
+			intersected, hit = true, triangleHit
+		}
+	}
+	return intersected, hit
+}
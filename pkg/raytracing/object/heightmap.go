@@ -0,0 +1,159 @@
+package object
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	// Register decoders for the image formats supported for heightmaps
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+// Heightmap is a terrain mesh generated from a grayscale image, where brighter pixels are higher.
+// Pixels are spaced along the x axis by column and the z axis by row, with heights along the y axis
+type Heightmap struct {
+	Mesh
+	// File is the path of the PNG or JPEG image the terrain is generated from
+	File string `json:"file"`
+	// Scale is the distance between adjacent pixels
+	Scale *float64 `json:"scale"`
+	// Height is the height of white pixels, black pixels are at a height of zero
+	Height *float64 `json:"height"`
+}
+
+func heightmapFactory(data *json.RawMessage) (Object, error) {
+	obj := &Heightmap{}
+	if err := json.Unmarshal(*data, obj); err != nil {
+		return obj, err
+	}
+
+	if obj.File == "" {
+		return obj, fmt.Errorf("heightmap must specify an image file")
+	}
+	err := obj.validate()
+	return obj, err
+}
+
+// NewHeightmap creates the terrain mesh of a grayscale image, with pixels spaced by scale and white
+// pixels at the given height, using the material with the given id
+func NewHeightmap(img image.Image, scale float64, height float64, material int) (*Heightmap, error) {
+	h := &Heightmap{Mesh: Mesh{Material: newMaterial(material)}, Scale: &scale, Height: &height}
+	if err := h.validate(); err != nil {
+		return h, err
+	}
+
+	err := h.generate(img)
+	return h, err
+}
+
+// validate checks the scale and height and sets defaults
+func (h *Heightmap) validate() error {
+	if h.Scale == nil {
+		scale := 1.0
+		h.Scale = &scale
+	}
+	if *h.Scale <= 0.0 {
+		return fmt.Errorf("heightmap scale must be positive")
+	}
+	if h.Height == nil {
+		height := 1.0
+		h.Height = &height
+	}
+	return nil
+}
+
+// LoadFile loads the image of the heightmap and generates its mesh, resolving a relative path against directory
+func (h *Heightmap) LoadFile(directory string) error {
+	path := h.File
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(directory, path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to load heightmap %s: %v", h.File, err)
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return fmt.Errorf("unable to load heightmap %s: %v", h.File, err)
+	}
+	return h.generate(img)
+}
+
+// generate builds the vertices, faces and vertex normals of the terrain of an image
+func (h *Heightmap) generate(img image.Image) error {
+	bounds := img.Bounds()
+	width, depth := bounds.Dx(), bounds.Dy()
+	if width < 2 || depth < 2 {
+		return fmt.Errorf("heightmap image must be at least 2 by 2 pixels")
+	}
+
+	heights := make([]float64, width*depth)
+	for z := 0; z < depth; z++ {
+		for x := 0; x < width; x++ {
+			gray := color.Gray16Model.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+z)).(color.Gray16)
+			heights[z*width+x] = *h.Height * float64(gray.Y) / 0xffff
+		}
+	}
+
+	// slope returns the change in height per unit distance between samples a and b, which are steps apart
+	slope := func(a int, b int, steps int) float64 {
+		return (heights[b] - heights[a]) / (float64(steps) * *h.Scale)
+	}
+
+	h.Vertices = make([]raytracing.Vector, 0, width*depth)
+	h.Normals = make([]raytracing.Vector, 0, width*depth)
+	for z := 0; z < depth; z++ {
+		for x := 0; x < width; x++ {
+			h.Vertices = append(h.Vertices, raytracing.Vector{
+				X: float64(x) * *h.Scale,
+				Y: heights[z*width+x],
+				Z: float64(z) * *h.Scale,
+			})
+
+			// Slopes are estimated by central differences, or one-sided differences at the edges
+			left, right := z*width+maxInt(x-1, 0), z*width+minInt(x+1, width-1)
+			near, far := maxInt(z-1, 0)*width+x, minInt(z+1, depth-1)*width+x
+			h.Normals = append(h.Normals, raytracing.Vector{
+				X: -slope(left, right, right-left),
+				Y: 1.0,
+				Z: -slope(near, far, (far-near)/width),
+			})
+		}
+	}
+
+	// Each square between four pixels is split into two triangles, wound to face upwards
+	h.Faces = make([][3]int, 0, 2*(width-1)*(depth-1))
+	for z := 0; z < depth-1; z++ {
+		for x := 0; x < width-1; x++ {
+			corner := z*width + x
+			h.Faces = append(h.Faces,
+				[3]int{corner, corner + width, corner + 1},
+				[3]int{corner + 1, corner + width, corner + width + 1},
+			)
+		}
+	}
+
+	return h.Mesh.Initialize()
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,32 @@
+package object
+
+import (
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+// HitInfo describes an intersection between a ray and an object
+type HitInfo struct {
+	// Distance along the ray to the intersection, in multiples of the ray direction
+	Distance float64
+	Position raytracing.Vector
+	// Normal is the normalized surface normal at the intersection, used for shading
+	Normal raytracing.Vector
+	// U and V are surface coordinates of the intersection, which are barycentric for triangles
+	U float64
+	V float64
+	// BackFace is whether the ray hit the back or inside of the surface
+	BackFace bool
+}
+
+// miss returns the HitInfo for when there is no intersection within maxRange
+func miss(maxRange float64) HitInfo {
+	return HitInfo{Distance: maxRange}
+}
+
+// surfaceHit returns a HitInfo for an intersection at distance t along r, with the position filled in
+func surfaceHit(r raytracing.Ray, t float64) HitInfo {
+	return HitInfo{
+		Distance: t,
+		Position: r.Position.Add(r.Direction.Scale(t)),
+	}
+}
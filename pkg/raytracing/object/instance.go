@@ -0,0 +1,84 @@
+package object
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+// Instance places another named object elsewhere in the scene, sharing its geometry and material
+type Instance struct {
+	Visibility
+	Named
+	Placement
+	Of     string `json:"of"`
+	target Object
+}
+
+// NewInstance creates an instance of the object with the given name, moved by offset
+func NewInstance(of string, offset raytracing.Vector) *Instance {
+	return &Instance{Placement: Placement{Offset: offset}, Of: of}
+}
+
+func instanceFactory(data *json.RawMessage) (Object, error) {
+	obj := &Instance{}
+	if err := json.Unmarshal(*data, obj); err != nil {
+		return obj, err
+	}
+
+	if obj.Of == "" {
+		return obj, fmt.Errorf("instance must reference an object by name")
+	}
+	return obj, nil
+}
+
+// ResolveInstance looks up the object referenced by the instance
+func (i *Instance) ResolveInstance(objects map[string]Object) error {
+	target, ok := objects[i.Of]
+	if !ok {
+		return fmt.Errorf("instanced object %q is not defined", i.Of)
+	}
+	if _, ok := target.(*Instance); ok {
+		return fmt.Errorf("instanced object %q cannot itself be an instance", i.Of)
+	}
+
+	i.target = target
+	return nil
+}
+
+// Intersect returns whether there is an intersection with r within maxRange,
+// and if so describes it. If there is no intersection, the hit distance will be maxRange
+func (i *Instance) Intersect(r raytracing.Ray, maxRange float64) (bool, HitInfo) {
+	local := raytracing.Ray{Position: r.Position.Subtract(i.Offset), Direction: r.Direction, Kind: r.Kind, Epsilon: r.Epsilon}
+
+	intersected, hit := i.target.Intersect(local, maxRange)
+	if intersected {
+		hit.Position = hit.Position.Add(i.Offset)
+	}
+	return intersected, hit
+}
+
+// MaterialID returns the id of the material of the instanced object
+func (i *Instance) MaterialID() int {
+	return i.target.MaterialID()
+}
+
+// ModifyMaterial applies the material variation of the instanced object, if it has any
+func (i *Instance) ModifyMaterial(material raytracing.Material, hit HitInfo) raytracing.Material {
+	modifier, ok := i.target.(MaterialModifier)
+	if !ok {
+		return material
+	}
+
+	hit.Position = hit.Position.Subtract(i.Offset)
+	return modifier.ModifyMaterial(material, hit)
+}
+
+// TriangleCount returns the number of triangles in the instanced object
+func (i *Instance) TriangleCount() int {
+	if counter, ok := i.target.(TriangleCounter); ok {
+		return counter.TriangleCount()
+	}
+	return 0
+}
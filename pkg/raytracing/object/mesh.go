@@ -0,0 +1,121 @@
+package object
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+// Mesh is a collection of triangles sharing vertices and a material
+type Mesh struct {
+	*Material
+	Culling
+	Visibility
+	Named
+	Placement
+	Vertices []raytracing.Vector `json:"vertices"`
+	// Faces are triangles given by indices of their vertices A, B and C
+	Faces [][3]int `json:"faces"`
+	// Normals optionally holds a normal for each vertex, interpolated across faces for smooth shading
+	Normals []raytracing.Vector `json:"normals"`
+	// BVH enables a bounding volume hierarchy over the triangles, which is unnecessary for small meshes
+	BVH *bool `json:"bvh"`
+	// Watertight selects a slower intersection test for the triangles which never lets rays pass between faces
+	Watertight bool `json:"watertight"`
+	triangles  []Triangle
+	root       *bvhNode
+}
+
+func meshFactory(data *json.RawMessage) (Object, error) {
+	obj := Mesh{}
+	if err := json.Unmarshal(*data, &obj); err != nil {
+		return obj, err
+	}
+
+	err := obj.Initialize()
+	return obj, err
+}
+
+// NewMesh creates a mesh of triangles given by indices into the vertices, using the material with the given id
+func NewMesh(vertices []raytracing.Vector, faces [][3]int, material int) (Mesh, error) {
+	m := Mesh{Material: newMaterial(material), Vertices: vertices, Faces: faces}
+	err := m.Initialize()
+	return m, err
+}
+
+// Initialize builds the triangles of the mesh and their bounding volume hierarchy
+func (m *Mesh) Initialize() error {
+	if m.BVH == nil {
+		bvh := true
+		m.BVH = &bvh
+	}
+
+	if len(m.Normals) != 0 && len(m.Normals) != len(m.Vertices) {
+		return fmt.Errorf("mesh must have either no vertex normals or one for each vertex, has %d for %d vertices", len(m.Normals), len(m.Vertices))
+	}
+
+	m.triangles = make([]Triangle, 0, len(m.Faces))
+	for i, face := range m.Faces {
+		for _, vertex := range face {
+			if vertex < 0 || vertex >= len(m.Vertices) {
+				return fmt.Errorf("mesh face %d references vertex %d, must be between 0 and %d", i, vertex, len(m.Vertices)-1)
+			}
+		}
+
+		tr := Triangle{
+			Culling:    m.Culling,
+			Watertight: m.Watertight,
+			A:          m.Vertices[face[0]].Add(m.Offset),
+			B:          m.Vertices[face[1]].Add(m.Offset),
+			C:          m.Vertices[face[2]].Add(m.Offset),
+		}
+		if len(m.Normals) != 0 {
+			tr.Normals = []raytracing.Vector{m.Normals[face[0]], m.Normals[face[1]], m.Normals[face[2]]}
+		}
+		if err := tr.Initialize(); err != nil {
+			return fmt.Errorf("mesh face %d: %v", i, err)
+		}
+		m.triangles = append(m.triangles, tr)
+	}
+
+	if *m.BVH && len(m.triangles) > 0 {
+		m.root = buildBVH(m.triangles)
+	}
+	return nil
+}
+
+// Intersect returns whether there is an intersection with r within maxRange,
+// and if so describes it. If there is no intersection, the hit distance will be maxRange
+func (m Mesh) Intersect(r raytracing.Ray, maxRange float64) (bool, HitInfo) {
+	if m.root == nil {
+		return intersectTriangles(m.triangles, r, maxRange)
+	}
+
+	inverse := raytracing.Vector{X: 1.0 / r.Direction.X, Y: 1.0 / r.Direction.Y, Z: 1.0 / r.Direction.Z}
+	return m.root.intersect(m.triangles, r, inverse, maxRange)
+}
+
+// Bounds returns the minimum and maximum corners of the axis aligned bounding box of the mesh
+func (m Mesh) Bounds() (raytracing.Vector, raytracing.Vector) {
+	return triangleBounds(m.triangles)
+}
+
+// Degeneracy describes whether any faces of the mesh have zero area
+func (m Mesh) Degeneracy() string {
+	degenerate := 0
+	for _, tr := range m.triangles {
+		if tr.Degeneracy() != "" {
+			degenerate++
+		}
+	}
+	if degenerate > 0 {
+		return fmt.Sprintf("mesh has %d face(s) with zero area", degenerate)
+	}
+	return ""
+}
+
+// TriangleCount returns the number of triangles making up the object
+func (m Mesh) TriangleCount() int {
+	return len(m.triangles)
+}
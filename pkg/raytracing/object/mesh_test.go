@@ -0,0 +1,96 @@
+package object
+
+import (
+	"math"
+	"testing"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+// newSphereMesh returns a mesh approximating a sphere of radius 1 at the origin, made of the given number of
+// stacks from pole to pole and slices around its axis, which has 2*slices*(stacks-1) faces
+func newSphereMesh(t testing.TB, stacks, slices int, bvh bool) Mesh {
+	t.Helper()
+	vertices := []raytracing.Vector{{X: 0, Y: 1, Z: 0}}
+	for i := 1; i < stacks; i++ {
+		polar := math.Pi * float64(i) / float64(stacks)
+		for j := 0; j < slices; j++ {
+			azimuth := 2.0 * math.Pi * float64(j) / float64(slices)
+			vertices = append(vertices, raytracing.Vector{X: math.Sin(polar) * math.Cos(azimuth), Y: math.Cos(polar), Z: math.Sin(polar) * math.Sin(azimuth)})
+		}
+	}
+	vertices = append(vertices, raytracing.Vector{X: 0, Y: -1, Z: 0})
+	bottom := len(vertices) - 1
+
+	// ring returns the index of vertex j of ring i, where ring 1 is next to the top pole
+	ring := func(i, j int) int {
+		return 1 + (i-1)*slices + j%slices
+	}
+
+	faces := make([][3]int, 0, 2*slices*(stacks-1))
+	for j := 0; j < slices; j++ {
+		faces = append(faces, [3]int{0, ring(1, j+1), ring(1, j)})
+		for i := 1; i < stacks-1; i++ {
+			faces = append(faces, [3]int{ring(i, j), ring(i, j+1), ring(i+1, j)})
+			faces = append(faces, [3]int{ring(i, j+1), ring(i+1, j+1), ring(i+1, j)})
+		}
+		faces = append(faces, [3]int{bottom, ring(stacks-1, j), ring(stacks-1, j+1)})
+	}
+
+	m := Mesh{Material: newMaterial(0), Vertices: vertices, Faces: faces, BVH: &bvh}
+	if err := m.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMeshBVHMatchesLinearScan(t *testing.T) {
+	withBVH := newSphereMesh(t, 21, 40, true)
+	linear := newSphereMesh(t, 21, 40, false)
+
+	hits := 0
+	for i := -10; i <= 10; i++ {
+		for j := -10; j <= 10; j++ {
+			direction, _ := raytracing.Vector{X: 0.013 * float64(i), Y: 0.011 * float64(j), Z: 1}.Normalize()
+			r := raytracing.Ray{Position: raytracing.Vector{X: 0.3, Y: -0.2, Z: -5}, Direction: direction}
+
+			bvhOk, bvhHit := withBVH.Intersect(r, math.Inf(1))
+			linearOk, linearHit := linear.Intersect(r, math.Inf(1))
+			if bvhOk != linearOk || bvhHit.Distance != linearHit.Distance || bvhHit.Normal != linearHit.Normal {
+				t.Errorf("ray %v: BVH hit (%v, %v), linear scan hit (%v, %v)", direction, bvhOk, bvhHit.Distance, linearOk, linearHit.Distance)
+			}
+			if bvhOk {
+				hits++
+			}
+		}
+	}
+	if hits == 0 || hits == 21*21 {
+		t.Errorf("%d of %d rays hit the mesh, want some to hit and some to miss", hits, 21*21)
+	}
+}
+
+// BenchmarkMeshBVH intersects a packet of rays with a 10000 face mesh, with and without its BVH
+func BenchmarkMeshBVH(b *testing.B) {
+	for _, test := range []struct {
+		name string
+		bvh  bool
+	}{{"bvh", true}, {"linear", false}} {
+		b.Run(test.name, func(b *testing.B) {
+			m := newSphereMesh(b, 51, 100, test.bvh)
+			if faces := m.TriangleCount(); faces != 10000 {
+				b.Fatalf("mesh has %d faces, want 10000", faces)
+			}
+			rays := benchmarkPacket()
+			hits := make([]HitInfo, len(rays))
+
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				for i, r := range rays {
+					if ok, hit := m.Intersect(r, math.Inf(1)); ok {
+						hits[i] = hit
+					}
+				}
+			}
+		})
+	}
+}
@@ -3,35 +3,193 @@ package object
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
+	"strings"
 
 	"github.com/brendanburkhart/raytracer/pkg/raytracing"
 )
 
 // Object provides an interface for intersecting with 3D objects and their materials
 type Object interface {
-	Intersect(r raytracing.Ray, maxRange float64) (bool, float64)
-	SurfaceNormal(r raytracing.Ray) raytracing.Vector
+	Intersect(r raytracing.Ray, maxRange float64) (bool, HitInfo)
 	MaterialID() int
 }
 
+// PacketIntersector is implemented by objects which can intersect many rays at once more efficiently than
+// one at a time. Rays which intersect closer than the distance of their current hit have the hit replaced,
+// and whether each ray's hit was replaced is stored in intersected
+type PacketIntersector interface {
+	IntersectPacket(rays []raytracing.Ray, hits []HitInfo, intersected []bool)
+}
+
+// Bounded is implemented by finite objects which can report their axis aligned bounding box
+type Bounded interface {
+	Bounds() (min raytracing.Vector, max raytracing.Vector)
+}
+
+// MaterialModifier is implemented by objects whose material varies across their surface
+type MaterialModifier interface {
+	ModifyMaterial(material raytracing.Material, hit HitInfo) raytracing.Material
+}
+
+// TriangleCounter is implemented by objects made up of triangles
+type TriangleCounter interface {
+	TriangleCount() int
+}
+
+// NamedObject is implemented by objects which can be referenced by name
+type NamedObject interface {
+	ObjectName() string
+}
+
+// DegeneracyChecker is implemented by objects whose geometry can be degenerate, which usually indicates a typo
+type DegeneracyChecker interface {
+	// Degeneracy describes how the geometry of the object is degenerate, or is empty if it isn't
+	Degeneracy() string
+}
+
+// FileLoader is implemented by objects which load their geometry from a file, resolving a relative path
+// against the directory of the scene
+type FileLoader interface {
+	LoadFile(directory string) error
+}
+
+// InstanceResolver is implemented by objects which reference other objects by name
+type InstanceResolver interface {
+	ResolveInstance(objects map[string]Object) error
+}
+
+// MaterialResolver is implemented by objects which can reference their material by name
+type MaterialResolver interface {
+	ResolveMaterial(ids map[string]int) error
+	OffsetMaterial(offset int)
+}
+
+// MaterialReference refers to a material either by its index or by its name
+type MaterialReference struct {
+	ID   int
+	Name string
+}
+
+// UnmarshalJSON unmarshals a MaterialReference from either an index or a name
+func (mr *MaterialReference) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &mr.ID); err == nil {
+		mr.Name = ""
+		return nil
+	}
+
+	if err := json.Unmarshal(b, &mr.Name); err != nil {
+		return fmt.Errorf("material must be an index or a name")
+	}
+	return nil
+}
+
 // Material can be embedded in an object so it satisfies the MaterialID getter requirement of Object
 type Material struct {
-	Material int
+	Material MaterialReference
+}
+
+// newMaterial returns a Material referencing the material with the given id
+func newMaterial(id int) *Material {
+	return &Material{Material: MaterialReference{ID: id}}
 }
 
 // MaterialID returns the id of the material attached to the object
 func (om *Material) MaterialID() int {
-	return om.Material
+	return om.Material.ID
+}
+
+// ResolveMaterial looks up the id of a material referenced by name
+func (om *Material) ResolveMaterial(ids map[string]int) error {
+	if om.Material.Name == "" {
+		return nil
+	}
+
+	id, ok := ids[om.Material.Name]
+	if !ok {
+		return fmt.Errorf("material %q is not defined, materials must have a matching \"name\" to be referenced by name", om.Material.Name)
+	}
+	om.Material.ID = id
+	return nil
+}
+
+// OffsetMaterial shifts a material referenced by index, such as when the materials it indexes are
+// appended to those of another scene
+func (om *Material) OffsetMaterial(offset int) {
+	if om.Material.Name == "" {
+		om.Material.ID += offset
+	}
+}
+
+// Culling can be embedded in an object so hits on the back side of its surface can optionally be ignored
+type Culling struct {
+	CullBackfaces bool `json:"cullBackfaces"`
+}
+
+// culled returns whether a hit should be ignored because it is on the back side of the surface
+func (c Culling) culled(hit HitInfo) bool {
+	return c.CullBackfaces && hit.BackFace
+}
+
+// VisibilityFilter is implemented by objects which can be hidden from some kinds of rays
+type VisibilityFilter interface {
+	VisibleTo(kind raytracing.RayKind) bool
+}
+
+// Visibility can be embedded in an object so it can be hidden from the camera, shadow rays or reflections
+type Visibility struct {
+	VisibleToCamera      *bool `json:"visibleToCamera"`
+	CastsShadows         *bool `json:"castsShadows"`
+	VisibleInReflections *bool `json:"visibleInReflections"`
+}
+
+// VisibleTo returns whether rays of the given kind can hit the object, which defaults to true.
+// Untyped rays can always hit the object
+func (v Visibility) VisibleTo(kind raytracing.RayKind) bool {
+	var visible *bool
+	switch kind {
+	case raytracing.CameraRay:
+		visible = v.VisibleToCamera
+	case raytracing.ShadowRay:
+		visible = v.CastsShadows
+	case raytracing.ReflectedRay:
+		visible = v.VisibleInReflections
+	}
+	return visible == nil || *visible
+}
+
+// Named can be embedded in an object so other objects can reference it by name
+type Named struct {
+	Name string `json:"name"`
+}
+
+// ObjectName returns the name of the object, which is empty if it is unnamed
+func (n Named) ObjectName() string {
+	return n.Name
+}
+
+// Placement can be embedded in an object so it can be shifted from its intrinsic coordinates
+type Placement struct {
+	Offset raytracing.Vector `json:"offset"`
 }
 
 // shapeUnmarshaller unmarshals JSON data into a specific implementation of Object
 type objectFactory func(*json.RawMessage) (Object, error)
 
 var objectFactoryMap = map[string]objectFactory{
-	"plane":    planeFactory,
-	"sphere":   sphereFactory,
-	"box":      boxFactory,
-	"triangle": triangleFactory,
+	"plane":     planeFactory,
+	"sphere":    sphereFactory,
+	"box":       boxFactory,
+	"triangle":  triangleFactory,
+	"quad":      quadFactory,
+	"mesh":      meshFactory,
+	"heightmap": heightmapFactory,
+	"instance":  instanceFactory,
+}
+
+// TypeName returns the type name used in JSON scene data for the object
+func TypeName(obj Object) string {
+	return strings.ToLower(reflect.Indirect(reflect.ValueOf(obj)).Type().Name())
 }
 
 // JSONObjects is a named type to allow a slice of interfaces to have custom JSON unmarshalling
@@ -41,18 +199,18 @@ type JSONObjects []Object
 func (jsonObjects *JSONObjects) UnmarshalJSON(b []byte) error {
 	var rawObjects []*json.RawMessage
 	if err := json.Unmarshal(b, &rawObjects); err != nil {
-		return err
+		return raytracing.NestJSONError(b, err)
 	}
 
 	var typingData []map[string]*json.RawMessage
 	if err := json.Unmarshal(b, &typingData); err != nil {
-		return err
+		return raytracing.NestJSONError(b, err)
 	}
 
 	for i, typing := range typingData {
 		obj, err := unmarshalObject(typing, rawObjects[i])
 		if err != nil {
-			return err
+			return raytracing.NestJSONError(b, fmt.Errorf("object %d: %w", i, err))
 		}
 		*jsonObjects = append(*jsonObjects, obj)
 	}
@@ -88,7 +246,7 @@ func unmarshalObject(typing map[string]*json.RawMessage, data *json.RawMessage)
 	var obj Object
 	obj, err = factory(data)
 	if err != nil {
-		return nil, err
+		return nil, raytracing.NestJSONError(*data, err)
 	}
 
 	return obj, nil
@@ -0,0 +1,39 @@
+package object
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMaterialReferenceUnmarshal(t *testing.T) {
+	tests := []struct {
+		json string
+		want MaterialReference
+		ok   bool
+	}{
+		{`0`, MaterialReference{ID: 0}, true},
+		{`3`, MaterialReference{ID: 3}, true},
+		{`"glass"`, MaterialReference{Name: "glass"}, true},
+		{`"3"`, MaterialReference{Name: "3"}, true},
+		{`1.5`, MaterialReference{}, false},
+		{`true`, MaterialReference{}, false},
+		{`{"name": "glass"}`, MaterialReference{}, false},
+	}
+
+	for _, test := range tests {
+		var got MaterialReference
+		err := json.Unmarshal([]byte(test.json), &got)
+		if test.ok && (err != nil || got != test.want) {
+			t.Errorf("%s: got %+v, %v, want %+v", test.json, got, err, test.want)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: got %+v, want an error", test.json, got)
+		}
+	}
+
+	// An index replaces a name left from unmarshalling into the same reference
+	reference := MaterialReference{Name: "glass"}
+	if err := json.Unmarshal([]byte(`2`), &reference); err != nil || reference != (MaterialReference{ID: 2}) {
+		t.Errorf("index after name: got %+v, %v, want %+v", reference, err, MaterialReference{ID: 2})
+	}
+}
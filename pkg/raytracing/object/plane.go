@@ -2,6 +2,7 @@ package object
 
 import (
 	"encoding/json"
+	"fmt"
 	"math"
 
 	"github.com/brendanburkhart/raytracer/pkg/raytracing"
@@ -10,8 +11,34 @@ import (
 // Plane is an algebraic representation of a plane
 type Plane struct {
 	*Material
+	Culling
+	Visibility
+	Named
+	Placement
 	Normal raytracing.Vector `json:"normal"`
 	Point  raytracing.Vector `json:"point"`
+	Grid   *Grid             `json:"grid"`
+	// TwoSided shades both sides of the plane alike, by flipping the normal to face rays from behind,
+	// instead of leaving the back side unlit
+	TwoSided bool `json:"twoSided"`
+	// axisU and axisV are orthonormal axes within the plane
+	axisU raytracing.Vector
+	axisV raytracing.Vector
+}
+
+// Grid describes a pattern of lines drawn along the two in-plane axes of a Plane
+type Grid struct {
+	Spacing         float64          `json:"spacing"`
+	LineWidth       float64          `json:"lineWidth"`
+	LineColor       raytracing.Color `json:"lineColor"`
+	BackgroundColor raytracing.Color `json:"backgroundColor"`
+}
+
+// NewPlane creates a plane through point with the given normal, using the material with the given id
+func NewPlane(point raytracing.Vector, normal raytracing.Vector, material int) Plane {
+	p := Plane{Material: newMaterial(material), Point: point, Normal: normal}
+	p.Normalize()
+	return p
 }
 
 func planeFactory(data *json.RawMessage) (Object, error) {
@@ -19,17 +46,27 @@ func planeFactory(data *json.RawMessage) (Object, error) {
 	if err := json.Unmarshal(*data, &obj); err != nil {
 		return obj, err
 	}
+	obj.Point = obj.Point.Add(obj.Offset)
 	obj.Normalize()
+
+	if obj.Grid != nil {
+		if obj.Grid.Spacing <= 0.0 {
+			return obj, fmt.Errorf("plane grid spacing must be positive")
+		}
+		if obj.Grid.LineWidth == 0.0 {
+			obj.Grid.LineWidth = 0.05 * obj.Grid.Spacing
+		}
+	}
 	return obj, nil
 }
 
 // Intersect returns whether there is an intersection with r within maxRange,
-// and if so where it occurred. If there is no intersection, the scaling value will be maxRange
-func (p Plane) Intersect(r raytracing.Ray, maxRange float64) (bool, float64) {
+// and if so describes it. If there is no intersection, the hit distance will be maxRange
+func (p Plane) Intersect(r raytracing.Ray, maxRange float64) (bool, HitInfo) {
 	denominator := r.Direction.Dot(p.Normal)
 
-	if math.Abs(denominator) < 1e-8 {
-		return false, maxRange
+	if math.Abs(denominator) < raytracing.ParallelEpsilon || (p.CullBackfaces && denominator > 0.0) {
+		return false, miss(maxRange)
 	}
 
 	delta := p.Point.Subtract(r.Position)
@@ -37,20 +74,67 @@ func (p Plane) Intersect(r raytracing.Ray, maxRange float64) (bool, float64) {
 
 	t := numerator / denominator
 
-	if t > 1e-4 && t < maxRange {
-		return true, t
+	if t > r.MinDistance() && t < maxRange {
+		hit := surfaceHit(r, t)
+		hit.Normal = p.SurfaceNormal(raytracing.Ray{Position: hit.Position, Direction: r.Direction})
+		hit.BackFace = denominator > 0.0
+
+		// Surface coordinates are distances along the in-plane axes from the point
+		relative := hit.Position.Subtract(p.Point)
+		hit.U = relative.Dot(p.axisU)
+		hit.V = relative.Dot(p.axisV)
+		return true, hit
 	}
-	return false, maxRange
+	return false, miss(maxRange)
 }
 
-// SurfaceNormal returns the normal vector to the plane
+// SurfaceNormal returns the normal vector to the plane, which faces towards the ray if the plane is two-sided
 func (p Plane) SurfaceNormal(r raytracing.Ray) raytracing.Vector {
+	if p.TwoSided && r.Direction.Dot(p.Normal) > 0.0 {
+		return p.Normal.Negative()
+	}
 	return p.Normal
 }
 
+// Degeneracy describes whether the plane has a zero normal, so it has no orientation
+func (p Plane) Degeneracy() string {
+	if p.Normal == (raytracing.Vector{}) {
+		return "plane has a zero normal, so it has no orientation"
+	}
+	return ""
+}
+
 // Normalize performs an in-place normalization of certain vectors normalized
 // Position vectors, etc. are left un-normalized
 func (p *Plane) Normalize() {
 	normal, _ := p.Normal.Normalize()
 	p.Normal = normal
+
+	if normal.IsVertical() {
+		p.axisU = raytracing.Vector{X: 1, Y: 0, Z: 0}
+	} else {
+		p.axisU, _ = normal.Cross(raytracing.Vector{X: 0, Y: 1, Z: 0}).Normalize()
+	}
+	p.axisV = p.axisU.Cross(normal)
+}
+
+// ModifyMaterial replaces the diffuse color of the material with the grid pattern at the hit, if the plane has a grid
+func (p Plane) ModifyMaterial(material raytracing.Material, hit HitInfo) raytracing.Material {
+	if p.Grid == nil {
+		return material
+	}
+
+	relative := hit.Position.Subtract(p.Point)
+	if onGridLine(relative.Dot(p.axisU), p.Grid) || onGridLine(relative.Dot(p.axisV), p.Grid) {
+		material.Diffuse = p.Grid.LineColor
+	} else {
+		material.Diffuse = p.Grid.BackgroundColor
+	}
+	return material
+}
+
+// onGridLine returns whether the in-plane coordinate lies within half a line width of a grid line
+func onGridLine(coordinate float64, grid *Grid) bool {
+	offset := coordinate - grid.Spacing*math.Floor(coordinate/grid.Spacing)
+	return offset < 0.5*grid.LineWidth || grid.Spacing-offset < 0.5*grid.LineWidth
 }
@@ -0,0 +1,51 @@
+package object
+
+import (
+	"math"
+	"testing"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+func TestPlaneHitFromBothSides(t *testing.T) {
+	up := raytracing.Vector{X: 0, Y: 1, Z: 0}
+	down := up.Negative()
+	above := raytracing.Ray{Position: raytracing.Vector{X: 0.5, Y: 2, Z: 0}, Direction: down}
+	below := raytracing.Ray{Position: raytracing.Vector{X: 0.5, Y: -2, Z: 0}, Direction: up}
+
+	tests := []struct {
+		name     string
+		twoSided bool
+		ray      raytracing.Ray
+		normal   raytracing.Vector
+		backFace bool
+	}{
+		{"one-sided from above", false, above, up, false},
+		{"one-sided from below", false, below, up, true},
+		{"two-sided from above", true, above, up, false},
+		{"two-sided from below", true, below, down, true},
+	}
+
+	for _, test := range tests {
+		p := NewPlane(raytracing.Vector{X: 0, Y: 0, Z: 0}, up, 0)
+		p.TwoSided = test.twoSided
+
+		ok, hit := p.Intersect(test.ray, math.Inf(1))
+		if !ok {
+			t.Errorf("%s: missed", test.name)
+			continue
+		}
+		if math.Abs(hit.Distance-2.0) > 1e-9 {
+			t.Errorf("%s: hit at distance %v, want 2", test.name, hit.Distance)
+		}
+		if hit.Normal != test.normal {
+			t.Errorf("%s: hit normal is %v, want %v", test.name, hit.Normal, test.normal)
+		}
+		if hit.BackFace != test.backFace {
+			t.Errorf("%s: back face is %v, want %v", test.name, hit.BackFace, test.backFace)
+		}
+		if normal := p.SurfaceNormal(raytracing.Ray{Position: hit.Position, Direction: test.ray.Direction}); normal != test.normal {
+			t.Errorf("%s: surface normal is %v, want %v", test.name, normal, test.normal)
+		}
+	}
+}
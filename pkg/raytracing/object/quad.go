@@ -0,0 +1,105 @@
+package object
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+// Quad is a bounded parallelogram, defined by a corner and the two edges leaving it
+type Quad struct {
+	*Material
+	Culling
+	Visibility
+	Named
+	Placement
+	Corner raytracing.Vector `json:"corner"`
+	Edge1  raytracing.Vector `json:"edge1"`
+	Edge2  raytracing.Vector `json:"edge2"`
+	normal raytracing.Vector
+	// w projects in-plane points onto the edges
+	w raytracing.Vector
+}
+
+func quadFactory(data *json.RawMessage) (Object, error) {
+	obj := Quad{}
+	if err := json.Unmarshal(*data, &obj); err != nil {
+		return obj, err
+	}
+	obj.Corner = obj.Corner.Add(obj.Offset)
+
+	err := obj.Initialize()
+	return obj, err
+}
+
+// NewQuad creates the parallelogram spanned by two edges from a corner, using the material with the given id
+func NewQuad(corner raytracing.Vector, edge1 raytracing.Vector, edge2 raytracing.Vector, material int) (Quad, error) {
+	q := Quad{Material: newMaterial(material), Corner: corner, Edge1: edge1, Edge2: edge2}
+	err := q.Initialize()
+	return q, err
+}
+
+// Initialize performs precomputation from the edges
+func (q *Quad) Initialize() error {
+	n := q.Edge1.Cross(q.Edge2)
+	normal, ok := n.Normalize()
+	if !ok {
+		return fmt.Errorf("quad edges must be non-zero and not parallel")
+	}
+	q.normal = normal
+	q.w = n.Scale(1.0 / n.Dot(n))
+	return nil
+}
+
+// Intersect returns whether there is an intersection with r within maxRange,
+// and if so describes it. If there is no intersection, the hit distance will be maxRange
+func (q Quad) Intersect(r raytracing.Ray, maxRange float64) (bool, HitInfo) {
+	denominator := r.Direction.Dot(q.normal)
+
+	if math.Abs(denominator) < raytracing.ParallelEpsilon || (q.CullBackfaces && denominator > 0.0) {
+		return false, miss(maxRange)
+	}
+
+	delta := q.Corner.Subtract(r.Position)
+	t := delta.Dot(q.normal) / denominator
+
+	if t <= r.MinDistance() || t >= maxRange {
+		return false, miss(maxRange)
+	}
+
+	hit := surfaceHit(r, t)
+
+	// Coordinates of the hit along each edge, from 0.0 at the corner to 1.0 at the end of the edge
+	relative := hit.Position.Subtract(q.Corner)
+	hit.U = q.w.Dot(relative.Cross(q.Edge2))
+	hit.V = q.w.Dot(q.Edge1.Cross(relative))
+	if hit.U < 0.0 || hit.U > 1.0 || hit.V < 0.0 || hit.V > 1.0 {
+		return false, miss(maxRange)
+	}
+
+	hit.Normal = q.SurfaceNormal(r)
+	hit.BackFace = denominator > 0.0
+	return true, hit
+}
+
+// SurfaceNormal returns the normal vector to the quad, facing towards the ray
+func (q Quad) SurfaceNormal(r raytracing.Ray) raytracing.Vector {
+	if r.Direction.Dot(q.normal) < 0.0 {
+		return q.normal
+	}
+	return q.normal.Negative()
+}
+
+// Bounds returns the minimum and maximum corners of the axis aligned bounding box of the quad
+func (q Quad) Bounds() (raytracing.Vector, raytracing.Vector) {
+	corners := []raytracing.Vector{q.Corner.Add(q.Edge1), q.Corner.Add(q.Edge2), q.Corner.Add(q.Edge1).Add(q.Edge2)}
+
+	min, max := q.Corner, q.Corner
+	for _, corner := range corners {
+		min = raytracing.Vector{X: math.Min(min.X, corner.X), Y: math.Min(min.Y, corner.Y), Z: math.Min(min.Z, corner.Z)}
+		max = raytracing.Vector{X: math.Max(max.X, corner.X), Y: math.Max(max.Y, corner.Y), Z: math.Max(max.Z, corner.Z)}
+	}
+	return min, max
+}
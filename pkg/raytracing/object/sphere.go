@@ -2,6 +2,7 @@ package object
 
 import (
 	"encoding/json"
+	"fmt"
 	"math"
 
 	"github.com/brendanburkhart/raytracer/pkg/raytracing"
@@ -10,19 +11,74 @@ import (
 // Sphere is a 3 dimensional sphere
 type Sphere struct {
 	*Material
+	Culling
+	Visibility
+	Named
+	Placement
 	Radius float64           `json:"radius"`
 	Center raytracing.Vector `json:"center"`
+	// Pole is the direction of the north pole of the surface coordinates, where v is 1.0
+	Pole *raytracing.Vector `json:"pole"`
+	// Seam is the direction from the pole axis of the meridian where u wraps from 1.0 to 0.0
+	Seam *raytracing.Vector `json:"seam"`
+	// The surface coordinates are spherical coordinates in this frame, with poles along the y axis
+	// and u of 0.5 along the x axis
+	xAxis, yAxis, zAxis raytracing.Vector
+}
+
+// NewSphere creates a sphere using the material with the given id
+func NewSphere(center raytracing.Vector, radius float64, material int) Sphere {
+	s := Sphere{Material: newMaterial(material), Center: center, Radius: radius}
+	// This can't fail with the default pole and seam
+	s.Initialize()
+	return s
+}
+
+// Initialize computes the frame of the surface coordinates from the pole and seam, which default to
+// the y axis and the negative x axis, or the negative z axis for poles along the x axis
+func (s *Sphere) Initialize() error {
+	pole := raytracing.Vector{X: 0.0, Y: 1.0, Z: 0.0}
+	if s.Pole != nil {
+		var ok bool
+		if pole, ok = s.Pole.Normalize(); !ok {
+			return fmt.Errorf("sphere pole must be non-zero")
+		}
+	}
+
+	seam := raytracing.Vector{X: -1.0, Y: 0.0, Z: 0.0}
+	if s.Seam != nil {
+		seam = *s.Seam
+	} else if math.Abs(pole.X) > 0.99 {
+		// The default seam is too close to poles along the x axis to define a meridian
+		seam = raytracing.Vector{X: 0.0, Y: 0.0, Z: -1.0}
+	}
+
+	// Only the part of the seam perpendicular to the pole determines the meridian
+	xAxis, ok := seam.ProjectOnto(pole).Subtract(seam).Normalize()
+	if !ok {
+		return fmt.Errorf("sphere seam must be non-zero and not parallel to the pole")
+	}
+	s.xAxis, s.yAxis, s.zAxis = xAxis, pole, xAxis.Cross(pole)
+	return nil
 }
 
 func sphereFactory(data *json.RawMessage) (Object, error) {
 	obj := Sphere{}
-	err := json.Unmarshal(*data, &obj)
+	if err := json.Unmarshal(*data, &obj); err != nil {
+		return obj, err
+	}
+	obj.Center = obj.Center.Add(obj.Offset)
+
+	if obj.Radius <= 0.0 {
+		return obj, fmt.Errorf("sphere radius must be positive, is %g", obj.Radius)
+	}
+	err := obj.Initialize()
 	return obj, err
 }
 
 // Intersect returns whether there is an intersection with r within maxRange,
-// and if so where it occurred. If there is no intersection, the scaling value will be maxRange
-func (s Sphere) Intersect(r raytracing.Ray, maxRange float64) (bool, float64) {
+// and if so describes it. If there is no intersection, the hit distance will be maxRange
+func (s Sphere) Intersect(r raytracing.Ray, maxRange float64) (bool, HitInfo) {
 	A := r.Direction.Dot(r.Direction)
 
 	dist := r.Position.Subtract(s.Center)
@@ -33,19 +89,81 @@ func (s Sphere) Intersect(r raytracing.Ray, maxRange float64) (bool, float64) {
 	discriminant := B*B - 4*A*C
 
 	if discriminant < 0.0 {
-		return false, maxRange
+		return false, miss(maxRange)
 	}
 
 	sqrtdiscr := math.Sqrt(discriminant)
-	t0 := (-B + sqrtdiscr) / (2 * A)
-	t1 := (-B - sqrtdiscr) / (2 * A)
+	t := nearestRoot((-B+sqrtdiscr)/(2*A), (-B-sqrtdiscr)/(2*A), r.MinDistance())
+
+	if t > r.MinDistance() && t < maxRange {
+		return s.surfaceHit(r, t, maxRange)
+	}
+	return false, miss(maxRange)
+}
+
+// IntersectPacket intersects a packet of rays with the sphere. Rays which intersect closer than the
+// distance of their current hit have the hit replaced, and whether each ray's hit was replaced is
+// stored in intersected. Quantities depending only on the sphere are computed once for the packet
+func (s Sphere) IntersectPacket(rays []raytracing.Ray, hits []HitInfo, intersected []bool) {
+	radiusSquared := s.Radius * s.Radius
+	for i, r := range rays {
+		intersected[i] = false
+
+		A := r.Direction.Dot(r.Direction)
+		dist := r.Position.Subtract(s.Center)
+		B := 2 * r.Direction.Dot(dist)
+		C := dist.Dot(dist) - radiusSquared
+
+		discriminant := B*B - 4*A*C
+		if discriminant < 0.0 {
+			continue
+		}
+
+		sqrtdiscr := math.Sqrt(discriminant)
+		t := nearestRoot((-B+sqrtdiscr)/(2*A), (-B-sqrtdiscr)/(2*A), r.MinDistance())
+		if t > r.MinDistance() && t < hits[i].Distance {
+			if ok, hit := s.surfaceHit(r, t, hits[i].Distance); ok {
+				intersected[i], hits[i] = true, hit
+			}
+		}
+	}
+}
 
+// nearestRoot returns the smallest of the roots t0 and t1 along a ray which is greater than minDistance,
+// or a root which isn't if there is none. When the ray starts inside the sphere, such as when refracted
+// into it, the nearer root is behind it and the far side of the sphere is hit
+func nearestRoot(t0 float64, t1 float64, minDistance float64) float64 {
 	t := math.Min(t0, t1)
+	if t <= minDistance {
+		t = math.Max(t0, t1)
+	}
+	return t
+}
+
+// surfaceHit describes the hit at distance t along r, unless it is culled
+func (s Sphere) surfaceHit(r raytracing.Ray, t float64, maxRange float64) (bool, HitInfo) {
+	hit := surfaceHit(r, t)
+	hit.Normal = s.SurfaceNormal(raytracing.Ray{Position: hit.Position, Direction: r.Direction})
+	hit.BackFace = r.Direction.Dot(hit.Normal) > 0.0
+	if s.culled(hit) {
+		return false, miss(maxRange)
+	}
 
-	if t > 1e-4 && t < maxRange {
-		return true, t
+	// Spherical coordinates in the frame of the pole and seam
+	hit.U = 0.5 + math.Atan2(hit.Normal.Dot(s.zAxis), hit.Normal.Dot(s.xAxis))/(2.0*math.Pi)
+	hit.V = 0.5 + math.Asin(math.Max(-1.0, math.Min(hit.Normal.Dot(s.yAxis), 1.0)))/math.Pi
+	return true, hit
+}
+
+// Degeneracy describes whether the sphere has a radius which is zero, so it is never hit, or negative
+func (s Sphere) Degeneracy() string {
+	if s.Radius == 0.0 {
+		return "sphere has zero radius, so it is never hit"
+	}
+	if s.Radius < 0.0 {
+		return fmt.Sprintf("sphere has a negative radius of %g", s.Radius)
 	}
-	return false, maxRange
+	return ""
 }
 
 // SurfaceNormal returns the normal vector to the sphere at the point specified
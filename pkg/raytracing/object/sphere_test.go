@@ -0,0 +1,120 @@
+package object
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+func TestSphereIntersectFromInside(t *testing.T) {
+	s := NewSphere(raytracing.Vector{X: 0, Y: 0, Z: 0}, 2, 0)
+
+	tests := []struct {
+		name     string
+		ray      raytracing.Ray
+		distance float64
+		backFace bool
+	}{
+		{
+			"from outside",
+			raytracing.Ray{Position: raytracing.Vector{X: 0, Y: 0, Z: -5}, Direction: raytracing.Vector{X: 0, Y: 0, Z: 1}},
+			3, false,
+		},
+		{
+			"from the center",
+			raytracing.Ray{Position: raytracing.Vector{X: 0, Y: 0, Z: 0}, Direction: raytracing.Vector{X: 0, Y: 0, Z: 1}},
+			2, true,
+		},
+		{
+			"from inside off center",
+			raytracing.Ray{Position: raytracing.Vector{X: 0, Y: 0, Z: 1}, Direction: raytracing.Vector{X: 0, Y: 0, Z: -1}},
+			3, true,
+		},
+		{
+			"from the surface inwards",
+			raytracing.Ray{Position: raytracing.Vector{X: 0, Y: 0, Z: -2}, Direction: raytracing.Vector{X: 0, Y: 0, Z: 1}},
+			4, true,
+		},
+	}
+
+	for _, test := range tests {
+		ok, hit := s.Intersect(test.ray, math.Inf(1))
+		if !ok {
+			t.Errorf("%s: missed", test.name)
+			continue
+		}
+		if math.Abs(hit.Distance-test.distance) > 1e-9 {
+			t.Errorf("%s: hit at distance %v, want %v", test.name, hit.Distance, test.distance)
+		}
+		if hit.BackFace != test.backFace {
+			t.Errorf("%s: back face is %v, want %v", test.name, hit.BackFace, test.backFace)
+		}
+
+		hits, intersected := []HitInfo{miss(math.Inf(1))}, []bool{false}
+		s.IntersectPacket([]raytracing.Ray{test.ray}, hits, intersected)
+		if !intersected[0] || hits[0] != hit {
+			t.Errorf("%s: packet intersection %v differs from %v", test.name, hits[0], hit)
+		}
+	}
+}
+
+// benchmarkPacket returns a packet of coherent rays like those of one pixel with an anti-aliasing factor
+// of 4, three quarters of which hit a sphere of radius 1 at the origin near its edge
+func benchmarkPacket() []raytracing.Ray {
+	rays := make([]raytracing.Ray, 0, 16)
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			direction, _ := raytracing.Vector{X: 0.05*float64(i) - 0.1, Y: 0.05*float64(j) - 0.1, Z: 1}.Normalize()
+			rays = append(rays, raytracing.Ray{Position: raytracing.Vector{X: 0.8, Y: 0.1, Z: -5}, Direction: direction})
+		}
+	}
+	return rays
+}
+
+func BenchmarkSphereIntersect(b *testing.B) {
+	s := NewSphere(raytracing.Vector{X: 0, Y: 0, Z: 0}, 1, 0)
+	rays := benchmarkPacket()
+	hits := make([]HitInfo, len(rays))
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i, r := range rays {
+			if ok, hit := s.Intersect(r, math.Inf(1)); ok {
+				hits[i] = hit
+			}
+		}
+	}
+}
+
+func BenchmarkSphereIntersectPacket(b *testing.B) {
+	s := NewSphere(raytracing.Vector{X: 0, Y: 0, Z: 0}, 1, 0)
+	rays := benchmarkPacket()
+	hits := make([]HitInfo, len(rays))
+	intersected := make([]bool, len(rays))
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i := range hits {
+			hits[i] = miss(math.Inf(1))
+		}
+		s.IntersectPacket(rays, hits, intersected)
+	}
+}
+
+func TestNonPositiveSphereRadiusRejected(t *testing.T) {
+	for _, radius := range []string{"0", "-1.5"} {
+		var objects JSONObjects
+		err := json.Unmarshal([]byte(`[{"type": "sphere", "center": {"x": 0, "y": 0, "z": 0}, "radius": `+radius+`, "material": 0}]`), &objects)
+		if err == nil || !strings.Contains(err.Error(), "radius must be positive") {
+			t.Errorf("radius %s: unmarshalling returned %v, want a radius error", radius, err)
+		}
+	}
+
+	var objects JSONObjects
+	if err := json.Unmarshal([]byte(`[{"type": "sphere", "center": {"x": 0, "y": 0, "z": 0}, "radius": 0.5, "material": 0}]`), &objects); err != nil {
+		t.Errorf("valid sphere returned %v", err)
+	}
+}
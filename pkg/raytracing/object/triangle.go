@@ -2,6 +2,8 @@ package object
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
 
 	"github.com/brendanburkhart/raytracer/pkg/raytracing"
 )
@@ -9,12 +11,32 @@ import (
 // Triangle is a triangle in 3 dimensions
 type Triangle struct {
 	*Material
+	Culling
+	Visibility
+	Named
+	Placement
 	normal raytracing.Vector
 	edge1  raytracing.Vector
 	edge2  raytracing.Vector
-	A      raytracing.Vector `json:"A"`
-	B      raytracing.Vector `json:"B"`
-	C      raytracing.Vector `json:"C"`
+	// parallel is the determinant below which rays are parallel to the triangle, which scales with its edges
+	parallel float64
+	A        raytracing.Vector `json:"A"`
+	B        raytracing.Vector `json:"B"`
+	C        raytracing.Vector `json:"C"`
+	// Normals optionally holds vertex normals for A, B and C, interpolated for smooth shading
+	Normals []raytracing.Vector `json:"normals"`
+	// Watertight selects a slower intersection test which never lets rays pass between triangles sharing an edge
+	Watertight bool `json:"watertight"`
+}
+
+// NewTriangle creates a triangle with vertices A, B and C, using the material with the given id
+func NewTriangle(a raytracing.Vector, b raytracing.Vector, c raytracing.Vector, material int) (Triangle, error) {
+	tr := Triangle{Material: newMaterial(material), A: a, B: b, C: c}
+	if err := tr.Initialize(); err != nil {
+		return tr, err
+	}
+	err := tr.validateArea()
+	return tr, err
 }
 
 func triangleFactory(data *json.RawMessage) (Object, error) {
@@ -22,22 +44,61 @@ func triangleFactory(data *json.RawMessage) (Object, error) {
 	if err := json.Unmarshal(*data, &obj); err != nil {
 		return obj, err
 	}
-	obj.edge1 = obj.B.Subtract(obj.A)
-	obj.edge2 = obj.C.Subtract(obj.A)
+	obj.A = obj.A.Add(obj.Offset)
+	obj.B = obj.B.Add(obj.Offset)
+	obj.C = obj.C.Add(obj.Offset)
+
+	if err := obj.Initialize(); err != nil {
+		return obj, err
+	}
+	err := obj.validateArea()
+	return obj, err
+}
+
+// validateArea rejects triangles with zero area, whose normal is undefined. Meshes only warn about such faces,
+// which are common in imported models and harmless among the other faces
+func (tr *Triangle) validateArea() error {
+	if degeneracy := tr.Degeneracy(); degeneracy != "" {
+		return fmt.Errorf("%s: A %v, B %v, C %v", degeneracy, tr.A, tr.B, tr.C)
+	}
+	return nil
+}
+
+// Initialize performs precomputation from the vertices and validates the vertex normals
+func (tr *Triangle) Initialize() error {
+	tr.edge1 = tr.B.Subtract(tr.A)
+	tr.edge2 = tr.C.Subtract(tr.A)
+
+	tr.normal = tr.edge1.Cross(tr.edge2)
+	tr.Normalize()
+	tr.parallel = raytracing.ParallelEpsilon * tr.edge1.Magnitude() * tr.edge2.Magnitude()
+
+	if len(tr.Normals) != 0 && len(tr.Normals) != 3 {
+		return fmt.Errorf("triangle must have either no vertex normals or exactly three, has %d", len(tr.Normals))
+	}
+	for i, normal := range tr.Normals {
+		var ok bool
+		if tr.Normals[i], ok = normal.Normalize(); !ok {
+			return fmt.Errorf("triangle vertex normal %d is a zero vector", i)
+		}
+	}
 
-	obj.normal = obj.edge1.Cross(obj.edge2)
-	obj.Normalize()
-	return obj, nil
+	return nil
 }
 
 // Intersect returns whether there is an intersection with r within maxRange,
-// and if so where it occurred. If there is no intersection, the scaling value will be maxRange
-func (tr Triangle) Intersect(r raytracing.Ray, maxRange float64) (bool, float64) {
+// and if so describes it. If there is no intersection, the hit distance will be maxRange
+func (tr Triangle) Intersect(r raytracing.Ray, maxRange float64) (bool, HitInfo) {
+	if tr.Watertight {
+		return tr.intersectWatertight(r, maxRange)
+	}
+
 	h := r.Direction.Cross(tr.edge2)
 
+	// Determinant is negative when the ray direction agrees with the geometric normal
 	det := tr.edge1.Dot(h)
-	if det < 1e-8 && det > -1e-8 {
-		return false, maxRange
+	if det < tr.parallel && (det > -tr.parallel || tr.CullBackfaces) {
+		return false, miss(maxRange)
 	}
 
 	f := 1.0 / det
@@ -46,29 +107,122 @@ func (tr Triangle) Intersect(r raytracing.Ray, maxRange float64) (bool, float64)
 
 	u := transform.Dot(h) * f
 	if u < 0.0 || u > 1.0 {
-		return false, maxRange
+		return false, miss(maxRange)
 	}
 
 	q := transform.Cross(tr.edge1)
 
 	v := r.Direction.Dot(q) * f
 	if v < 0.0 || (u+v) > 1.0 {
-		return false, maxRange
+		return false, miss(maxRange)
 	}
 
 	t := tr.edge2.Dot(q) * f
-	if t > 1e-4 && t < maxRange {
-		return true, t
+	return tr.hitAt(r, t, u, v, maxRange)
+}
+
+// intersectWatertight intersects r with the triangle using the watertight algorithm of Woop, Benthin
+// and Wald. The vertices are transformed so the ray runs along the z axis from the origin, and the
+// hit is found with 2D edge functions evaluated identically for both triangles sharing an edge, so a
+// ray through a shared edge hits at least one of them rather than slipping between
+func (tr Triangle) intersectWatertight(r raytracing.Ray, maxRange float64) (bool, HitInfo) {
+	if tr.CullBackfaces && r.Direction.Dot(tr.normal) > 0.0 {
+		return false, miss(maxRange)
+	}
+
+	// The ray's largest direction component becomes z, with x and y swapped to preserve the winding
+	direction := [3]float64{r.Direction.X, r.Direction.Y, r.Direction.Z}
+	kz := 0
+	for k := 1; k < 3; k++ {
+		if math.Abs(direction[k]) > math.Abs(direction[kz]) {
+			kz = k
+		}
+	}
+	kx, ky := (kz+1)%3, (kz+2)%3
+	if direction[kz] < 0.0 {
+		kx, ky = ky, kx
+	}
+
+	// Shearing aligns the ray direction with the z axis
+	sx, sy, sz := direction[kx]/direction[kz], direction[ky]/direction[kz], 1.0/direction[kz]
+	vertex := func(v raytracing.Vector) (float64, float64, float64) {
+		relative := v.Subtract(r.Position)
+		components := [3]float64{relative.X, relative.Y, relative.Z}
+		z := components[kz]
+		return components[kx] - sx*z, components[ky] - sy*z, sz * z
 	}
-	return false, maxRange
+	ax, ay, az := vertex(tr.A)
+	bx, by, bz := vertex(tr.B)
+	cx, cy, cz := vertex(tr.C)
+
+	// Each edge function is the weight of the opposite vertex, scaled by the determinant
+	weightA := cx*by - cy*bx
+	weightB := ax*cy - ay*cx
+	weightC := bx*ay - by*ax
+	if (weightA < 0.0 || weightB < 0.0 || weightC < 0.0) && (weightA > 0.0 || weightB > 0.0 || weightC > 0.0) {
+		return false, miss(maxRange)
+	}
+
+	det := weightA + weightB + weightC
+	if det == 0.0 {
+		return false, miss(maxRange)
+	}
+
+	t := (weightA*az + weightB*bz + weightC*cz) / det
+	return tr.hitAt(r, t, weightB/det, weightC/det, maxRange)
+}
+
+// hitAt describes the hit at distance t along r and barycentric coordinates (u, v), if it is within range
+func (tr Triangle) hitAt(r raytracing.Ray, t float64, u float64, v float64, maxRange float64) (bool, HitInfo) {
+	if t > r.MinDistance() && t < maxRange {
+		hit := surfaceHit(r, t)
+		hit.U, hit.V = u, v
+		hit.Normal = tr.interpolatedNormal(u, v, r.Direction)
+		hit.BackFace = r.Direction.Dot(tr.normal) > 0.0
+		return true, hit
+	}
+	return false, miss(maxRange)
 }
 
-// SurfaceNormal returns the normal vector to the triangle
+// SurfaceNormal returns the normal vector to the triangle at the point specified by the position
+// of the ray, facing towards the ray. If the triangle has vertex normals they are interpolated,
+// otherwise the geometric normal is used
 func (tr Triangle) SurfaceNormal(r raytracing.Ray) raytracing.Vector {
-	if r.Direction.Dot(tr.normal) < 0.0 {
-		return tr.normal
+	u, v := tr.barycentric(r.Position)
+	return tr.interpolatedNormal(u, v, r.Direction)
+}
+
+// interpolatedNormal returns the normal at barycentric coordinates (u, v) facing against direction
+func (tr Triangle) interpolatedNormal(u float64, v float64, direction raytracing.Vector) raytracing.Vector {
+	normal := tr.normal
+	if len(tr.Normals) == 3 {
+		interpolated := tr.Normals[0].Scale(1.0 - u - v).Add(tr.Normals[1].Scale(u)).Add(tr.Normals[2].Scale(v))
+		if interpolated, ok := interpolated.Normalize(); ok {
+			normal = interpolated
+		}
+	}
+
+	if direction.Dot(tr.normal) < 0.0 {
+		return normal
 	}
-	return tr.normal.Negative()
+	return normal.Negative()
+}
+
+// barycentric returns the barycentric coordinates (u, v) of a point in the plane of the triangle,
+// where u is the weight of B and v is the weight of C
+func (tr Triangle) barycentric(point raytracing.Vector) (float64, float64) {
+	relative := point.Subtract(tr.A)
+
+	d00 := tr.edge1.Dot(tr.edge1)
+	d01 := tr.edge1.Dot(tr.edge2)
+	d11 := tr.edge2.Dot(tr.edge2)
+	d20 := relative.Dot(tr.edge1)
+	d21 := relative.Dot(tr.edge2)
+
+	denominator := d00*d11 - d01*d01
+	u := (d11*d20 - d01*d21) / denominator
+	v := (d00*d21 - d01*d20) / denominator
+	return u, v
 }
 
 // Normalize performs an in-place normalization of certain vectors normalized
@@ -77,3 +231,23 @@ func (tr *Triangle) Normalize() {
 	normal, _ := tr.normal.Normalize()
 	tr.normal = normal
 }
+
+// Degeneracy describes whether the triangle has zero area, because its vertices are in a line
+func (tr Triangle) Degeneracy() string {
+	if tr.edge1.Cross(tr.edge2).Magnitude() <= 1e-12 {
+		return "triangle has zero area, its vertices are in a line"
+	}
+	return ""
+}
+
+// TriangleCount returns the number of triangles making up the object
+func (tr Triangle) TriangleCount() int {
+	return 1
+}
+
+// Bounds returns the minimum and maximum corners of the axis aligned bounding box of the triangle
+func (tr Triangle) Bounds() (raytracing.Vector, raytracing.Vector) {
+	min := raytracing.Vector{X: math.Min(tr.A.X, math.Min(tr.B.X, tr.C.X)), Y: math.Min(tr.A.Y, math.Min(tr.B.Y, tr.C.Y)), Z: math.Min(tr.A.Z, math.Min(tr.B.Z, tr.C.Z))}
+	max := raytracing.Vector{X: math.Max(tr.A.X, math.Max(tr.B.X, tr.C.X)), Y: math.Max(tr.A.Y, math.Max(tr.B.Y, tr.C.Y)), Z: math.Max(tr.A.Z, math.Max(tr.B.Z, tr.C.Z))}
+	return min, max
+}
@@ -0,0 +1,112 @@
+package object
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+)
+
+func newTestTriangle(t *testing.T, a, b, c raytracing.Vector, watertight bool) Triangle {
+	t.Helper()
+	tr, err := NewTriangle(a, b, c, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.Watertight = watertight
+	return tr
+}
+
+func TestTriangleBarycentrics(t *testing.T) {
+	a, b, c := raytracing.Vector{X: 0, Y: 0, Z: 0}, raytracing.Vector{X: 2, Y: 0, Z: 0}, raytracing.Vector{X: 0, Y: 2, Z: 0}
+	centroid := a.Add(b).Add(c).Scale(1.0 / 3.0)
+
+	tests := []struct {
+		name  string
+		point raytracing.Vector
+		u, v  float64
+	}{
+		{"A", a, 0, 0},
+		{"B", b, 1, 0},
+		{"C", c, 0, 1},
+		{"centroid", centroid, 1.0 / 3.0, 1.0 / 3.0},
+	}
+
+	for _, watertight := range []bool{false, true} {
+		tr := newTestTriangle(t, a, b, c, watertight)
+		for _, test := range tests {
+			u, v := tr.barycentric(test.point)
+			if math.Abs(u-test.u) > 1e-9 || math.Abs(v-test.v) > 1e-9 {
+				t.Errorf("barycentric(%s) = (%v, %v), want (%v, %v)", test.name, u, v, test.u, test.v)
+			}
+
+			r := raytracing.Ray{Position: test.point.Add(raytracing.Vector{X: 0, Y: 0, Z: 1}), Direction: raytracing.Vector{X: 0, Y: 0, Z: -1}}
+			ok, hit := tr.Intersect(r, math.Inf(1))
+			if !ok {
+				t.Errorf("watertight %v: ray at %s missed", watertight, test.name)
+				continue
+			}
+			if math.Abs(hit.U-test.u) > 1e-9 || math.Abs(hit.V-test.v) > 1e-9 {
+				t.Errorf("watertight %v: hit at %s has barycentrics (%v, %v), want (%v, %v)", watertight, test.name, hit.U, hit.V, test.u, test.v)
+			}
+			if math.Abs(hit.Distance-1.0) > 1e-9 {
+				t.Errorf("watertight %v: hit at %s has distance %v, want 1", watertight, test.name, hit.Distance)
+			}
+		}
+	}
+}
+
+func TestWatertightSharedEdge(t *testing.T) {
+	// Two triangles tilted out of the axis planes share the edge from a to c, so the coordinates of
+	// points along it are rounded, and rays aimed at the edge may round to either side of it
+	a := raytracing.Vector{X: 0.1, Y: 0.3, Z: 0.7}
+	b := raytracing.Vector{X: 1.3, Y: 0.2, Z: 0.9}
+	c := raytracing.Vector{X: 0.9, Y: 1.7, Z: 0.3}
+	d := raytracing.Vector{X: -0.4, Y: 1.1, Z: 0.2}
+	first := newTestTriangle(t, a, b, c, true)
+	second := newTestTriangle(t, a, c, d, true)
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		edge := a.Add(c.Subtract(a).Scale(rng.Float64()))
+		origin := raytracing.Vector{X: rng.Float64()*4 - 2, Y: rng.Float64()*4 - 2, Z: 3 + rng.Float64()}
+		direction, _ := edge.Subtract(origin).Normalize()
+		r := raytracing.Ray{Position: origin, Direction: direction}
+
+		hitFirst, firstHit := first.Intersect(r, math.Inf(1))
+		hitSecond, secondHit := second.Intersect(r, math.Inf(1))
+		if !hitFirst && !hitSecond {
+			t.Fatalf("ray from %v through shared edge at %v missed both triangles", origin, edge)
+		}
+		if hitFirst && hitSecond && math.Abs(firstHit.Distance-secondHit.Distance) > 1e-9 {
+			t.Fatalf("ray from %v hit the triangles at different distances %v and %v", origin, firstHit.Distance, secondHit.Distance)
+		}
+	}
+}
+
+func TestZeroAreaTrianglesRejected(t *testing.T) {
+	a, b := raytracing.Vector{X: 0, Y: 0, Z: 0}, raytracing.Vector{X: 1, Y: 1, Z: 1}
+	degenerate := map[string][3]raytracing.Vector{
+		"collinear":           {a, b, b.Scale(3.0)},
+		"repeated vertex":     {a, b, b},
+		"all vertices at one": {b, b, b},
+	}
+	for name, vertices := range degenerate {
+		if _, err := NewTriangle(vertices[0], vertices[1], vertices[2], 0); err == nil || !strings.Contains(err.Error(), "zero area") {
+			t.Errorf("%s: NewTriangle returned %v, want a zero area error", name, err)
+		}
+	}
+
+	var objects JSONObjects
+	err := json.Unmarshal([]byte(`[{"type": "triangle", "A": {"x": 0, "y": 0, "z": 0}, "B": {"x": 1, "y": 0, "z": 0}, "C": {"x": 2, "y": 0, "z": 0}, "material": 0}]`), &objects)
+	if err == nil || !strings.Contains(err.Error(), "zero area") {
+		t.Errorf("unmarshalling a collinear triangle returned %v, want a zero area error", err)
+	}
+
+	if _, err := NewTriangle(a, b, raytracing.Vector{X: 1, Y: 0, Z: 0}, 0); err != nil {
+		t.Errorf("valid triangle returned %v", err)
+	}
+}
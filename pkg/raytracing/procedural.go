@@ -0,0 +1,85 @@
+package raytracing
+
+import (
+	"fmt"
+	"math"
+)
+
+// Patterns for procedural materials
+const (
+	ProceduralMarble     = "marble"
+	ProceduralWood       = "wood"
+	ProceduralTurbulence = "turbulence"
+)
+
+// Procedural replaces the diffuse color of a material with a pattern of noise evaluated at the hit
+// position, so solid materials such as marble and wood look continuous across every surface
+type Procedural struct {
+	Pattern string `json:"pattern"`
+	// Frequency is the number of noise features per unit distance
+	Frequency *float64 `json:"frequency"`
+	// Octaves is the number of scales of noise summed into the turbulence
+	Octaves *int `json:"octaves"`
+	// Colors is the ramp the pattern value from 0.0 to 1.0 is mapped through, with evenly spaced stops
+	Colors []Color `json:"colors"`
+	Seed   int64   `json:"seed"`
+}
+
+// Validate checks the procedural parameters and sets defaults
+func (p *Procedural) Validate() error {
+	if p.Pattern == "" {
+		p.Pattern = ProceduralMarble
+	}
+	if p.Pattern != ProceduralMarble && p.Pattern != ProceduralWood && p.Pattern != ProceduralTurbulence {
+		return fmt.Errorf("unknown procedural pattern %q", p.Pattern)
+	}
+	if p.Frequency == nil {
+		frequency := 1.0
+		p.Frequency = &frequency
+	}
+	if *p.Frequency <= 0.0 {
+		return fmt.Errorf("procedural frequency must be positive")
+	}
+	if p.Octaves == nil {
+		octaves := 4
+		p.Octaves = &octaves
+	}
+	if *p.Octaves < 1 {
+		return fmt.Errorf("procedural octaves must be at least 1")
+	}
+	if len(p.Colors) == 0 {
+		p.Colors = []Color{{}, {Red: 1.0, Green: 1.0, Blue: 1.0}}
+	}
+	if len(p.Colors) < 2 {
+		return fmt.Errorf("procedural color ramp must have at least 2 colors")
+	}
+	return nil
+}
+
+// ColorAt returns the color of the pattern at a position
+func (p *Procedural) ColorAt(position Vector) Color {
+	position = position.Scale(*p.Frequency)
+	turbulence := Turbulence(position, *p.Octaves, p.Seed)
+
+	var t float64
+	switch p.Pattern {
+	case ProceduralMarble:
+		// Veins are bands along x, distorted by the turbulence
+		t = 0.5 + 0.5*math.Sin(math.Pi*(position.X+4.0*turbulence))
+	case ProceduralWood:
+		// Rings are centered on the y axis, made irregular by the turbulence
+		rings := math.Hypot(position.X, position.Z) + 0.5*turbulence
+		t = rings - math.Floor(rings)
+	default:
+		t = math.Min(2.0*turbulence, 1.0)
+	}
+	return p.ramp(t)
+}
+
+// ramp linearly interpolates the color ramp at t between 0.0 and 1.0
+func (p *Procedural) ramp(t float64) Color {
+	scaled := math.Max(0.0, math.Min(t, 1.0)) * float64(len(p.Colors)-1)
+	i := int(math.Min(math.Floor(scaled), float64(len(p.Colors)-2)))
+	f := scaled - float64(i)
+	return p.Colors[i].Blend(p.Colors[i+1], f)
+}
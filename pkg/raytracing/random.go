@@ -0,0 +1,96 @@
+package raytracing
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Random returns a pseudo-random number in [0, 1) determined by the seed, the ray and the sample index.
+// Deriving randomness from the ray keeps renders reproducible regardless of goroutine scheduling
+func (r Ray) Random(seed int64, sample int) float64 {
+	hash := mix(mix(uint64(seed)) ^ uint64(sample))
+	for _, component := range []float64{r.Position.X, r.Position.Y, r.Position.Z, r.Direction.X, r.Direction.Y, r.Direction.Z} {
+		hash = mix(hash ^ math.Float64bits(component))
+	}
+
+	return float64(hash>>11) / float64(1<<53)
+}
+
+// RandomInUnitSphere returns a pseudo-random vector uniformly distributed within the unit sphere,
+// determined by the seed, the ray and the sample index
+func (r Ray) RandomInUnitSphere(seed int64, sample int) Vector {
+	z := 2.0*r.Random(seed, 3*sample) - 1.0
+	phi := 2.0 * math.Pi * r.Random(seed, 3*sample+1)
+	radius := math.Cbrt(r.Random(seed, 3*sample+2))
+
+	planar := math.Sqrt(1.0 - z*z)
+	return Vector{
+		X: radius * planar * math.Cos(phi),
+		Y: radius * planar * math.Sin(phi),
+		Z: radius * z,
+	}
+}
+
+// RandomCosineDirection returns a pseudo-random unit vector in the hemisphere around the unit vector normal,
+// distributed in proportion to the cosine of its angle to the normal, determined by the seed, the ray and the sample index
+func (r Ray) RandomCosineDirection(seed int64, sample int, normal Vector) Vector {
+	return cosineHemisphere(normal, r.Random(seed, 2*sample), r.Random(seed, 2*sample+1))
+}
+
+// RandomConeDirection returns a pseudo-random unit vector uniformly distributed over the directions within the cone
+// around the unit vector axis whose half angle has the cosine cosMax, determined by the seed, the ray and the sample index
+func (r Ray) RandomConeDirection(seed int64, sample int, axis Vector, cosMax float64) Vector {
+	return uniformCone(axis, cosMax, r.Random(seed, 2*sample), r.Random(seed, 2*sample+1))
+}
+
+// RandomUnitVector returns a pseudo-random unit vector uniformly distributed over the unit sphere
+func RandomUnitVector(rng *rand.Rand) Vector {
+	z := 2.0*rng.Float64() - 1.0
+	phi := 2.0 * math.Pi * rng.Float64()
+
+	planar := math.Sqrt(1.0 - z*z)
+	return Vector{X: planar * math.Cos(phi), Y: planar * math.Sin(phi), Z: z}
+}
+
+// RandomCosineHemisphere returns a pseudo-random unit vector in the hemisphere around the unit vector normal,
+// distributed in proportion to the cosine of its angle to the normal
+func RandomCosineHemisphere(normal Vector, rng *rand.Rand) Vector {
+	return cosineHemisphere(normal, rng.Float64(), rng.Float64())
+}
+
+// cosineHemisphere maps two uniform random numbers in [0, 1) to a cosine-distributed unit vector
+// around normal, by projecting a uniformly distributed point on the unit disk up onto the hemisphere
+func cosineHemisphere(normal Vector, u1 float64, u2 float64) Vector {
+	radius := math.Sqrt(u1)
+	return aroundAxis(normal, math.Sqrt(1.0-radius*radius), radius, 2.0*math.Pi*u2)
+}
+
+// uniformCone maps two uniform random numbers in [0, 1) to a unit vector uniformly distributed within the cone around
+// axis whose half angle has the cosine cosMax. The cosine of the angle to the axis is uniform over solid angle
+func uniformCone(axis Vector, cosMax float64, u1 float64, u2 float64) Vector {
+	cosine := 1.0 - u1*(1.0-cosMax)
+	return aroundAxis(axis, cosine, math.Sqrt(math.Max(0.0, 1.0-cosine*cosine)), 2.0*math.Pi*u2)
+}
+
+// aroundAxis returns the unit vector at an angle with the given cosine and sine to the unit vector axis, rotated by
+// phi around it
+func aroundAxis(axis Vector, cosine float64, sine float64, phi float64) Vector {
+	other := Vector{X: 1, Y: 0, Z: 0}
+	if math.Abs(axis.X) > 0.9 {
+		other = Vector{X: 0, Y: 1, Z: 0}
+	}
+	tangent, _ := axis.Cross(other).Normalize()
+	bitangent := axis.Cross(tangent)
+
+	direction := tangent.Scale(sine * math.Cos(phi))
+	direction = direction.Add(bitangent.Scale(sine * math.Sin(phi)))
+	return direction.Add(axis.Scale(cosine))
+}
+
+// mix is the finalizer of the SplitMix64 generator, which thoroughly scrambles the bits of hash
+func mix(hash uint64) uint64 {
+	hash += 0x9e3779b97f4a7c15
+	hash = (hash ^ (hash >> 30)) * 0xbf58476d1ce4e5b9
+	hash = (hash ^ (hash >> 27)) * 0x94d049bb133111eb
+	return hash ^ (hash >> 31)
+}
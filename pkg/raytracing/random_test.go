@@ -0,0 +1,137 @@
+package raytracing
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// chiSquaredLimit is the chi-squared statistic with 9 degrees of freedom exceeded by chance 0.1% of the time
+const chiSquaredLimit = 27.88
+
+// checkUniform reports an error if values in [0, 1] aren't consistent with a uniform distribution, by
+// the chi-squared test of a histogram with 10 bins
+func checkUniform(t *testing.T, name string, values []float64) {
+	t.Helper()
+	var bins [10]float64
+	for _, value := range values {
+		bins[int(math.Min(value*10.0, 9.0))]++
+	}
+
+	expected := float64(len(values)) / 10.0
+	statistic := 0.0
+	for _, count := range bins {
+		statistic += (count - expected) * (count - expected) / expected
+	}
+	if statistic > chiSquaredLimit {
+		t.Errorf("%s isn't uniformly distributed, chi-squared is %.1f for bins %v", name, statistic, bins)
+	}
+}
+
+func TestRandomUnitVector(t *testing.T) {
+	const samples = 100000
+	rng := rand.New(rand.NewSource(1))
+
+	var sum Vector
+	zs := make([]float64, samples)
+	for i := range zs {
+		v := RandomUnitVector(rng)
+		if math.Abs(v.Magnitude()-1.0) > 1e-9 {
+			t.Fatalf("vector %v isn't a unit vector", v)
+		}
+		sum = sum.Add(v)
+		zs[i] = 0.5 * (v.Z + 1.0)
+	}
+
+	// By Archimedes' hat-box theorem, the height of points uniform over the sphere is uniform, and each
+	// component has a variance of 1/3, so the mean should be well within 4 standard errors of zero
+	limit := 4.0 * math.Sqrt(1.0/3.0/samples)
+	if mean := sum.Scale(1.0 / samples); math.Abs(mean.X) > limit || math.Abs(mean.Y) > limit || math.Abs(mean.Z) > limit {
+		t.Errorf("mean %v of unit vectors isn't close to zero", mean)
+	}
+	checkUniform(t, "height of unit vectors", zs)
+}
+
+func TestRandomCosineHemisphere(t *testing.T) {
+	const samples = 100000
+	normals := []Vector{
+		{X: 0, Y: 1, Z: 0},
+		{X: 1, Y: 0, Z: 0},
+		{X: 0, Y: 0, Z: -1},
+		{X: 0.48, Y: -0.6, Z: 0.64},
+	}
+
+	for _, normal := range normals {
+		rng := rand.New(rand.NewSource(1))
+		var tangentSum Vector
+		cosineSum := 0.0
+		squaredCosines := make([]float64, samples)
+
+		for i := range squaredCosines {
+			v := RandomCosineHemisphere(normal, rng)
+			if math.Abs(v.Magnitude()-1.0) > 1e-9 {
+				t.Fatalf("normal %v: vector %v isn't a unit vector", normal, v)
+			}
+			cosine := v.Dot(normal)
+			if cosine < 0.0 {
+				t.Fatalf("normal %v: vector %v is outside the hemisphere", normal, v)
+			}
+			cosineSum += cosine
+			squaredCosines[i] = cosine * cosine
+			tangentSum = tangentSum.Add(v.Subtract(normal.Scale(cosine)))
+		}
+
+		// With a density proportional to cos(theta) sin(theta), the squared cosine is uniform and the
+		// mean cosine is 2/3, where a uniform hemisphere would have a mean cosine of 1/2
+		if mean := cosineSum / samples; math.Abs(mean-2.0/3.0) > 0.005 {
+			t.Errorf("normal %v: mean cosine is %v, want 2/3", normal, mean)
+		}
+		checkUniform(t, "squared cosine of hemisphere vectors", squaredCosines)
+
+		// Directions are spread evenly around the normal
+		if mean := tangentSum.Scale(1.0 / samples); mean.Magnitude() > 0.01 {
+			t.Errorf("normal %v: mean tangential component is %v, want zero", normal, mean)
+		}
+	}
+}
+
+func TestRayRandomCosineDirection(t *testing.T) {
+	// Randomness derived from each ray should be cosine distributed across many different rays
+	const samples = 100000
+	normal := Vector{X: 0, Y: 0, Z: 1}
+	squaredCosines := make([]float64, samples)
+	for i := range squaredCosines {
+		r := Ray{Position: Vector{X: float64(i) * 0.01, Y: 1, Z: 0}, Direction: Vector{X: 0, Y: 0, Z: 1}}
+		cosine := r.RandomCosineDirection(7, 0, normal).Dot(normal)
+		squaredCosines[i] = cosine * cosine
+	}
+	checkUniform(t, "squared cosine of ray directions", squaredCosines)
+}
+
+func TestRayRandomConeDirection(t *testing.T) {
+	const samples = 100000
+	axis, _ := Vector{X: 0.48, Y: -0.6, Z: 0.64}.Normalize()
+	for _, cosMax := range []float64{0.99, 0.5, 0.0, -0.5} {
+		var tangentSum Vector
+		cosines := make([]float64, samples)
+		for i := range cosines {
+			r := Ray{Position: Vector{X: float64(i) * 0.01, Y: 1, Z: 0}, Direction: Vector{X: 0, Y: 0, Z: 1}}
+			v := r.RandomConeDirection(7, 3, axis, cosMax)
+			if math.Abs(v.Magnitude()-1.0) > 1e-9 {
+				t.Fatalf("cone %v: vector %v isn't a unit vector", cosMax, v)
+			}
+			cosine := v.Dot(axis)
+			if cosine < cosMax-1e-12 {
+				t.Fatalf("cone %v: vector %v is outside the cone", cosMax, v)
+			}
+			// Uniform over solid angle, the cosine is uniform between cosMax and 1
+			cosines[i] = (1.0 - cosine) / (1.0 - cosMax)
+			tangentSum = tangentSum.Add(v.Subtract(axis.Scale(cosine)))
+		}
+		checkUniform(t, "cosine of cone directions", cosines)
+
+		if mean := tangentSum.Scale(1.0 / samples); mean.Magnitude() > 0.01 {
+			t.Errorf("cone %v: mean tangential component is %v, want zero", cosMax, mean)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package raytracing
+
+import (
+	"fmt"
+	"image"
+	// Register decoders for the image formats supported for textures
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+)
+
+// Filters for sampling textures between texels
+const (
+	FilterBilinear = "bilinear"
+	FilterNearest  = "nearest"
+)
+
+// Wrap modes for texture coordinates outside of 0.0 to 1.0
+const (
+	WrapRepeat = "repeat"
+	WrapClamp  = "clamp"
+	WrapMirror = "mirror"
+)
+
+// Texture is an image which can be sampled by surface coordinates
+type Texture struct {
+	width    int
+	height   int
+	texels   []Color
+	bilinear bool
+	wrap     string
+}
+
+// NewTexture creates a Texture from an image, sampled with the named filter and wrap mode
+func NewTexture(img image.Image, filter string, wrap string) (*Texture, error) {
+	if filter != FilterBilinear && filter != FilterNearest {
+		return nil, fmt.Errorf("unknown texture filter %q", filter)
+	}
+	if wrap != WrapRepeat && wrap != WrapClamp && wrap != WrapMirror {
+		return nil, fmt.Errorf("unknown texture wrap mode %q", wrap)
+	}
+
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, fmt.Errorf("texture image is empty")
+	}
+
+	t := &Texture{
+		width:    bounds.Dx(),
+		height:   bounds.Dy(),
+		texels:   make([]Color, bounds.Dx()*bounds.Dy()),
+		bilinear: filter == FilterBilinear,
+		wrap:     wrap,
+	}
+
+	for y := 0; y < t.height; y++ {
+		for x := 0; x < t.width; x++ {
+			red, green, blue, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			t.texels[y*t.width+x] = Color{
+				Red:   float64(red) / 0xffff,
+				Green: float64(green) / 0xffff,
+				Blue:  float64(blue) / 0xffff,
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// LoadTexture decodes a PNG or JPEG image file into a Texture, sampled with the named filter and wrap mode
+func LoadTexture(path string, filter string, wrap string) (*Texture, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTexture(img, filter, wrap)
+}
+
+// Sample returns the color of the texture at coordinates u and v, where 0.0 to 1.0 spans the
+// image from its left edge to its right edge, and from its top edge to its bottom edge
+func (t *Texture) Sample(u float64, v float64) Color {
+	// Texel centers are at half-integer coordinates
+	x := u*float64(t.width) - 0.5
+	y := v*float64(t.height) - 0.5
+
+	if !t.bilinear {
+		return t.texel(int(math.Round(x)), int(math.Round(y)))
+	}
+
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	left, top := int(x0), int(y0)
+
+	topLeft := t.texel(left, top)
+	topRight := t.texel(left+1, top)
+	bottomLeft := t.texel(left, top+1)
+	bottomRight := t.texel(left+1, top+1)
+
+	return topLeft.Blend(topRight, fx).Blend(bottomLeft.Blend(bottomRight, fx), fy)
+}
+
+// texel returns the texel at integer coordinates, which are wrapped into the image
+func (t *Texture) texel(x int, y int) Color {
+	return t.texels[wrapCoordinate(y, t.height, t.wrap)*t.width+wrapCoordinate(x, t.width, t.wrap)]
+}
+
+// wrapCoordinate maps a texel coordinate into 0 to size-1 according to the wrap mode
+func wrapCoordinate(i int, size int, wrap string) int {
+	switch wrap {
+	case WrapClamp:
+		if i < 0 {
+			return 0
+		}
+		if i >= size {
+			return size - 1
+		}
+		return i
+	case WrapMirror:
+		// Every other repetition is flipped, so the period is twice the size
+		i %= 2 * size
+		if i < 0 {
+			i += 2 * size
+		}
+		if i >= size {
+			i = 2*size - 1 - i
+		}
+		return i
+	default:
+		i %= size
+		if i < 0 {
+			i += size
+		}
+		return i
+	}
+}
+
+func lerp(a float64, b float64, t float64) float64 {
+	return a + (b-a)*t
+}
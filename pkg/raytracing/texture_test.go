@@ -0,0 +1,141 @@
+package raytracing
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+var (
+	redTexel   = Color{Red: 1}
+	greenTexel = Color{Green: 1}
+	blueTexel  = Color{Blue: 1}
+	whiteTexel = Color{Red: 1, Green: 1, Blue: 1}
+)
+
+// newTestTexture returns a 2x2 texture which is red and green along the top, and blue and white along the bottom
+func newTestTexture(t *testing.T, filter string, wrap string) *Texture {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	img.Set(1, 0, color.RGBA{G: 255, A: 255})
+	img.Set(0, 1, color.RGBA{B: 255, A: 255})
+	img.Set(1, 1, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+
+	texture, err := NewTexture(img, filter, wrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return texture
+}
+
+func colorsClose(a Color, b Color) bool {
+	const tolerance = 1e-9
+	return math.Abs(a.Red-b.Red) < tolerance && math.Abs(a.Green-b.Green) < tolerance && math.Abs(a.Blue-b.Blue) < tolerance
+}
+
+type textureSample struct {
+	u, v float64
+	want Color
+}
+
+func checkSamples(t *testing.T, texture *Texture, samples []textureSample) {
+	t.Helper()
+	for _, sample := range samples {
+		if got := texture.Sample(sample.u, sample.v); !colorsClose(got, sample.want) {
+			t.Errorf("Sample(%v, %v) = %v, want %v", sample.u, sample.v, got, sample.want)
+		}
+	}
+}
+
+func TestBilinearSamplesTexelCenters(t *testing.T) {
+	checkSamples(t, newTestTexture(t, FilterBilinear, WrapRepeat), []textureSample{
+		{0.25, 0.25, redTexel},
+		{0.75, 0.25, greenTexel},
+		{0.25, 0.75, blueTexel},
+		{0.75, 0.75, whiteTexel},
+	})
+}
+
+func TestBilinearInterpolatesBetweenTexels(t *testing.T) {
+	checkSamples(t, newTestTexture(t, FilterBilinear, WrapClamp), []textureSample{
+		{0.5, 0.25, redTexel.Blend(greenTexel, 0.5)},
+		{0.25, 0.5, redTexel.Blend(blueTexel, 0.5)},
+		{0.5, 0.5, Color{Red: 0.5, Green: 0.5, Blue: 0.5}},
+		{0.375, 0.25, redTexel.Blend(greenTexel, 0.25)},
+	})
+}
+
+func TestBilinearBoundaries(t *testing.T) {
+	// At the edges of the image, half of each sample comes from beyond the edge. Repeating wraps around
+	// to the texels on the opposite edge, while clamping repeats the edge texels
+	checkSamples(t, newTestTexture(t, FilterBilinear, WrapRepeat), []textureSample{
+		{0.0, 0.25, redTexel.Blend(greenTexel, 0.5)},
+		{1.0, 0.25, redTexel.Blend(greenTexel, 0.5)},
+		{0.25, 0.0, redTexel.Blend(blueTexel, 0.5)},
+		{0.0, 0.0, Color{Red: 0.5, Green: 0.5, Blue: 0.5}},
+		{1.25, 0.25, redTexel},
+	})
+	checkSamples(t, newTestTexture(t, FilterBilinear, WrapClamp), []textureSample{
+		{0.0, 0.25, redTexel},
+		{1.0, 0.25, greenTexel},
+		{0.25, 1.0, blueTexel},
+		{1.0, 1.0, whiteTexel},
+		{-3.0, 0.75, blueTexel},
+	})
+}
+
+func TestNearestSamplesClosestTexel(t *testing.T) {
+	checkSamples(t, newTestTexture(t, FilterNearest, WrapRepeat), []textureSample{
+		{0.25, 0.25, redTexel},
+		{0.49, 0.25, redTexel},
+		{0.51, 0.25, greenTexel},
+		{0.9, 0.9, whiteTexel},
+	})
+}
+
+func TestWrapCoordinate(t *testing.T) {
+	tests := []struct {
+		wrap string
+		// want is the wrapped coordinate for each coordinate from -4 to 5, in an image of size 3
+		want [10]int
+	}{
+		{WrapRepeat, [10]int{2, 0, 1, 2, 0, 1, 2, 0, 1, 2}},
+		{WrapClamp, [10]int{0, 0, 0, 0, 0, 1, 2, 2, 2, 2}},
+		{WrapMirror, [10]int{2, 2, 1, 0, 0, 1, 2, 2, 1, 0}},
+	}
+	for _, test := range tests {
+		for i, want := range test.want {
+			coordinate := i - 4
+			if got := wrapCoordinate(coordinate, 3, test.wrap); got != want {
+				t.Errorf("%s: wrapCoordinate(%d, 3) = %d, want %d", test.wrap, coordinate, got, want)
+			}
+		}
+	}
+}
+
+func TestWrapModesOutsideImage(t *testing.T) {
+	checkSamples(t, newTestTexture(t, FilterNearest, WrapRepeat), []textureSample{
+		{1.25, 0.25, redTexel},
+		{-0.25, 0.25, greenTexel},
+		{0.25, 1.75, blueTexel},
+	})
+	checkSamples(t, newTestTexture(t, FilterNearest, WrapClamp), []textureSample{
+		{1.25, 0.25, greenTexel},
+		{-0.25, 0.25, redTexel},
+		{5.0, 5.0, whiteTexel},
+	})
+	// Mirroring flips every other repetition, so samples just past an edge see the texels at that edge
+	checkSamples(t, newTestTexture(t, FilterNearest, WrapMirror), []textureSample{
+		{1.25, 0.25, greenTexel},
+		{1.75, 0.25, redTexel},
+		{-0.25, 0.25, redTexel},
+		{-0.75, 0.25, greenTexel},
+		{0.25, 1.25, blueTexel},
+	})
+	checkSamples(t, newTestTexture(t, FilterBilinear, WrapMirror), []textureSample{
+		{1.0, 0.25, greenTexel},
+		{0.0, 0.75, blueTexel},
+	})
+}
@@ -0,0 +1,117 @@
+package raytracing
+
+import (
+	"fmt"
+	"math"
+)
+
+// wearNoiseDeviation is the measured standard deviation of Noise at random positions
+const wearNoiseDeviation = 0.27
+
+// Wear blends a material towards a worn version of it in patches of noise evaluated at the hit position,
+// such as scuffed metal or chipped paint. Worn parameters which aren't given keep the material's own value
+type Wear struct {
+	// Scale is the size in scene units of the noise features making up the patches
+	Scale *float64 `json:"scale"`
+	// Coverage is the fraction of the surface which is worn, from 0.0 to 1.0
+	Coverage *float64 `json:"coverage"`
+	// Blend is the width of the transition between worn and unworn surface, as a fraction of the
+	// surface, where 0.0 gives hard edges to the patches
+	Blend   *float64 `json:"blend"`
+	Octaves *int     `json:"octaves"`
+	Seed    int64    `json:"seed"`
+
+	Diffuse     *Color   `json:"diffuse"`
+	Reflectance *float64 `json:"reflectance"`
+	Roughness   *float64 `json:"roughness"`
+}
+
+// Validate checks the wear parameters and sets defaults
+func (w *Wear) Validate() error {
+	if w.Scale == nil {
+		scale := 1.0
+		w.Scale = &scale
+	}
+	if *w.Scale <= 0.0 {
+		return fmt.Errorf("wear scale must be positive")
+	}
+	if w.Coverage == nil {
+		coverage := 0.3
+		w.Coverage = &coverage
+	}
+	if *w.Coverage < 0.0 || *w.Coverage > 1.0 {
+		return fmt.Errorf("wear coverage must be between 0 and 1")
+	}
+	if w.Blend == nil {
+		blend := 0.1
+		w.Blend = &blend
+	}
+	if *w.Blend < 0.0 {
+		return fmt.Errorf("wear blend cannot be negative")
+	}
+	if w.Octaves == nil {
+		octaves := 4
+		w.Octaves = &octaves
+	}
+	if *w.Octaves < 1 {
+		return fmt.Errorf("wear octaves must be at least 1")
+	}
+	if w.Reflectance != nil && (*w.Reflectance < 0.0 || *w.Reflectance > 1.0) {
+		return fmt.Errorf("wear reflectance must be between 0 and 1")
+	}
+	if w.Roughness != nil && *w.Roughness < 0.0 {
+		return fmt.Errorf("wear roughness cannot be negative")
+	}
+	return nil
+}
+
+// MaskAt returns how worn the surface is at a position, from 0.0 for unworn to 1.0 for fully worn
+func (w *Wear) MaskAt(position Vector) float64 {
+	position = position.Scale(1.0 / *w.Scale)
+	sum, total, squares, amplitude := 0.0, 0.0, 0.0, 1.0
+	for i := 0; i < *w.Octaves; i++ {
+		sum += amplitude * Noise(position, w.Seed)
+		total += amplitude
+		squares += amplitude * amplitude
+		position = position.Scale(2.0)
+		amplitude *= 0.5
+	}
+
+	// The summed noise is close to normally distributed around zero, with a standard deviation of
+	// about 0.27 for one octave, so its cumulative distribution spreads it evenly between 0.0 and 1.0
+	// and the coverage is the fraction of the surface above the threshold
+	deviation := wearNoiseDeviation * math.Sqrt(squares) / total
+	value := 0.5 * (1.0 + math.Erf(sum/total/(deviation*math.Sqrt2)))
+
+	threshold := 1.0 - *w.Coverage
+	if *w.Blend == 0.0 {
+		if value > threshold {
+			return 1.0
+		}
+		return 0.0
+	}
+	t := (value-threshold) / *w.Blend + 0.5
+	return smoothstep(math.Max(0.0, math.Min(t, 1.0)))
+}
+
+// Worn returns the material blended towards its worn parameters by the wear mask at a position
+func (m Material) Worn(position Vector) Material {
+	if m.Wear == nil {
+		return m
+	}
+
+	mask := m.Wear.MaskAt(position)
+	if mask == 0.0 {
+		return m
+	}
+	if m.Wear.Diffuse != nil {
+		m.Diffuse = m.Diffuse.Blend(*m.Wear.Diffuse, mask)
+	}
+	if m.Wear.Reflectance != nil {
+		m.Reflectance = lerp(m.Reflectance, *m.Wear.Reflectance, mask)
+	}
+	if m.Wear.Roughness != nil {
+		m.Roughness = lerp(m.Roughness, *m.Wear.Roughness, mask)
+	}
+	return m
+}
@@ -0,0 +1,55 @@
+package render_test
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/brendanburkhart/raytracer/pkg/raytracing"
+	"github.com/brendanburkhart/raytracer/pkg/raytracing/object"
+	"github.com/brendanburkhart/raytracer/pkg/render"
+)
+
+// Example renders a red sphere resting on a grey floor, assembled without any JSON
+func Example() {
+	target := raytracing.Vector{X: 0, Y: 1, Z: 0}
+	cam, err := render.NewCamera(render.NewPerspectiveLens(60, 1), render.Scope{
+		Position: raytracing.Vector{X: 0, Y: 2, Z: -5},
+		Target:   &target,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	white := raytracing.Color{Red: 1, Green: 1, Blue: 1}
+	s := &render.Scene{
+		Materials: []raytracing.Material{
+			{Diffuse: raytracing.Color{Red: 0.8, Green: 0.2, Blue: 0.2}, Specular: white, Alpha: 20},
+			{Diffuse: white.Scale(0.5)},
+		},
+		Lights: []raytracing.Light{
+			{Position: raytracing.Vector{X: -3, Y: 5, Z: -3}, Diffuse: white, Specular: white, Ambient: white.Scale(0.2)},
+		},
+		Objects: []object.Object{
+			object.NewSphere(target, 1, 0),
+			object.NewPlane(raytracing.Vector{}, raytracing.Vector{Y: 1}, 1),
+		},
+	}
+	if err := s.Initialize(); err != nil {
+		log.Fatal(err)
+	}
+
+	// 160x120 image, at most 5 reflections, 64 ray tracing goroutines
+	img, err := render.Render(s, cam, 160, 120, 5, 64)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The middle of the image sees the sphere, and the bottom sees the floor in front of it
+	fmt.Println(img.Bounds())
+	fmt.Println(img.At(80, 60))
+	fmt.Println(img.At(80, 110))
+	// Output:
+	// (0,0)-(160,120)
+	// {105 26 26 255}
+	// {106 106 106 255}
+}
@@ -0,0 +1,64 @@
+// Package render is the entry point for embedding the raytracer in other programs. It exposes the
+// camera and scene types, which otherwise live in internal packages, so scenes can be assembled
+// and rendered directly from Go values instead of JSON scene files
+package render
+
+import (
+	"image"
+
+	"github.com/brendanburkhart/raytracer/internal/camera"
+	"github.com/brendanburkhart/raytracer/internal/scene"
+)
+
+// Camera renders a scene using a specific view and perspective, see NewCamera
+type Camera = camera.Camera
+
+// Scope positions and orients a Camera
+type Scope = camera.Scope
+
+// Lens calculates light rays from a Camera into the scene
+type Lens = camera.Lens
+
+// Scene holds the materials, lights and objects to render. Initialize must be called after
+// the scene is assembled and before it is rendered
+type Scene = scene.Scene
+
+// NewCamera creates a Camera with the given lens and scope, using default options
+func NewCamera(lens Lens, scope Scope) (*Camera, error) {
+	return camera.NewCamera(lens, scope)
+}
+
+// NewOrthographicLens creates an orthographic lens whose view is viewWidth wide
+func NewOrthographicLens(viewWidth float64) Lens {
+	return camera.NewOrthographicLens(viewWidth)
+}
+
+// NewFisheyeLens creates a fisheye lens with the given horizontal field of view in degrees.
+// If vfov is zero, the vertical field of view is derived from the image aspect ratio
+func NewFisheyeLens(hfov float64, vfov float64) Lens {
+	return camera.NewFisheyeLens(hfov, vfov)
+}
+
+// NewPerspectiveLens creates a perspective lens with the given horizontal field of view in degrees
+func NewPerspectiveLens(hfov float64, focalLength float64) Lens {
+	return camera.NewPerspectiveLens(hfov, focalLength)
+}
+
+// NewEquirectangularLens creates a lens covering the full sphere around the camera
+func NewEquirectangularLens() Lens {
+	return camera.NewEquirectangularLens()
+}
+
+// Render renders an initialized Scene with the Camera into an image of the given size, using at
+// most maxReflections reflections per ray and the given number of concurrent ray tracing goroutines
+func Render(s *Scene, c *Camera, width int, height int, maxReflections int, threads int) (*image.RGBA, error) {
+	if err := c.SetImageSize(width, height); err != nil {
+		return nil, err
+	}
+
+	if err := c.Render(s, maxReflections, threads); err != nil {
+		return nil, err
+	}
+
+	return c.Image()
+}